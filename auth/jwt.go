@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"food-delivery-api/models"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed tokens or bad signatures.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned when a token's exp claim is in the past.
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Claims is the payload carried by an access token.
+type Claims struct {
+	Subject   string      `json:"sub"`
+	Role      models.Role `json:"role"`
+	IssuedAt  int64       `json:"iat"`
+	ExpiresAt int64       `json:"exp"`
+}
+
+// header is the fixed JOSE header for HS256 tokens.
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// NewClaims builds claims for a user valid for ttl from now.
+func NewClaims(userID string, role models.Role, ttl time.Duration, now time.Time) Claims {
+	return Claims{
+		Subject:   userID,
+		Role:      role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+}
+
+// Sign encodes the claims as an HS256-signed JWT.
+func Sign(claims Claims, secret []byte) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + signature(unsigned, secret), nil
+}
+
+// Parse verifies the token's signature and expiry and returns its claims.
+func Parse(token string, secret []byte, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return nil, ErrInvalidToken
+	}
+	expected := signature(parts[0]+"."+parts[1], secret)
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Subject == "" || !claims.Role.IsValid() {
+		return nil, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+// signature returns the base64url HMAC-SHA256 of the signing input.
+func signature(unsigned string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// MinPasswordLength is the shortest password accepted at registration.
+	MinPasswordLength = 8
+	// MaxPasswordLength is bcrypt's limit; longer passwords would be
+	// silently truncated.
+	MaxPasswordLength = 72
+)
+
+// HashPassword returns the bcrypt hash stored for a password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches a hash made by
+// HashPassword. An empty hash, for users created before passwords, never
+// matches.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
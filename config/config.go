@@ -0,0 +1,339 @@
+package config
+
+import (
+	"fmt"
+	"food-delivery-api/db"
+	"food-delivery-api/eta"
+	"food-delivery-api/handlers"
+	"food-delivery-api/models"
+	"food-delivery-api/timeout"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the server's configuration, read from the environment once at
+// startup. The README's Configuration table documents each variable.
+type Config struct {
+	// MongoURI is the MongoDB connection string (MONGO_URI).
+	MongoURI string
+	// MongoDatabase is the database to use (MONGO_DB).
+	MongoDatabase string
+	// ListenAddr is the address the HTTP server listens on (LISTEN_ADDR).
+	ListenAddr string
+
+	// JWTSecret signs access tokens (JWT_SECRET) and is required.
+	JWTSecret string
+	// JWTTTL is how long access tokens are valid (JWT_TTL).
+	JWTTTL time.Duration
+
+	// StateMachineFile replaces the built-in order lifecycle
+	// (STATE_MACHINE_FILE).
+	StateMachineFile string
+	// SeedFile holds fixtures loaded into empty collections (SEED_FILE).
+	SeedFile string
+
+	// ReadHeaderTimeout bounds reading a request's headers
+	// (READ_HEADER_TIMEOUT).
+	ReadHeaderTimeout time.Duration
+	// IdleTimeout closes keep-alive connections left idle (IDLE_TIMEOUT).
+	IdleTimeout time.Duration
+	// ShutdownDelay is how long /readyz fails before the listener closes
+	// (SHUTDOWN_DELAY).
+	ShutdownDelay time.Duration
+	// ShutdownTimeout bounds waiting for requests to finish on shutdown
+	// (SHUTDOWN_TIMEOUT).
+	ShutdownTimeout time.Duration
+
+	// Pricing is the tax and delivery fee charged on new orders (TAX_RATE,
+	// DELIVERY_FEE, DELIVERY_BASE_FEE, DELIVERY_FEE_PER_KM,
+	// DELIVERY_FEE_CAP).
+	Pricing models.Pricing
+	// ETA sets the promised delivery time (ETA_BASE_PREP_MINUTES,
+	// ETA_DELIVERY_MINUTES).
+	ETA eta.Settings
+	// CancellationFees is charged on late customer cancellations
+	// (CANCELLATION_FEE_POLICY).
+	CancellationFees models.CancellationFeePolicy
+	// CancelGracePeriod is how long customers may cancel free
+	// (CANCEL_GRACE_PERIOD).
+	CancelGracePeriod time.Duration
+	// BlockLateCancels refuses late cancellations instead of charging
+	// (LATE_CANCELLATION=block).
+	BlockLateCancels bool
+	// TipWindow is how long after delivery tips may change (TIP_WINDOW).
+	TipWindow time.Duration
+	// RevertWindow is how long a status change may be undone
+	// (REVERT_WINDOW).
+	RevertWindow time.Duration
+
+	// OrderTimeouts cancels orders stuck in a status (ORDER_TIMEOUTS).
+	OrderTimeouts timeout.Policy
+	// OrderTimeoutInterval is how often stuck orders are swept
+	// (ORDER_TIMEOUT_INTERVAL).
+	OrderTimeoutInterval time.Duration
+	// ScheduleInterval is how often scheduled orders are checked
+	// (SCHEDULE_INTERVAL).
+	ScheduleInterval time.Duration
+	// DriverIdleTimeout marks silent drivers unavailable; zero disables it
+	// (DRIVER_IDLE_TIMEOUT).
+	DriverIdleTimeout time.Duration
+
+	// WebhookSecret signs webhooks; empty disables them (WEBHOOK_SECRET).
+	WebhookSecret string
+	// DriverNotifier and DriverNotifyURL choose how drivers are alerted
+	// (DRIVER_NOTIFIER, DRIVER_NOTIFY_URL); see notify.Parse.
+	DriverNotifier  string
+	DriverNotifyURL string
+	// PaymentProvider is the card payment gateway (PAYMENT_PROVIDER); see
+	// payment.Parse.
+	PaymentProvider string
+	// Geocoder and GeocoderURL choose how delivery addresses are located
+	// (GEOCODER, GEOCODER_URL); see geocode.Parse.
+	Geocoder    string
+	GeocoderURL string
+	// GeocodeCacheTTL is how long geocoding answers are reused
+	// (GEOCODE_CACHE_TTL).
+	GeocodeCacheTTL time.Duration
+
+	// MetricsStatusRefresh is how long /metrics reuses order counts
+	// (METRICS_STATUS_REFRESH).
+	MetricsStatusRefresh time.Duration
+	// ResponseEnvelope wraps responses in an envelope by default
+	// (RESPONSE_ENVELOPE).
+	ResponseEnvelope bool
+	// RateLimitReads, RateLimitWrites and RateLimitOrders are per-client
+	// budgets in requests per minute (RATE_LIMIT_READS, RATE_LIMIT_WRITES,
+	// RATE_LIMIT_ORDERS).
+	RateLimitReads  int
+	RateLimitWrites int
+	RateLimitOrders int
+	// MaxBodyBytes caps request bodies (MAX_BODY_BYTES).
+	MaxBodyBytes int64
+	// CORSOrigins may call the API from a browser; empty disables CORS
+	// (CORS_ALLOWED_ORIGINS).
+	CORSOrigins []string
+}
+
+// Load reads the configuration from the environment, applying defaults for
+// unset variables. It reports every invalid or missing value at once.
+func Load() (*Config, error) {
+	return load(os.LookupEnv)
+}
+
+// load reads the configuration through lookup.
+func load(lookup func(string) (string, bool)) (*Config, error) {
+	e := &env{lookup: lookup}
+	c := &Config{
+		MongoURI:      e.string("MONGO_URI", "mongodb://localhost:27017"),
+		MongoDatabase: e.string("MONGO_DB", db.DefaultDatabase),
+		ListenAddr:    e.string("LISTEN_ADDR", ":8080"),
+
+		JWTSecret: e.string("JWT_SECRET", ""),
+		JWTTTL:    e.positiveDuration("JWT_TTL", 24*time.Hour),
+
+		StateMachineFile: e.string("STATE_MACHINE_FILE", ""),
+		SeedFile:         e.string("SEED_FILE", ""),
+
+		ReadHeaderTimeout: e.positiveDuration("READ_HEADER_TIMEOUT", 10*time.Second),
+		IdleTimeout:       e.positiveDuration("IDLE_TIMEOUT", 2*time.Minute),
+		ShutdownDelay:     e.duration("SHUTDOWN_DELAY", 0),
+		ShutdownTimeout:   e.positiveDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+
+		Pricing: models.Pricing{
+			TaxRate:         e.float("TAX_RATE", 0),
+			DeliveryFee:     e.float("DELIVERY_FEE", 0),
+			DeliveryBaseFee: e.float("DELIVERY_BASE_FEE", 0),
+			DeliveryPerKM:   e.float("DELIVERY_FEE_PER_KM", 0),
+			DeliveryFeeCap:  e.float("DELIVERY_FEE_CAP", 0),
+		},
+		ETA: eta.Settings{
+			BasePrep: e.minutes("ETA_BASE_PREP_MINUTES", eta.DefaultSettings.BasePrep),
+			Delivery: e.minutes("ETA_DELIVERY_MINUTES", eta.DefaultSettings.Delivery),
+		},
+		CancelGracePeriod: e.duration("CANCEL_GRACE_PERIOD", 0),
+		TipWindow:         e.positiveDuration("TIP_WINDOW", handlers.DefaultTipWindow),
+		RevertWindow:      e.duration("REVERT_WINDOW", handlers.DefaultRevertWindow),
+
+		OrderTimeoutInterval: e.positiveDuration("ORDER_TIMEOUT_INTERVAL", time.Minute),
+		ScheduleInterval:     e.positiveDuration("SCHEDULE_INTERVAL", 30*time.Second),
+		DriverIdleTimeout:    e.duration("DRIVER_IDLE_TIMEOUT", 10*time.Minute),
+
+		WebhookSecret:   e.string("WEBHOOK_SECRET", ""),
+		DriverNotifier:  "log",
+		DriverNotifyURL: e.string("DRIVER_NOTIFY_URL", ""),
+		PaymentProvider: e.string("PAYMENT_PROVIDER", ""),
+		Geocoder:        e.string("GEOCODER", ""),
+		GeocoderURL:     e.string("GEOCODER_URL", ""),
+		GeocodeCacheTTL: e.positiveDuration("GEOCODE_CACHE_TTL", 24*time.Hour),
+
+		MetricsStatusRefresh: e.duration("METRICS_STATUS_REFRESH", handlers.DefaultStatusRefresh),
+		ResponseEnvelope:     e.bool("RESPONSE_ENVELOPE", false),
+		RateLimitReads:       e.int("RATE_LIMIT_READS", 300),
+		RateLimitWrites:      e.int("RATE_LIMIT_WRITES", 60),
+		RateLimitOrders:      e.int("RATE_LIMIT_ORDERS", 10),
+		MaxBodyBytes:         int64(e.int("MAX_BODY_BYTES", handlers.DefaultMaxBodyBytes)),
+	}
+
+	if c.JWTSecret == "" {
+		e.fail("JWT_SECRET must be set")
+	}
+	if !validDatabaseName(c.MongoDatabase) {
+		e.fail("invalid MONGO_DB: %q", c.MongoDatabase)
+	}
+	if err := c.Pricing.Validate(); err != nil {
+		e.fail("invalid pricing: %v", err)
+	}
+	if c.MaxBodyBytes == 0 {
+		e.fail("invalid MAX_BODY_BYTES: must be greater than 0")
+	}
+	// Setting DRIVER_NOTIFIER to an empty string disables alerts.
+	if v, ok := e.lookup("DRIVER_NOTIFIER"); ok {
+		c.DriverNotifier = v
+	}
+
+	var err error
+	if c.CancellationFees, err = models.ParseCancellationFeePolicy(e.string("CANCELLATION_FEE_POLICY", "")); err != nil {
+		e.fail("invalid CANCELLATION_FEE_POLICY: %v", err)
+	}
+	switch v := e.string("LATE_CANCELLATION", "fee"); v {
+	case "", "fee":
+	case "block":
+		c.BlockLateCancels = true
+	default:
+		e.fail("invalid LATE_CANCELLATION: %q; expected fee or block", v)
+	}
+	// Setting ORDER_TIMEOUTS to an empty string disables the sweeper.
+	c.OrderTimeouts = timeout.DefaultPolicy
+	if v, ok := e.lookup("ORDER_TIMEOUTS"); ok {
+		if c.OrderTimeouts, err = timeout.ParsePolicy(v); err != nil {
+			e.fail("invalid ORDER_TIMEOUTS: %v", err)
+		}
+	}
+	if c.CORSOrigins, err = handlers.ParseCORSOrigins(e.string("CORS_ALLOWED_ORIGINS", "")); err != nil {
+		e.fail("invalid CORS_ALLOWED_ORIGINS: %v", err)
+	}
+
+	if len(e.problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(e.problems, "; "))
+	}
+	return c, nil
+}
+
+// validDatabaseName reports whether MongoDB accepts name as a database
+// name: under 64 bytes, without path separators, dots, quotes, dollar
+// signs or whitespace.
+func validDatabaseName(name string) bool {
+	return len(name) < 64 && !strings.ContainsAny(name, `/\. "$*<>:|?`+"\t\n\x00")
+}
+
+// env reads typed values from the environment, collecting every problem
+// so they can be reported together.
+type env struct {
+	lookup   func(string) (string, bool)
+	problems []string
+}
+
+// fail records a problem.
+func (e *env) fail(format string, args ...interface{}) {
+	e.problems = append(e.problems, fmt.Sprintf(format, args...))
+}
+
+// string returns the variable, or def when it is unset or empty.
+func (e *env) string(name, def string) string {
+	if v := e.value(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// value returns the variable, or "" when it is unset.
+func (e *env) value(name string) string {
+	v, _ := e.lookup(name)
+	return v
+}
+
+// duration reads a non-negative Go duration.
+func (e *env) duration(name string, def time.Duration) time.Duration {
+	v := e.value(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		e.fail("invalid %s: %q", name, v)
+		return def
+	}
+	return d
+}
+
+// positiveDuration reads a Go duration greater than zero.
+func (e *env) positiveDuration(name string, def time.Duration) time.Duration {
+	v := e.value(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		e.fail("invalid %s: %q", name, v)
+		return def
+	}
+	return d
+}
+
+// minutes reads a non-negative whole number of minutes.
+func (e *env) minutes(name string, def time.Duration) time.Duration {
+	v := e.value(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		e.fail("invalid %s: %q", name, v)
+		return def
+	}
+	return time.Duration(n) * time.Minute
+}
+
+// int reads a non-negative integer.
+func (e *env) int(name string, def int) int {
+	v := e.value(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		e.fail("invalid %s: %q", name, v)
+		return def
+	}
+	return n
+}
+
+// float reads a number.
+func (e *env) float(name string, def float64) float64 {
+	v := e.value(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.fail("invalid %s: %q", name, v)
+		return def
+	}
+	return f
+}
+
+// bool reads true or false, in any form strconv.ParseBool accepts.
+func (e *env) bool(name string, def bool) bool {
+	v := e.value(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail("invalid %s: %q; expected true or false", name, v)
+		return def
+	}
+	return b
+}
@@ -2,9 +2,12 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"food-delivery-api/models"
 	"log"
+	"regexp"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,15 +17,28 @@ import (
 
 // Store wraps a MongoDB client and provides CRUD operations.
 type Store struct {
-	client    *mongo.Client
-	db        *mongo.Database
-	users     *mongo.Collection
-	orders    *mongo.Collection
-	menuItems *mongo.Collection
+	client     *mongo.Client
+	db         *mongo.Database
+	users      *mongo.Collection
+	orders     *mongo.Collection
+	menuItems  *mongo.Collection
+	counters   *mongo.Collection
+	addresses  *mongo.Collection
+	coupons    *mongo.Collection
+	locations  *mongo.Collection
+	categories *mongo.Collection
+	// transactions is set when the deployment can run multi-document
+	// transactions; see WithTransaction.
+	transactions bool
 }
 
-// NewStore connects to MongoDB and returns a Store.
-func NewStore(mongoURI string) (*Store, error) {
+// DefaultDatabase is the database used when NewStore is given no name.
+const DefaultDatabase = "fooddash"
+
+// NewStore connects to MongoDB and returns a Store using the named
+// database, or DefaultDatabase when name is empty. Separate environments
+// sharing a cluster should use separate names.
+func NewStore(mongoURI, name string) (*Store, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -37,39 +53,216 @@ func NewStore(mongoURI string) (*Store, error) {
 		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
-	db := client.Database("fooddash")
-	log.Println("✅ Connected to MongoDB")
+	if name == "" {
+		name = DefaultDatabase
+	}
+	db := client.Database(name)
+	log.Printf("✅ Connected to MongoDB (database %s)", name)
+
+	transactions, err := supportsTransactions(ctx, client)
+	if err != nil {
+		log.Printf("⚠️ db: checking for transaction support: %v", err)
+	}
+	if !transactions {
+		log.Println("⚠️ db: MongoDB is not a replica set; multi-document writes run without transactions and are not rolled back on failure")
+	}
+
+	store := &Store{
+		client:     client,
+		db:         db,
+		users:      db.Collection("users"),
+		orders:     db.Collection("orders"),
+		menuItems:  db.Collection("menu_items"),
+		counters:   db.Collection("counters"),
+		addresses:  db.Collection("addresses"),
+		coupons:    db.Collection("coupons"),
+		locations:  db.Collection("driver_locations"),
+		categories: db.Collection("menu_categories"),
+
+		transactions: transactions,
+	}
+	if err := store.ensureIndexes(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create indexes: %w", err)
+	}
+	return store, nil
+}
+
+// supportsTransactions reports whether the deployment is a replica set or
+// sharded cluster. Standalone servers cannot run transactions.
+func supportsTransactions(ctx context.Context, client *mongo.Client) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false, err
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
+// queryTimeout caps each store operation. Callers pass the request context,
+// so a client that hangs up or a shorter request deadline ends it sooner.
+const queryTimeout = 5 * time.Second
+
+// transactionTimeout caps a whole transaction, including any retries.
+const transactionTimeout = 15 * time.Second
+
+// LocationTrailTTL is how long driver location breadcrumbs are kept.
+const LocationTrailTTL = 24 * time.Hour
+
+// ErrDuplicateEmail is returned when saving a user whose email is already
+// registered to someone else.
+var ErrDuplicateEmail = errors.New("email already registered")
+
+// ErrDuplicateCategory is returned when a restaurant already has a menu
+// category with the same normalised name.
+var ErrDuplicateCategory = errors.New("category already exists")
+
+// ErrDuplicateMenuItem is returned when a restaurant already has a menu
+// item with the same normalised name.
+var ErrDuplicateMenuItem = errors.New("menu item already exists")
+
+// ErrDuplicateCoupon is returned when saving a coupon whose code is
+// already taken.
+var ErrDuplicateCoupon = errors.New("coupon already exists")
+
+// ErrOrderNotFound is returned, wrapped with the ID, when an order does not
+// exist.
+var ErrOrderNotFound = errors.New("order not found")
+
+// ensureIndexes creates the indexes used by the list queries and the unique
+// email constraint. Creating an index that already exists with the same
+// keys is a no-op, so this is safe to run on every start.
+func (s *Store) ensureIndexes(ctx context.Context) error {
+	// Email is optional, so only documents that have one take part.
+	emailIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"email": bson.M{"$type": "string"}}),
+	}
+	if _, err := s.users.Indexes().CreateOne(ctx, emailIndex); err != nil {
+		return err
+	}
+	orderIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "customer_id", Value: 1}}},
+		{Keys: bson.D{{Key: "restaurant_id", Value: 1}}},
+		{Keys: bson.D{{Key: "driver_id", Value: 1}}},
+		// Order lists are newest first by default.
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	}
+	if _, err := s.orders.Indexes().CreateMany(ctx, orderIndexes); err != nil {
+		return err
+	}
+	menuIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "restaurant_id", Value: 1}}},
+		// Items saved before names were unique have no name_key and are
+		// left out, so existing duplicates don't stop the index building.
+		{
+			Keys: bson.D{{Key: "restaurant_id", Value: 1}, {Key: "name_key", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"name_key": bson.M{"$type": "string"}}),
+		},
+	}
+	if _, err := s.menuItems.Indexes().CreateMany(ctx, menuIndexes); err != nil {
+		return err
+	}
+	restaurantIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "role", Value: 1}, {Key: "cuisine", Value: 1}}},
+		// Users without a location are left out of 2dsphere indexes.
+		{Keys: bson.D{{Key: "geo", Value: "2dsphere"}}},
+	}
+	if _, err := s.users.Indexes().CreateMany(ctx, restaurantIndexes); err != nil {
+		return err
+	}
+	// Breadcrumbs expire on their own once they are no longer useful.
+	locationIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "order_id", Value: 1}, {Key: "recorded_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "recorded_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(LocationTrailTTL.Seconds())),
+		},
+	}
+	if _, err := s.locations.Indexes().CreateMany(ctx, locationIndexes); err != nil {
+		return err
+	}
+	categoryIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := s.categories.Indexes().CreateOne(ctx, categoryIndex); err != nil {
+		return err
+	}
+	addressIndex := mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}}}
+	if _, err := s.addresses.Indexes().CreateOne(ctx, addressIndex); err != nil {
+		return err
+	}
+	return nil
+}
 
-	return &Store{
-		client:    client,
-		db:        db,
-		users:     db.Collection("users"),
-		orders:    db.Collection("orders"),
-		menuItems: db.Collection("menu_items"),
-	}, nil
+// Ping checks that MongoDB is reachable.
+func (s *Store) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return s.client.Ping(ctx, nil)
 }
 
 // Disconnect closes the MongoDB connection.
 func (s *Store) Disconnect() {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
 	defer cancel()
 	s.client.Disconnect(ctx)
 }
 
+// WithTransaction runs fn in a transaction, committing if it returns nil
+// and aborting otherwise. Store calls made with the ctx passed to fn take
+// part in the transaction. fn is run again if the transaction hits a
+// transient error such as a write conflict, so it must not have side
+// effects outside the store.
+//
+// When the deployment cannot run transactions (see SupportsTransactions),
+// fn runs once without one and writes it made before failing are kept.
+func (s *Store) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !s.transactions {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, transactionTimeout)
+	defer cancel()
+	session, err := s.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.WithoutCancel(ctx))
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// SupportsTransactions reports whether WithTransaction rolls back failed
+// writes. Callers undo partial writes themselves when it does not.
+func (s *Store) SupportsTransactions() bool {
+	return s.transactions
+}
+
 // ==================== USER OPERATIONS ====================
 
 // SaveUser inserts or replaces a user document.
-func (s *Store) SaveUser(user *models.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *Store) SaveUser(ctx context.Context, user *models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 	opts := options.Replace().SetUpsert(true)
 	_, err := s.users.ReplaceOne(ctx, bson.M{"_id": user.ID}, user, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateEmail
+	}
 	return err
 }
 
 // GetUser retrieves a user by ID.
-func (s *Store) GetUser(id string) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *Store) GetUser(ctx context.Context, id string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 	var user models.User
 	err := s.users.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
@@ -80,8 +273,8 @@ func (s *Store) GetUser(id string) (*models.User, error) {
 }
 
 // ListUsers returns all users, optionally filtered by role.
-func (s *Store) ListUsers(roleFilter models.Role) ([]*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *Store) ListUsers(ctx context.Context, roleFilter models.Role) ([]*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 	filter := bson.M{}
 	if roleFilter != "" {
@@ -102,11 +295,231 @@ func (s *Store) ListUsers(roleFilter models.Role) ([]*models.User, error) {
 	return users, nil
 }
 
+// ListAvailableDrivers returns the drivers who are currently available.
+func (s *Store) ListAvailableDrivers(ctx context.Context) ([]*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	cursor, err := s.users.Find(ctx, bson.M{"role": models.RoleDriver, "available": true})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var drivers []*models.User
+	if err := cursor.All(ctx, &drivers); err != nil {
+		return nil, err
+	}
+	if drivers == nil {
+		drivers = []*models.User{}
+	}
+	return drivers, nil
+}
+
+// SetDriverAvailability records whether a driver is available and when
+// they were last seen.
+func (s *Store) SetDriverAvailability(ctx context.Context, driverID string, available bool, seen time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{"_id": driverID, "role": models.RoleDriver}
+	update := bson.M{"$set": bson.M{"available": available, "last_seen": seen}}
+	res, err := s.users.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("driver not found: %s", driverID)
+	}
+	return nil
+}
+
+// MarkIdleDriversUnavailable marks every available driver not seen since
+// before as unavailable and returns how many were changed.
+func (s *Store) MarkIdleDriversUnavailable(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{
+		"role":      models.RoleDriver,
+		"available": true,
+		// Also matches drivers with no last_seen, such as seeded ones.
+		"last_seen": bson.M{"$not": bson.M{"$gte": before}},
+	}
+	res, err := s.users.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"available": false}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// RestaurantFilter holds optional criteria for listing restaurants.
+type RestaurantFilter struct {
+	// Cuisine matches exactly; cuisines are stored lowercase.
+	Cuisine string
+	// Query matches the restaurant name, case-insensitively.
+	Query string
+	// Offset and Limit select a page of results; zero Limit means all.
+	Offset int64
+	Limit  int64
+}
+
+// ListRestaurants returns restaurant users matching the filter, ordered by name.
+func (s *Store) ListRestaurants(ctx context.Context, f RestaurantFilter) ([]*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{"role": models.RoleRestaurant}
+	if f.Cuisine != "" {
+		filter["cuisine"] = f.Cuisine
+	}
+	if f.Query != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(f.Query), "$options": "i"}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(f.Offset)
+	if f.Limit > 0 {
+		opts.SetLimit(f.Limit)
+	}
+	cursor, err := s.users.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var users []*models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	if users == nil {
+		users = []*models.User{}
+	}
+	return users, nil
+}
+
+// NearbyRestaurant is a restaurant found by a nearby search.
+type NearbyRestaurant struct {
+	models.User `bson:",inline"`
+	// DistanceMeters is the distance from the search point.
+	DistanceMeters float64 `bson:"distance_m"`
+}
+
+// ListNearbyRestaurants returns restaurants within radiusMeters of lat, lng,
+// nearest first. Restaurants without a location are never included.
+func (s *Store) ListNearbyRestaurants(ctx context.Context, lat, lng, radiusMeters float64, offset, limit int64) ([]*NearbyRestaurant, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	pipeline := mongo.Pipeline{
+		{{Key: "$geoNear", Value: bson.M{
+			"near":          models.NewGeoPoint(lat, lng),
+			"key":           "geo",
+			"distanceField": "distance_m",
+			"maxDistance":   radiusMeters,
+			"spherical":     true,
+			"query":         bson.M{"role": models.RoleRestaurant},
+		}}},
+		{{Key: "$skip", Value: offset}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	cursor, err := s.users.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var restaurants []*NearbyRestaurant
+	if err := cursor.All(ctx, &restaurants); err != nil {
+		return nil, err
+	}
+	if restaurants == nil {
+		restaurants = []*NearbyRestaurant{}
+	}
+	return restaurants, nil
+}
+
+// DeleteUser removes a user and their saved addresses. Orders and menu
+// items that reference the user are kept for the record.
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	if _, err := s.users.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return err
+	}
+	_, err := s.addresses.DeleteMany(ctx, bson.M{"user_id": id})
+	return err
+}
+
+// ==================== ADDRESS OPERATIONS ====================
+
+// SaveAddress inserts or replaces a saved address.
+func (s *Store) SaveAddress(ctx context.Context, addr *models.SavedAddress) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	opts := options.Replace().SetUpsert(true)
+	_, err := s.addresses.ReplaceOne(ctx, bson.M{"_id": addr.ID}, addr, opts)
+	return err
+}
+
+// GetAddress retrieves a saved address by ID.
+func (s *Store) GetAddress(ctx context.Context, id string) (*models.SavedAddress, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	var addr models.SavedAddress
+	err := s.addresses.FindOne(ctx, bson.M{"_id": id}).Decode(&addr)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("address not found: %s", id)
+	}
+	return &addr, err
+}
+
+// ListAddresses returns a user's saved addresses, oldest first.
+func (s *Store) ListAddresses(ctx context.Context, userID string) ([]*models.SavedAddress, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := s.addresses.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var addrs []*models.SavedAddress
+	if err := cursor.All(ctx, &addrs); err != nil {
+		return nil, err
+	}
+	if addrs == nil {
+		addrs = []*models.SavedAddress{}
+	}
+	return addrs, nil
+}
+
+// DeleteAddress removes a saved address.
+func (s *Store) DeleteAddress(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	_, err := s.addresses.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// Sort orders list results by one field. Ties are broken by ID, in the
+// same direction, so the order is stable across pages.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// sortBSON returns the sort document for s, or for def if s is empty.
+func sortBSON(s, def Sort) bson.D {
+	if s.Field == "" {
+		s = def
+	}
+	dir := 1
+	if s.Desc {
+		dir = -1
+	}
+	return bson.D{{Key: s.Field, Value: dir}, {Key: "_id", Value: dir}}
+}
+
 // ==================== ORDER OPERATIONS ====================
 
 // SaveOrder inserts or replaces an order document.
-func (s *Store) SaveOrder(order *models.Order) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *Store) SaveOrder(ctx context.Context, order *models.Order) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 	opts := options.Replace().SetUpsert(true)
 	_, err := s.orders.ReplaceOne(ctx, bson.M{"_id": order.ID}, order, opts)
@@ -114,25 +527,203 @@ func (s *Store) SaveOrder(order *models.Order) error {
 }
 
 // GetOrder retrieves an order by ID.
-func (s *Store) GetOrder(id string) (*models.Order, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *Store) GetOrder(ctx context.Context, id string) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 	var order models.Order
 	err := s.orders.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
 	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("order not found: %s", id)
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, id)
 	}
 	return &order, err
 }
 
-// ListOrders returns all orders, optionally filtered by status.
-func (s *Store) ListOrders(statusFilter models.OrderStatus) ([]*models.Order, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// GetOrderSnapshot retrieves only an order's as-ordered lines and the
+// parties to it.
+func (s *Store) GetOrderSnapshot(ctx context.Context, id string) (*models.OrderSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
-	filter := bson.M{}
-	if statusFilter != "" {
-		filter["status"] = statusFilter
+	projection := bson.M{"order_number": 1, "customer_id": 1, "restaurant_id": 1, "driver_id": 1, "items": 1, "created_at": 1}
+	var snapshot models.OrderSnapshot
+	err := s.orders.FindOne(ctx, bson.M{"_id": id}, options.FindOne().SetProjection(projection)).Decode(&snapshot)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: %s", ErrOrderNotFound, id)
+	}
+	return &snapshot, err
+}
+
+// GetOrderBriefs retrieves the orders with the given IDs in one query,
+// loading only the fields of models.OrderBrief. Missing IDs are skipped.
+func (s *Store) GetOrderBriefs(ctx context.Context, ids []string) ([]*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	projection := bson.M{
+		"order_number": 1, "status": 1, "customer_id": 1, "restaurant_id": 1, "driver_id": 1,
+		"estimated_delivery_at": 1, "updated_at": 1,
+	}
+	cursor, err := s.orders.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var orders []*models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	if orders == nil {
+		orders = []*models.Order{}
+	}
+	return orders, nil
+}
+
+// OrderFilter holds optional criteria for listing orders. Empty fields are
+// ignored; set fields are combined with AND.
+type OrderFilter struct {
+	Status       models.OrderStatus
+	CustomerID   string
+	RestaurantID string
+	DriverID     string
+	// CreatedAfter (inclusive) and CreatedBefore (exclusive) bound created_at.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Item matches orders with a line whose name contains it, ignoring case.
+	Item string
+
+	// ScopeRole and ScopeUserID restrict results to the orders that user
+	// may see. They are applied on top of the other criteria.
+	ScopeRole   models.Role
+	ScopeUserID string
+
+	// Sort defaults to newest first.
+	Sort Sort
+}
+
+// orderFilterBSON builds the MongoDB query for an OrderFilter.
+func orderFilterBSON(f OrderFilter) bson.M {
+	var conds []bson.M
+	if f.Status != "" {
+		conds = append(conds, bson.M{"status": f.Status})
+	}
+	if f.CustomerID != "" {
+		conds = append(conds, bson.M{"customer_id": f.CustomerID})
+	}
+	if f.RestaurantID != "" {
+		conds = append(conds, bson.M{"restaurant_id": f.RestaurantID})
+	}
+	if f.DriverID != "" {
+		conds = append(conds, bson.M{"driver_id": f.DriverID})
+	}
+	if !f.CreatedAfter.IsZero() || !f.CreatedBefore.IsZero() {
+		created := bson.M{}
+		if !f.CreatedAfter.IsZero() {
+			created["$gte"] = f.CreatedAfter
+		}
+		if !f.CreatedBefore.IsZero() {
+			created["$lt"] = f.CreatedBefore
+		}
+		conds = append(conds, bson.M{"created_at": created})
+	}
+	if f.Item != "" {
+		// An unanchored regex cannot use an index, so it only scans the
+		// orders left by the other (indexed) conditions. A $text index
+		// would be faster but matches whole words only.
+		conds = append(conds, bson.M{"items.name": bson.M{"$regex": regexp.QuoteMeta(f.Item), "$options": "i"}})
+	}
+
+	// Admins, like unscoped internal callers, see every order.
+	switch f.ScopeRole {
+	case models.RoleCustomer:
+		conds = append(conds, bson.M{"customer_id": f.ScopeUserID})
+	case models.RoleRestaurant:
+		conds = append(conds, bson.M{"restaurant_id": f.ScopeUserID})
+	case models.RoleDriver:
+		// Drivers see their own deliveries plus anything awaiting pickup.
+		conds = append(conds, bson.M{"$or": bson.A{
+			bson.M{"driver_id": f.ScopeUserID},
+			bson.M{"status": models.StatusReadyForPickup},
+		}})
 	}
+
+	switch len(conds) {
+	case 0:
+		return bson.M{}
+	case 1:
+		return conds[0]
+	default:
+		return bson.M{"$and": conds}
+	}
+}
+
+// ListOrders returns all orders matching the filter, in its sort order.
+func (s *Store) ListOrders(ctx context.Context, f OrderFilter) ([]*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	opts := options.Find().SetSort(sortBSON(f.Sort, Sort{Field: "created_at", Desc: true}))
+	cursor, err := s.orders.Find(ctx, orderFilterBSON(f), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var orders []*models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	if orders == nil {
+		orders = []*models.Order{}
+	}
+	return orders, nil
+}
+
+// ClaimOrder assigns a driver to a READY_FOR_PICKUP order that has no driver
+// yet. The check and the write happen in a single conditional update, so
+// when several drivers race only one wins. It reports whether the claim
+// succeeded. The claim is recorded in the order's audit trail.
+func (s *Store) ClaimOrder(ctx context.Context, orderID, driverID string, audit models.AuditEntry) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{
+		"_id":       orderID,
+		"status":    models.StatusReadyForPickup,
+		"driver_id": bson.M{"$in": bson.A{nil, ""}},
+	}
+	update := bson.M{
+		"$set":  bson.M{"driver_id": driverID, "updated_at": time.Now()},
+		"$push": bson.M{"audit": audit},
+	}
+	res, err := s.orders.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// ListStaleOrders returns orders in the given status that have not been
+// updated since before.
+func (s *Store) ListStaleOrders(ctx context.Context, status models.OrderStatus, before time.Time) ([]*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{"status": status, "updated_at": bson.M{"$lt": before}}
+	cursor, err := s.orders.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var orders []*models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	if orders == nil {
+		orders = []*models.Order{}
+	}
+	return orders, nil
+}
+
+// ListDueScheduledOrders returns SCHEDULED orders whose scheduled time is
+// at or before now.
+func (s *Store) ListDueScheduledOrders(ctx context.Context, now time.Time) ([]*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{"status": models.StatusScheduled, "scheduled_for": bson.M{"$lte": now}}
 	cursor, err := s.orders.Find(ctx, filter)
 	if err != nil {
 		return nil, err
@@ -148,20 +739,444 @@ func (s *Store) ListOrders(statusFilter models.OrderStatus) ([]*models.Order, er
 	return orders, nil
 }
 
+// ReplaceOrderIfStatus saves the order only if it is still in the expected
+// status, so a background change cannot overwrite a concurrent update. It
+// reports whether the order was saved.
+func (s *Store) ReplaceOrderIfStatus(ctx context.Context, order *models.Order, expected models.OrderStatus) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	res, err := s.orders.ReplaceOne(ctx, bson.M{"_id": order.ID, "status": expected}, order)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// SetOrderTip changes a DELIVERED order's tip and price breakdown and
+// records the change in the audit trail. Only those fields are written, so
+// a rating stored concurrently is kept. It reports whether the order was
+// updated.
+func (s *Store) SetOrderTip(ctx context.Context, orderID string, tip float64, breakdown *models.PriceBreakdown, audit models.AuditEntry) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	set := bson.M{"tip": tip, "updated_at": audit.Timestamp}
+	if breakdown != nil {
+		set["price_breakdown"] = breakdown
+	}
+	filter := bson.M{"_id": orderID, "status": models.StatusDelivered}
+	update := bson.M{
+		"$set":  set,
+		"$push": bson.M{"audit": audit},
+	}
+	res, err := s.orders.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// SetItemPrepStatus sets the prep status of the order's lines for a menu
+// item and records the change in the audit trail, only while the order is
+// PREPARING. Only those lines are written and items_ready is worked out
+// from the stored lines, so concurrent updates to other lines are kept. It
+// reports whether the order was updated.
+func (s *Store) SetItemPrepStatus(ctx context.Context, orderID, menuItemID string, status models.PrepStatus, audit models.AuditEntry) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{"_id": orderID, "status": models.StatusPreparing}
+	isLine := bson.M{"$eq": bson.A{"$$line.menu_item_id", bson.M{"$literal": menuItemID}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"items": bson.M{"$map": bson.M{"input": "$items", "as": "line", "in": bson.M{"$cond": bson.A{
+				isLine,
+				bson.M{"$mergeObjects": bson.A{"$$line", bson.M{"prep_status": status}}},
+				"$$line",
+			}}}},
+			"audit":      bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$audit", bson.A{}}}, bson.A{bson.M{"$literal": audit}}}},
+			"updated_at": audit.Timestamp,
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"items_ready": bson.M{"$and": bson.A{
+				bson.M{"$gt": bson.A{bson.M{"$size": "$items"}, 0}},
+				bson.M{"$allElementsTrue": bson.A{bson.M{"$map": bson.M{"input": "$items", "as": "line", "in": bson.M{"$eq": bson.A{"$$line.prep_status", models.PrepReady}}}}}},
+			}},
+		}}},
+	}
+	res, err := s.orders.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// RateOrder attaches a rating to a DELIVERED order that has not been rated
+// yet, and records it in the order's audit trail. It reports whether the
+// rating was stored.
+func (s *Store) RateOrder(ctx context.Context, orderID string, rating *models.OrderRating, audit models.AuditEntry) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{
+		"_id":    orderID,
+		"status": models.StatusDelivered,
+		"rating": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set":  bson.M{"rating": rating},
+		"$push": bson.M{"audit": audit},
+	}
+	res, err := s.orders.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// RestaurantRating averages the star ratings across a restaurant's orders.
+func (s *Store) RestaurantRating(ctx context.Context, restaurantID string) (float64, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"restaurant_id": restaurantID, "rating": bson.M{"$exists": true}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     nil,
+			"average": bson.M{"$avg": "$rating.stars"},
+			"count":   bson.M{"$sum": 1},
+		}}},
+	}
+	cursor, err := s.orders.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cursor.Close(ctx)
+	var result struct {
+		Average float64 `bson:"average"`
+		Count   int     `bson:"count"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, 0, err
+		}
+	}
+	return result.Average, result.Count, cursor.Err()
+}
+
+// CountOrdersByStatus counts the orders matching the filter, grouped by status.
+func (s *Store) CountOrdersByStatus(ctx context.Context, f OrderFilter) (map[models.OrderStatus]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: orderFilterBSON(f)}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := s.orders.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var results []struct {
+		Status models.OrderStatus `bson:"_id"`
+		Count  int                `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	counts := make(map[models.OrderStatus]int, len(results))
+	for _, r := range results {
+		counts[r.Status] = r.Count
+	}
+	return counts, nil
+}
+
+// PopularMenuItems ranks the menu items sold in orders matching the filter
+// by total quantity, returning at most limit items. Cancelled and rejected
+// orders are not sales and are left out.
+func (s *Store) PopularMenuItems(ctx context.Context, f OrderFilter, limit int64) ([]models.PopularItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	match := bson.M{"$and": bson.A{
+		orderFilterBSON(f),
+		bson.M{"status": bson.M{"$nin": bson.A{models.StatusCancelled, models.StatusRejected}}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: "$items"}},
+		// An item may appear on several lines of one order; count the order once.
+		{{Key: "$group", Value: bson.M{
+			"_id":        bson.M{"order": "$_id", "item": "$items.menu_item_id"},
+			"name":       bson.M{"$first": "$items.name"},
+			"quantity":   bson.M{"$sum": "$items.quantity"},
+			"created_at": bson.M{"$first": "$created_at"},
+		}}},
+		// Newest first, so $first below picks each item's current name.
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":         "$_id.item",
+			"name":        bson.M{"$first": "$name"},
+			"quantity":    bson.M{"$sum": "$quantity"},
+			"order_count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "quantity", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+	cursor, err := s.orders.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var items []models.PopularItem
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []models.PopularItem{}
+	}
+	return items, nil
+}
+
+// UpdateDriverLocation records the driver's latest position on an order
+// and appends it to the order's breadcrumb trail. The update only applies
+// while the order is assigned to the driver and in transit; it reports
+// false otherwise.
+func (s *Store) UpdateDriverLocation(ctx context.Context, orderID, driverID string, loc models.DriverLocation) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{
+		"_id":       orderID,
+		"driver_id": driverID,
+		"status":    bson.M{"$in": bson.A{models.StatusPickedUp, models.StatusOutForDelivery}},
+	}
+	res, err := s.orders.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"driver_location": loc}})
+	if err != nil || res.MatchedCount == 0 {
+		return false, err
+	}
+	ping := models.LocationPing{OrderID: orderID, DriverID: driverID, DriverLocation: loc}
+	if _, err := s.locations.InsertOne(ctx, ping); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// ListLocationTrail returns an order's driver breadcrumbs, oldest first.
+func (s *Store) ListLocationTrail(ctx context.Context, orderID string) ([]models.DriverLocation, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "recorded_at", Value: 1}})
+	cursor, err := s.locations.Find(ctx, bson.M{"order_id": orderID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var trail []models.DriverLocation
+	if err := cursor.All(ctx, &trail); err != nil {
+		return nil, err
+	}
+	if trail == nil {
+		trail = []models.DriverLocation{}
+	}
+	return trail, nil
+}
+
+// ListDeliveredOrders returns a restaurant's most recently delivered orders,
+// newest first, capped at limit.
+func (s *Store) ListDeliveredOrders(ctx context.Context, restaurantID string, limit int64) ([]*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{"restaurant_id": restaurantID, "status": models.StatusDelivered}
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}).SetLimit(limit)
+	cursor, err := s.orders.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var orders []*models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	if orders == nil {
+		orders = []*models.Order{}
+	}
+	return orders, nil
+}
+
+// ListKitchenQueue returns the restaurant's CONFIRMED and PREPARING orders,
+// the ones its kitchen still has to cook.
+func (s *Store) ListKitchenQueue(ctx context.Context, restaurantID string) ([]*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{
+		"restaurant_id": restaurantID,
+		"status":        bson.M{"$in": bson.A{models.StatusConfirmed, models.StatusPreparing}},
+	}
+	cursor, err := s.orders.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var orders []*models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	if orders == nil {
+		orders = []*models.Order{}
+	}
+	return orders, nil
+}
+
+// ListDriverQueue returns unclaimed READY_FOR_PICKUP orders together with the
+// driver's own orders that are still in progress.
+func (s *Store) ListDriverQueue(ctx context.Context, driverID string) ([]*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{"$or": bson.A{
+		bson.M{
+			"status":    models.StatusReadyForPickup,
+			"driver_id": bson.M{"$in": bson.A{nil, ""}},
+		},
+		bson.M{
+			"driver_id": driverID,
+			"status": bson.M{"$in": bson.A{
+				models.StatusReadyForPickup,
+				models.StatusPickedUp,
+				models.StatusOutForDelivery,
+			}},
+		},
+	}}
+	cursor, err := s.orders.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var orders []*models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	if orders == nil {
+		orders = []*models.Order{}
+	}
+	return orders, nil
+}
+
+// NextOrderSequence atomically increments and returns the order sequence
+// for a restaurant. The counter document is created on first use.
+func (s *Store) NextOrderSequence(ctx context.Context, restaurantID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := s.counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": "order_seq:" + restaurantID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		opts,
+	).Decode(&counter)
+	return counter.Seq, err
+}
+
+// ==================== COUPON OPERATIONS ====================
+
+// SaveCoupon inserts a new coupon. It returns ErrDuplicateCoupon if the
+// code is already taken.
+func (s *Store) SaveCoupon(ctx context.Context, coupon *models.Coupon) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	_, err := s.coupons.InsertOne(ctx, coupon)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateCoupon
+	}
+	return err
+}
+
+// GetCoupon retrieves a coupon by code.
+func (s *Store) GetCoupon(ctx context.Context, code string) (*models.Coupon, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	var coupon models.Coupon
+	err := s.coupons.FindOne(ctx, bson.M{"_id": code}).Decode(&coupon)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("coupon not found: %s", code)
+	}
+	return &coupon, err
+}
+
+// RedeemCoupon records one use of a coupon if it is still under its usage
+// limit. The check and increment are a single update, so concurrent
+// redemptions cannot exceed the limit. It reports whether a use was recorded.
+func (s *Store) RedeemCoupon(ctx context.Context, code string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{
+		"_id": code,
+		"$or": bson.A{
+			bson.M{"max_uses": 0},
+			bson.M{"$expr": bson.M{"$lt": bson.A{"$uses", "$max_uses"}}},
+		},
+	}
+	res, err := s.coupons.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"uses": 1}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// ReleaseCoupon gives back a use recorded by RedeemCoupon, for when the
+// order could not be saved.
+func (s *Store) ReleaseCoupon(ctx context.Context, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	_, err := s.coupons.UpdateOne(ctx, bson.M{"_id": code, "uses": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"uses": -1}})
+	return err
+}
+
 // ==================== MENU OPERATIONS ====================
 
-// SaveMenuItem inserts or replaces a menu item document.
-func (s *Store) SaveMenuItem(item *models.MenuItem) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// SaveMenuItem inserts or replaces a menu item document. It returns
+// ErrDuplicateMenuItem if the restaurant has another item with the same
+// name key.
+func (s *Store) SaveMenuItem(ctx context.Context, item *models.MenuItem) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 	opts := options.Replace().SetUpsert(true)
 	_, err := s.menuItems.ReplaceOne(ctx, bson.M{"_id": item.ID}, item, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateMenuItem
+	}
 	return err
 }
 
+// SaveMenuItems inserts new menu items in a single unordered batch, so one
+// failed insert does not stop the rest. failed maps the index of each item
+// that was not inserted to the reason. A non-nil err means the batch as a
+// whole failed and nothing should be assumed inserted.
+func (s *Store) SaveMenuItems(ctx context.Context, items []*models.MenuItem) (failed map[int]error, err error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	docs := make([]interface{}, len(items))
+	for i, item := range items {
+		docs[i] = item
+	}
+	_, err = s.menuItems.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil && len(bulkErr.WriteErrors) > 0 {
+		failed = make(map[int]error, len(bulkErr.WriteErrors))
+		for _, we := range bulkErr.WriteErrors {
+			if mongo.IsDuplicateKeyError(we) {
+				failed[we.Index] = ErrDuplicateMenuItem
+				continue
+			}
+			failed[we.Index] = errors.New(we.Message)
+		}
+		return failed, nil
+	}
+	return nil, err
+}
+
 // GetMenuItem retrieves a menu item by ID.
-func (s *Store) GetMenuItem(id string) (*models.MenuItem, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *Store) GetMenuItem(ctx context.Context, id string) (*models.MenuItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 	var item models.MenuItem
 	err := s.menuItems.FindOne(ctx, bson.M{"_id": id}).Decode(&item)
@@ -171,12 +1186,53 @@ func (s *Store) GetMenuItem(id string) (*models.MenuItem, error) {
 	return &item, err
 }
 
-// ListMenuItems returns all menu items for a restaurant.
-func (s *Store) ListMenuItems(restaurantID string) ([]*models.MenuItem, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// MenuFilter holds optional criteria for listing a restaurant's menu.
+// Empty fields are ignored; set fields are combined with AND.
+type MenuFilter struct {
+	RestaurantID string
+	Category     string
+	// MaxPrice is inclusive; zero means no limit.
+	MaxPrice float64
+	// AvailableOnly excludes items switched off by the restaurant. Schedule
+	// windows depend on the current time and are checked by the caller.
+	AvailableOnly bool
+	// Query matches name or description, case-insensitively.
+	Query string
+	// Sort defaults to name.
+	Sort Sort
+}
+
+// menuFilterBSON builds the MongoDB query for a MenuFilter.
+func menuFilterBSON(f MenuFilter) bson.M {
+	filter := bson.M{"restaurant_id": f.RestaurantID}
+	if f.Category != "" {
+		filter["category"] = bson.M{"$regex": "^" + regexp.QuoteMeta(f.Category) + "$", "$options": "i"}
+	}
+	if f.MaxPrice > 0 {
+		filter["price"] = bson.M{"$lte": f.MaxPrice}
+	}
+	if f.AvailableOnly {
+		filter["available"] = true
+	}
+	if f.Query != "" {
+		// A substring regex rather than a $text index so partial words
+		// ("marg" for "Margherita") still match.
+		pattern := bson.M{"$regex": regexp.QuoteMeta(f.Query), "$options": "i"}
+		filter["$or"] = bson.A{
+			bson.M{"name": pattern},
+			bson.M{"description": pattern},
+		}
+	}
+	return filter
+}
+
+// ListMenuItems returns a restaurant's menu items matching the filter, in
+// its sort order.
+func (s *Store) ListMenuItems(ctx context.Context, f MenuFilter) ([]*models.MenuItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
-	filter := bson.M{"restaurant_id": restaurantID}
-	cursor, err := s.menuItems.Find(ctx, filter)
+	opts := options.Find().SetSort(sortBSON(f.Sort, Sort{Field: "name"}))
+	cursor, err := s.menuItems.Find(ctx, menuFilterBSON(f), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -191,10 +1247,222 @@ func (s *Store) ListMenuItems(restaurantID string) ([]*models.MenuItem, error) {
 	return items, nil
 }
 
+// UpdateMenuItem replaces an existing menu item, keeping its ID. It returns
+// ErrDuplicateMenuItem if the new name is taken by another of the
+// restaurant's items.
+func (s *Store) UpdateMenuItem(ctx context.Context, item *models.MenuItem) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	res, err := s.menuItems.ReplaceOne(ctx, bson.M{"_id": item.ID}, item)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateMenuItem
+	}
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("menu item not found: %s", item.ID)
+	}
+	return nil
+}
+
+// SetMenuItemAvailability updates only the available flag of a menu item.
+func (s *Store) SetMenuItemAvailability(ctx context.Context, id string, available bool) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	res, err := s.menuItems.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"available": available}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("menu item not found: %s", id)
+	}
+	return nil
+}
+
+// MenuItemNameTaken reports whether the restaurant has a menu item other
+// than excludeID whose name matches name, ignoring case and repeated
+// spaces. Items saved before names were unique are compared by name, since
+// they have no name key.
+func (s *Store) MenuItemNameTaken(ctx context.Context, restaurantID, name, excludeID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	words := strings.Fields(name)
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	filter := bson.M{
+		"restaurant_id": restaurantID,
+		"$or": bson.A{
+			bson.M{"name_key": models.MenuItemKey(name)},
+			bson.M{
+				"name_key": bson.M{"$exists": false},
+				"name":     bson.M{"$regex": `^\s*` + strings.Join(words, `\s+`) + `\s*$`, "$options": "i"},
+			},
+		},
+	}
+	if excludeID != "" {
+		filter["_id"] = bson.M{"$ne": excludeID}
+	}
+	count, err := s.menuItems.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// MenuItemIDsOf returns which of ids are menu items of the restaurant.
+func (s *Store) MenuItemIDsOf(ctx context.Context, restaurantID string, ids []string) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{"_id": bson.M{"$in": ids}, "restaurant_id": restaurantID}
+	cursor, err := s.menuItems.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var docs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(docs))
+	for _, d := range docs {
+		found[d.ID] = true
+	}
+	return found, nil
+}
+
+// SetMenuItemsAvailability updates the available flag of the restaurant's
+// menu items among ids in a single write, and returns how many changed.
+func (s *Store) SetMenuItemsAvailability(ctx context.Context, restaurantID string, ids []string, available bool) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{"_id": bson.M{"$in": ids}, "restaurant_id": restaurantID}
+	res, err := s.menuItems.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"available": available}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
 // DeleteMenuItem removes a menu item by ID.
-func (s *Store) DeleteMenuItem(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *Store) DeleteMenuItem(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 	_, err := s.menuItems.DeleteOne(ctx, bson.M{"_id": id})
 	return err
 }
+
+// CountMenuItems returns how many menu items match the filter.
+func (s *Store) CountMenuItems(ctx context.Context, f MenuFilter) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	return s.menuItems.CountDocuments(ctx, menuFilterBSON(f))
+}
+
+// CountMenuItemsByCategory counts a restaurant's menu items per category,
+// sorted by category. Categories differing only in case are counted
+// together under the first spelling found.
+func (s *Store) CountMenuItemsByCategory(ctx context.Context, restaurantID string) ([]models.MenuCategoryCount, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"restaurant_id": restaurantID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"$toLower": "$category"},
+			"category": bson.M{"$first": "$category"},
+			"count":    bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := s.menuItems.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var results []struct {
+		Category string `bson:"category"`
+		Count    int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	counts := make([]models.MenuCategoryCount, 0, len(results))
+	for _, r := range results {
+		counts = append(counts, models.MenuCategoryCount{Category: r.Category, Count: r.Count})
+	}
+	return counts, nil
+}
+
+// ==================== MENU CATEGORY OPERATIONS ====================
+
+// SaveMenuCategory inserts a new menu category. It returns
+// ErrDuplicateCategory if the restaurant already has one with the same key.
+func (s *Store) SaveMenuCategory(ctx context.Context, c *models.MenuCategory) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	_, err := s.categories.InsertOne(ctx, c)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateCategory
+	}
+	return err
+}
+
+// EnsureMenuCategory returns the restaurant's category with c's key,
+// inserting c if there is none yet.
+func (s *Store) EnsureMenuCategory(ctx context.Context, c *models.MenuCategory) (*models.MenuCategory, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	filter := bson.M{"restaurant_id": c.RestaurantID, "key": c.Key}
+	update := bson.M{"$setOnInsert": bson.M{"_id": c.ID, "name": c.Name, "created_at": c.CreatedAt}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var existing models.MenuCategory
+	err := s.categories.FindOneAndUpdate(ctx, filter, update, opts).Decode(&existing)
+	if mongo.IsDuplicateKeyError(err) {
+		// A concurrent request inserted it first; use theirs.
+		err = s.categories.FindOne(ctx, filter).Decode(&existing)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// GetMenuCategory retrieves a menu category by ID.
+func (s *Store) GetMenuCategory(ctx context.Context, id string) (*models.MenuCategory, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	var c models.MenuCategory
+	err := s.categories.FindOne(ctx, bson.M{"_id": id}).Decode(&c)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("category not found: %s", id)
+	}
+	return &c, err
+}
+
+// ListMenuCategories returns a restaurant's menu categories by name.
+func (s *Store) ListMenuCategories(ctx context.Context, restaurantID string) ([]*models.MenuCategory, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "key", Value: 1}})
+	cursor, err := s.categories.Find(ctx, bson.M{"restaurant_id": restaurantID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var categories []*models.MenuCategory
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	if categories == nil {
+		categories = []*models.MenuCategory{}
+	}
+	return categories, nil
+}
+
+// DeleteMenuCategory removes a menu category by ID.
+func (s *Store) DeleteMenuCategory(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	_, err := s.categories.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"food-delivery-api/auth"
+	"food-delivery-api/models"
+	"food-delivery-api/statemachine"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Fixtures is the on-disk format of a seed file. Restaurants are users with
+// the restaurant role; menu items and orders reference users by ID.
+type Fixtures struct {
+	Users     []*SeedUser        `json:"users"`
+	MenuItems []*models.MenuItem `json:"menu_items"`
+	Orders    []*models.Order    `json:"orders"`
+	Coupons   []*models.Coupon   `json:"coupons"`
+}
+
+// SeedUser is a user fixture. Password is given in plain text and hashed
+// into PasswordHash by LoadFixtures; a user without one cannot log in.
+type SeedUser struct {
+	models.User
+	Password string `json:"password"`
+}
+
+// LoadFixtures reads and validates a fixtures file.
+func LoadFixtures(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed file: %w", err)
+	}
+	var f Fixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse seed file: %w", err)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	for i, u := range f.Users {
+		if u.Password == "" {
+			continue
+		}
+		hash, err := auth.HashPassword(u.Password)
+		if err != nil {
+			return nil, fmt.Errorf("users[%d]: failed to hash password: %w", i, err)
+		}
+		u.PasswordHash = hash
+	}
+	return &f, nil
+}
+
+// Validate checks every fixture against the model rules and verifies that
+// menu items and orders only reference users defined in the same file.
+func (f *Fixtures) Validate() error {
+	users := make(map[string]models.Role, len(f.Users))
+	for i, u := range f.Users {
+		if u.ID == "" || u.Name == "" {
+			return fmt.Errorf("users[%d]: id and name are required", i)
+		}
+		if !u.Role.IsValid() {
+			return fmt.Errorf("users[%d]: invalid role '%s'", i, u.Role)
+		}
+		if u.Phone != "" && !models.IsValidPhone(u.Phone) {
+			return fmt.Errorf("users[%d]: invalid phone '%s'", i, u.Phone)
+		}
+		if u.Email != "" && !models.IsValidEmail(u.Email) {
+			return fmt.Errorf("users[%d]: invalid email '%s'", i, u.Email)
+		}
+		if (u.Cuisine != "" || len(u.Tags) > 0) && u.Role != models.RoleRestaurant {
+			return fmt.Errorf("users[%d]: only restaurants have a cuisine or tags", i)
+		}
+		if u.Cuisine != strings.ToLower(u.Cuisine) {
+			return fmt.Errorf("users[%d]: cuisine '%s' must be lowercase", i, u.Cuisine)
+		}
+		if u.Role == models.RoleAdmin && u.Password == "" {
+			return fmt.Errorf("users[%d]: admins need a password", i)
+		}
+		if u.Password != "" && (len(u.Password) < auth.MinPasswordLength || len(u.Password) > auth.MaxPasswordLength) {
+			return fmt.Errorf("users[%d]: password must be %d to %d characters", i, auth.MinPasswordLength, auth.MaxPasswordLength)
+		}
+		if _, dup := users[u.ID]; dup {
+			return fmt.Errorf("users[%d]: duplicate id '%s'", i, u.ID)
+		}
+		users[u.ID] = u.Role
+	}
+
+	menuItems := make(map[string]*models.MenuItem, len(f.MenuItems))
+	names := make(map[[2]string]bool, len(f.MenuItems))
+	for i, m := range f.MenuItems {
+		if m.ID == "" || m.Name == "" {
+			return fmt.Errorf("menu_items[%d]: id and name are required", i)
+		}
+		if m.Price <= 0 {
+			return fmt.Errorf("menu_items[%d]: price must be greater than 0", i)
+		}
+		if users[m.RestaurantID] != models.RoleRestaurant {
+			return fmt.Errorf("menu_items[%d]: unknown restaurant '%s'", i, m.RestaurantID)
+		}
+		if m.Category == "" {
+			m.Category = "General"
+		}
+		m.NameKey = models.MenuItemKey(m.Name)
+		if names[[2]string{m.RestaurantID, m.NameKey}] {
+			return fmt.Errorf("menu_items[%d]: duplicate name '%s' for restaurant '%s'", i, m.Name, m.RestaurantID)
+		}
+		names[[2]string{m.RestaurantID, m.NameKey}] = true
+		menuItems[m.ID] = m
+	}
+
+	for i, o := range f.Orders {
+		if o.ID == "" {
+			return fmt.Errorf("orders[%d]: id is required", i)
+		}
+		if users[o.CustomerID] != models.RoleCustomer {
+			return fmt.Errorf("orders[%d]: unknown customer '%s'", i, o.CustomerID)
+		}
+		if users[o.RestaurantID] != models.RoleRestaurant {
+			return fmt.Errorf("orders[%d]: unknown restaurant '%s'", i, o.RestaurantID)
+		}
+		if o.DriverID != "" && users[o.DriverID] != models.RoleDriver {
+			return fmt.Errorf("orders[%d]: unknown driver '%s'", i, o.DriverID)
+		}
+		if o.Status == "" {
+			o.Status = models.StatusPlaced
+		}
+		if !statemachine.IsKnownStatus(o.Status) {
+			return fmt.Errorf("orders[%d]: invalid status '%s'", i, o.Status)
+		}
+		if len(o.Items) == 0 {
+			return fmt.Errorf("orders[%d]: at least one item is required", i)
+		}
+		method, ok := models.ParsePaymentMethod(string(o.PaymentMethod))
+		if !ok {
+			return fmt.Errorf("orders[%d]: invalid payment method '%s'", i, o.PaymentMethod)
+		}
+		o.PaymentMethod = method
+		if o.PaymentStatus == "" {
+			o.PaymentStatus = models.PaymentPending
+		}
+		if !o.PaymentStatus.IsValid() {
+			return fmt.Errorf("orders[%d]: invalid payment status '%s'", i, o.PaymentStatus)
+		}
+
+		var total float64
+		for j, item := range o.Items {
+			m, ok := menuItems[item.MenuItemID]
+			if !ok || m.RestaurantID != o.RestaurantID {
+				return fmt.Errorf("orders[%d].items[%d]: unknown menu item '%s'", i, j, item.MenuItemID)
+			}
+			if item.Quantity <= 0 {
+				return fmt.Errorf("orders[%d].items[%d]: quantity must be at least 1", i, j)
+			}
+			o.Items[j].Name = m.Name
+			o.Items[j].Price = m.Price
+			total += m.Price * float64(item.Quantity)
+		}
+		o.SetSubtotal(total)
+
+		now := time.Now()
+		if o.CreatedAt.IsZero() {
+			o.CreatedAt = now
+		}
+		if o.UpdatedAt.IsZero() {
+			o.UpdatedAt = o.CreatedAt
+		}
+		if len(o.StatusHistory) == 0 {
+			o.StatusHistory = []models.StatusChange{{
+				ToStatus:  o.Status,
+				ChangedBy: o.CustomerID,
+				Role:      models.RoleCustomer,
+				Timestamp: o.CreatedAt,
+			}}
+		}
+	}
+
+	codes := make(map[string]bool, len(f.Coupons))
+	for i, c := range f.Coupons {
+		c.Code = models.NormalizeCouponCode(c.Code)
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("coupons[%d]: %v", i, err)
+		}
+		if codes[c.Code] {
+			return fmt.Errorf("coupons[%d]: duplicate code '%s'", i, c.Code)
+		}
+		codes[c.Code] = true
+	}
+	return nil
+}
+
+// Seed inserts the fixtures into any collection that is currently empty.
+// Collections that already hold data are left untouched.
+func (s *Store) Seed(ctx context.Context, f *Fixtures) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	users := make([]interface{}, len(f.Users))
+	for i, u := range f.Users {
+		users[i] = &u.User
+	}
+	menuItems := make([]interface{}, len(f.MenuItems))
+	for i, m := range f.MenuItems {
+		menuItems[i] = m
+	}
+	orders := make([]interface{}, len(f.Orders))
+	for i, o := range f.Orders {
+		orders[i] = o
+	}
+
+	coupons := make([]interface{}, len(f.Coupons))
+	for i, c := range f.Coupons {
+		coupons[i] = c
+	}
+
+	for _, c := range []struct {
+		name string
+		coll *mongo.Collection
+		docs []interface{}
+	}{
+		{"users", s.users, users},
+		{"menu_items", s.menuItems, menuItems},
+		{"orders", s.orders, orders},
+		{"coupons", s.coupons, coupons},
+	} {
+		n, err := seedCollection(ctx, c.coll, c.docs)
+		if err != nil {
+			return fmt.Errorf("failed to seed %s: %w", c.name, err)
+		}
+		if n < 0 {
+			log.Printf("🌱 Seed: %s already has data, skipped", c.name)
+			continue
+		}
+		log.Printf("🌱 Seed: inserted %d %s", n, c.name)
+	}
+	return nil
+}
+
+// seedCollection inserts docs if the collection is empty. It returns the
+// number of inserted documents, or -1 if the collection was not empty.
+func seedCollection(ctx context.Context, coll *mongo.Collection, docs []interface{}) (int, error) {
+	count, err := coll.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return -1, nil
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	if _, err := coll.InsertMany(ctx, docs); err != nil {
+		return 0, err
+	}
+	return len(docs), nil
+}
@@ -0,0 +1,198 @@
+package eta
+
+import (
+	"food-delivery-api/models"
+	"time"
+)
+
+// Confidence describes how reliable an estimate is.
+type Confidence string
+
+const (
+	ConfidenceHigh   Confidence = "high"
+	ConfidenceMedium Confidence = "medium"
+	ConfidenceLow    Confidence = "low"
+)
+
+// minSamplesForHigh is the number of historical orders needed before an
+// estimate built from restaurant metrics is considered highly reliable.
+const minSamplesForHigh = 10
+
+// deliveryPath is the happy-path sequence of non-terminal statuses an order
+// passes through on its way to DELIVERED.
+var deliveryPath = []models.OrderStatus{
+	models.StatusPlaced,
+	models.StatusConfirmed,
+	models.StatusPreparing,
+	models.StatusReadyForPickup,
+	models.StatusPickedUp,
+	models.StatusOutForDelivery,
+}
+
+// StageDurations maps each status to the typical time an order spends in it.
+type StageDurations map[models.OrderStatus]time.Duration
+
+// DefaultStageDurations are used when a restaurant has no delivery history.
+var DefaultStageDurations = StageDurations{
+	models.StatusPlaced:         5 * time.Minute,
+	models.StatusConfirmed:      5 * time.Minute,
+	models.StatusPreparing:      15 * time.Minute,
+	models.StatusReadyForPickup: 5 * time.Minute,
+	models.StatusPickedUp:       5 * time.Minute,
+	models.StatusOutForDelivery: 20 * time.Minute,
+}
+
+// Estimate is the best current delivery estimate for an order.
+type Estimate struct {
+	Status              models.OrderStatus `json:"status"`
+	EstimatedDeliveryAt time.Time          `json:"estimated_delivery_at"`
+	MinutesRemaining    int                `json:"minutes_remaining"`
+	Confidence          Confidence         `json:"confidence"`
+	SampleSize          int                `json:"sample_size"`
+}
+
+// AverageStageDurations computes the mean time spent in each stage across
+// the given orders' status histories, falling back to the defaults for any
+// stage without data. It also returns the number of orders that contributed.
+func AverageStageDurations(orders []*models.Order) (StageDurations, int) {
+	totals := make(map[models.OrderStatus]time.Duration)
+	counts := make(map[models.OrderStatus]int)
+	samples := 0
+	for _, order := range orders {
+		history := order.StatusHistory
+		if len(history) < 2 {
+			continue
+		}
+		samples++
+		for i := 0; i+1 < len(history); i++ {
+			stage := history[i].ToStatus
+			spent := history[i+1].Timestamp.Sub(history[i].Timestamp)
+			if spent < 0 {
+				continue
+			}
+			totals[stage] += spent
+			counts[stage]++
+		}
+	}
+
+	durations := make(StageDurations, len(DefaultStageDurations))
+	for stage, def := range DefaultStageDurations {
+		if counts[stage] > 0 {
+			durations[stage] = totals[stage] / time.Duration(counts[stage])
+		} else {
+			durations[stage] = def
+		}
+	}
+	return durations, samples
+}
+
+// Calculate recomputes the delivery estimate for an order at time now from
+// the time already spent in its current stage and the typical durations of
+// the stages still ahead, plus any delays reported during the current
+// stage. It never mutates the order.
+func Calculate(order *models.Order, durations StageDurations, samples int, now time.Time) Estimate {
+	est := Estimate{Status: order.Status, SampleSize: samples}
+
+	if order.Status == models.StatusDelivered {
+		est.EstimatedDeliveryAt = enteredAt(order, models.StatusDelivered)
+		est.Confidence = ConfidenceHigh
+		return est
+	}
+
+	stageIdx := -1
+	for i, s := range deliveryPath {
+		if s == order.Status {
+			stageIdx = i
+			break
+		}
+	}
+	if stageIdx < 0 {
+		// Not on the delivery path (e.g. cancelled or rejected) — nothing
+		// to estimate.
+		est.Confidence = ConfidenceLow
+		return est
+	}
+
+	entered := enteredAt(order, order.Status)
+	elapsed := now.Sub(entered)
+	remaining := durations[order.Status] - elapsed
+	overrun := remaining < 0
+	if overrun {
+		remaining = 0
+	}
+	for _, s := range deliveryPath[stageIdx+1:] {
+		remaining += durations[s]
+	}
+	for _, d := range order.Delays {
+		if d.ReportedAt.After(entered) {
+			remaining += time.Duration(d.Minutes) * time.Minute
+		}
+	}
+
+	est.EstimatedDeliveryAt = now.Add(remaining)
+	est.MinutesRemaining = MinutesUntil(est.EstimatedDeliveryAt, now)
+
+	switch {
+	case samples == 0 || overrun:
+		est.Confidence = ConfidenceLow
+	case samples >= minSamplesForHigh:
+		est.Confidence = ConfidenceHigh
+	default:
+		est.Confidence = ConfidenceMedium
+	}
+	return est
+}
+
+// enteredAt returns when the order most recently entered the given status,
+// falling back to its creation time.
+func enteredAt(order *models.Order, status models.OrderStatus) time.Time {
+	for i := len(order.StatusHistory) - 1; i >= 0; i-- {
+		if order.StatusHistory[i].ToStatus == status {
+			return order.StatusHistory[i].Timestamp
+		}
+	}
+	return order.CreatedAt
+}
+
+// Settings configures the promised delivery time stored on orders.
+type Settings struct {
+	// BasePrep is added to every order on top of the restaurant's own estimate.
+	BasePrep time.Duration
+	// Delivery is the expected travel time from pickup to the customer.
+	Delivery time.Duration
+}
+
+// DefaultSettings are used unless overridden by configuration.
+var DefaultSettings = Settings{
+	BasePrep: 10 * time.Minute,
+	Delivery: 20 * time.Minute,
+}
+
+// AtCreation returns the promised delivery time for an order placed at
+// createdAt, given the restaurant's own preparation estimate.
+func (s Settings) AtCreation(createdAt time.Time, restaurantPrep time.Duration) time.Time {
+	return createdAt.Add(s.BasePrep + restaurantPrep + s.Delivery)
+}
+
+// AtConfirmation returns the promised delivery time for an order the
+// restaurant accepted at confirmedAt, given its preparation estimate for
+// this order. BasePrep no longer applies: the wait for acceptance is over.
+func (s Settings) AtConfirmation(confirmedAt time.Time, prep time.Duration) time.Time {
+	return confirmedAt.Add(prep + s.Delivery)
+}
+
+// AtDispatch returns the promised delivery time for an order that left for
+// delivery at dispatchedAt.
+func (s Settings) AtDispatch(dispatchedAt time.Time) time.Time {
+	return dispatchedAt.Add(s.Delivery)
+}
+
+// MinutesUntil returns the whole minutes from now until t, rounded up and
+// never negative.
+func MinutesUntil(t, now time.Time) int {
+	remaining := t.Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	return int((remaining + time.Minute - 1) / time.Minute)
+}
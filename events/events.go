@@ -0,0 +1,133 @@
+package events
+
+import (
+	"food-delivery-api/models"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is dropped.
+const subscriberBuffer = 16
+
+// Event is one update to an order: either a status change or a reported
+// delay. Exactly one field is set.
+type Event struct {
+	Change *models.StatusChange
+	Delay  *models.OrderDelay
+}
+
+// Timestamp returns when the update happened.
+func (e Event) Timestamp() time.Time {
+	if e.Delay != nil {
+		return e.Delay.ReportedAt
+	}
+	return e.Change.Timestamp
+}
+
+// Bus fans order updates out to subscribers in the same process.
+// Publishing never blocks: a subscriber that stops draining its channel is
+// dropped and its channel closed, so it can reconnect and resync. A nil Bus
+// discards everything published to it.
+type Bus struct {
+	mu     sync.Mutex
+	subs   map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBus creates an empty Bus.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscription receives the updates of one order on C until it is closed,
+// either by the subscriber or by the bus.
+type Subscription struct {
+	C       <-chan Event
+	ch      chan Event
+	bus     *Bus
+	orderID string
+}
+
+// Subscribe registers for updates to the given order. Callers must
+// Close the subscription when done. Subscribing to a closed bus returns an
+// already-closed subscription.
+func (b *Bus) Subscribe(orderID string) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, bus: b, orderID: orderID}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return sub
+	}
+	if b.subs[orderID] == nil {
+		b.subs[orderID] = make(map[*Subscription]struct{})
+	}
+	b.subs[orderID][sub] = struct{}{}
+	return sub
+}
+
+// Publish delivers a status change to every subscriber of the order.
+func (b *Bus) Publish(orderID string, change models.StatusChange) {
+	b.publish(orderID, Event{Change: &change})
+}
+
+// PublishDelay delivers a reported delay to every subscriber of the order.
+func (b *Bus) PublishDelay(orderID string, delay models.OrderDelay) {
+	b.publish(orderID, Event{Delay: &delay})
+}
+
+func (b *Bus) publish(orderID string, event Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs[orderID] {
+		select {
+		case sub.ch <- event:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Close closes every subscription and rejects new ones. It is used on
+// shutdown so streaming clients are disconnected cleanly.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, subs := range b.subs {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+}
+
+// Close unregisters the subscription and closes its channel. It is safe to
+// call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// remove unregisters sub and closes its channel if it is still registered.
+// The caller must hold b.mu.
+func (b *Bus) remove(sub *Subscription) {
+	subs, ok := b.subs[sub.orderID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subs, sub.orderID)
+	}
+	close(sub.ch)
+}
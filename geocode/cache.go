@@ -0,0 +1,84 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is how many addresses a Cache remembers by default.
+const DefaultCacheSize = 10000
+
+// Cache wraps a Geocoder so each address is looked up at most once per TTL.
+// Addresses that were not found are remembered too, so a bad address is
+// not retried on every order; other errors, such as timeouts, are not.
+type Cache struct {
+	next Geocoder
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	point    Point
+	err      error
+	cachedAt time.Time
+}
+
+// NewCache caches next's answers for ttl, keeping at most size addresses.
+func NewCache(next Geocoder, ttl time.Duration, size int) *Cache {
+	return &Cache{next: next, ttl: ttl, size: size, entries: make(map[string]cacheEntry)}
+}
+
+// Geocode returns the cached answer for address, asking the wrapped
+// geocoder when there is none or it has expired.
+func (c *Cache) Geocode(ctx context.Context, address string) (Point, error) {
+	key := cacheKey(address)
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Sub(entry.cachedAt) < c.ttl {
+		return entry.point, entry.err
+	}
+
+	p, err := c.next.Geocode(ctx, address)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return p, err
+	}
+	c.store(key, cacheEntry{point: p, err: err, cachedAt: now})
+	return p, err
+}
+
+// store saves entry under key. When the cache is full it drops expired
+// entries, then the oldest one if it is still full.
+func (c *Cache) store(key string, entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		oldestKey, oldest := "", entry.cachedAt
+		for k, e := range c.entries {
+			if entry.cachedAt.Sub(e.cachedAt) >= c.ttl {
+				delete(c.entries, k)
+				continue
+			}
+			if !e.cachedAt.After(oldest) {
+				oldestKey, oldest = k, e.cachedAt
+			}
+		}
+		if len(c.entries) >= c.size {
+			delete(c.entries, oldestKey)
+		}
+	}
+	c.entries[key] = entry
+}
+
+// cacheKey normalizes an address so spelling variations in case and
+// spacing share an entry.
+func cacheKey(address string) string {
+	return strings.ToLower(strings.Join(strings.Fields(address), " "))
+}
@@ -0,0 +1,105 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Point is a resolved location.
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// ErrNotFound is returned when an address matches no location.
+var ErrNotFound = errors.New("address not found")
+
+// Geocoder resolves a delivery address to coordinates. It is called while
+// an order is being placed, so implementations should honour ctx, and must
+// be safe for concurrent use.
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (Point, error)
+}
+
+// Parse returns the geocoder named by kind: "nominatim" for an
+// OpenStreetMap Nominatim server at url (the public one when url is empty),
+// or "mock". "none" or an empty kind returns nil, which disables geocoding.
+func Parse(kind, url string) (Geocoder, error) {
+	switch kind {
+	case "", "none":
+		return nil, nil
+	case "mock":
+		return NewMock(), nil
+	case "nominatim":
+		if url == "" {
+			url = NominatimURL
+		}
+		return NewNominatim(url), nil
+	}
+	return nil, fmt.Errorf("unknown geocoder '%s'; expected nominatim, mock or none", kind)
+}
+
+// NominatimURL is the public OpenStreetMap Nominatim server. Its usage
+// policy allows about one request a second, so put a Cache in front of it.
+const NominatimURL = "https://nominatim.openstreetmap.org"
+
+// Nominatim geocodes with the Nominatim search API.
+type Nominatim struct {
+	BaseURL string
+	// UserAgent identifies the application, as Nominatim requires.
+	UserAgent string
+	Client    *http.Client
+}
+
+// NewNominatim creates a Nominatim geocoder for the server at baseURL.
+func NewNominatim(baseURL string) *Nominatim {
+	return &Nominatim{
+		BaseURL:   baseURL,
+		UserAgent: "food-delivery-api",
+		Client:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Geocode returns the best match for address.
+func (n *Nominatim) Geocode(ctx context.Context, address string) (Point, error) {
+	q := url.Values{"q": {address}, "format": {"jsonv2"}, "limit": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.BaseURL+"/search?"+q.Encode(), nil)
+	if err != nil {
+		return Point{}, err
+	}
+	req.Header.Set("User-Agent", n.UserAgent)
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return Point{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Point{}, fmt.Errorf("nominatim returned %d", resp.StatusCode)
+	}
+
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return Point{}, fmt.Errorf("decoding nominatim response: %w", err)
+	}
+	if len(results) == 0 {
+		return Point{}, ErrNotFound
+	}
+	lat, err := strconv.ParseFloat(results[0].Lat, 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("nominatim returned latitude %q", results[0].Lat)
+	}
+	lng, err := strconv.ParseFloat(results[0].Lon, 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("nominatim returned longitude %q", results[0].Lon)
+	}
+	return Point{Lat: lat, Lng: lng}, nil
+}
@@ -0,0 +1,52 @@
+package geocode
+
+import (
+	"context"
+	"sync"
+)
+
+// Mock is an in-memory Geocoder for development and tests. It knows only
+// the addresses added to it and reports ErrNotFound for the rest.
+type Mock struct {
+	// Fail, when set, is returned by every call, to simulate an outage.
+	Fail error
+
+	mu     sync.Mutex
+	points map[string]Point
+	calls  int
+}
+
+// NewMock creates a Mock that knows no addresses.
+func NewMock() *Mock {
+	return &Mock{points: make(map[string]Point)}
+}
+
+// Add makes address resolve to p. Addresses are matched as Cache keys
+// them, ignoring case and spacing.
+func (m *Mock) Add(address string, p Point) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.points[cacheKey(address)] = p
+}
+
+// Geocode returns the point added for address.
+func (m *Mock) Geocode(ctx context.Context, address string) (Point, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.Fail != nil {
+		return Point{}, m.Fail
+	}
+	p, ok := m.points[cacheKey(address)]
+	if !ok {
+		return Point{}, ErrNotFound
+	}
+	return p, nil
+}
+
+// Calls returns how many times Geocode has been called.
+func (m *Mock) Calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"food-delivery-api/auth"
+	"food-delivery-api/models"
+	"net/http"
+	"time"
+)
+
+// AuthHandler issues access tokens.
+type AuthHandler struct {
+	Store    Store
+	Secret   []byte
+	TokenTTL time.Duration
+}
+
+// NewAuthHandler creates a new AuthHandler.
+func NewAuthHandler(store Store, secret []byte, tokenTTL time.Duration) *AuthHandler {
+	return &AuthHandler{Store: store, Secret: secret, TokenTTL: tokenTTL}
+}
+
+// Login handles POST /api/auth/login
+// Checks the user's password and returns a signed JWT carrying its ID and
+// role. Unknown users and wrong passwords get the same 401.
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	var errs validationErrors
+	if req.UserID == "" {
+		errs.add("user_id", "user_id is required")
+	}
+	if req.Password == "" {
+		errs.add("password", "password is required")
+	}
+	if errs.respond(w) {
+		return
+	}
+
+	user, err := h.Store.GetUser(r.Context(), req.UserID)
+	if err != nil || !auth.CheckPassword(user.PasswordHash, req.Password) {
+		respondError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+	user.ShowAvailability()
+
+	now := time.Now()
+	claims := auth.NewClaims(user.ID, user.Role, h.TokenTTL, now)
+	token, err := auth.Sign(claims, h.Secret)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to issue token")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.LoginResponse{
+		Token:     token,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+		User:      user,
+	})
+}
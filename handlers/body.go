@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// DefaultMaxBodyBytes is the default cap on request body size.
+const DefaultMaxBodyBytes = 1 << 20
+
+// MaxBodyMiddleware caps request bodies at limit bytes. Reads past the limit
+// fail, and decodeJSON reports them as 413.
+func MaxBodyMiddleware(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyError is a request body that could not be decoded. Fields is set when
+// the problem can be pinned to specific fields.
+type bodyError struct {
+	Status  int
+	Message string
+	Fields  validationErrors
+}
+
+func (e *bodyError) Error() string {
+	return e.Message
+}
+
+// respond writes the error, listing any field errors under "errors".
+func (e *bodyError) respond(w http.ResponseWriter) {
+	code := codeForStatus(e.Status)
+	if e.Status == http.StatusBadRequest {
+		code = CodeInvalidBody
+	}
+	if len(e.Fields) == 0 {
+		respondErrorCode(w, e.Status, code, e.Message)
+		return
+	}
+	respondErrorDetails(w, e.Status, code, e.Message, map[string]interface{}{"errors": e.Fields})
+}
+
+// decodeJSON is the single place request bodies are decoded. It requires a
+// JSON Content-Type and a single JSON value no larger than the body limit,
+// and rejects unknown fields so typos surface instead of being ignored. On
+// failure it writes a 400, 413 or 415 response and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if err := checkContentType(r); err != nil {
+		err.respond(w)
+		return false
+	}
+	if err := decodeStrict(r.Body, dst); err != nil {
+		err.respond(w)
+		return false
+	}
+	return true
+}
+
+// checkContentType requires an application/json body; a charset parameter
+// is allowed.
+func checkContentType(r *http.Request) *bodyError {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return &bodyError{Status: http.StatusUnsupportedMediaType, Message: "Content-Type must be application/json"}
+	}
+	return nil
+}
+
+// decodeStrict decodes exactly one JSON value from rd into dst, rejecting
+// unknown fields and trailing data.
+func decodeStrict(rd io.Reader, dst interface{}) *bodyError {
+	dec := json.NewDecoder(rd)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return decodeError(err)
+		}
+		return &bodyError{Status: http.StatusBadRequest, Message: "Request body must contain a single JSON value"}
+	}
+	return nil
+}
+
+// decodeBytes is decodeStrict for a body that has already been read.
+func decodeBytes(data []byte, dst interface{}) *bodyError {
+	return decodeStrict(bytes.NewReader(data), dst)
+}
+
+// decodeError maps a body read or decode error to a response.
+func decodeError(err error) *bodyError {
+	invalid := &bodyError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+
+	var tooLarge *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tooLarge):
+		return &bodyError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Request body must not exceed %d bytes", tooLarge.Limit),
+		}
+	case errors.Is(err, io.EOF):
+		invalid.Message = "Request body is empty"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		invalid.Message = "Request body is not valid JSON"
+	case errors.As(err, &syntaxErr):
+		invalid.Message = fmt.Sprintf("Request body is not valid JSON (at byte %d)", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			invalid.Message = "Request body must be a JSON " + jsonKind(typeErr.Type.Kind())
+			break
+		}
+		invalid.Fields = validationErrors{{Field: field, Message: "must be " + article(jsonKind(typeErr.Type.Kind()))}}
+	default:
+		// encoding/json has no typed error for unknown fields.
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			invalid.Fields = validationErrors{{Field: strings.Trim(name, `"`), Message: "unknown field"}}
+		}
+	}
+	return invalid
+}
+
+// jsonKind names the JSON type that corresponds to a Go kind.
+func jsonKind(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return "JSON value"
+}
+
+// article prefixes a JSON type name with "a" or "an".
+func article(kind string) string {
+	if kind == "object" || kind == "array" {
+		return "an " + kind
+	}
+	return "a " + kind
+}
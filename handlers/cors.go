@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// corsAllowedHeaders are the request headers cross-origin clients may send.
+const corsAllowedHeaders = "Authorization, Content-Type, X-User-ID, X-User-Role, X-Request-ID, X-Envelope"
+
+// corsExposedHeaders are the response headers cross-origin clients may read.
+const corsExposedHeaders = "X-Request-ID, Retry-After"
+
+// corsAllowedMethods are the methods the API routes use.
+const corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE"
+
+// corsOriginKey marks requests whose cross-origin Origin CORSMiddleware
+// allowed.
+const corsOriginKey contextKey = "corsOrigin"
+
+// ParseCORSOrigins parses a comma-separated list of origins such as
+// "https://app.example.com,http://localhost:5173". Each origin must be a
+// scheme and host with no path. "*" is refused: responses allow
+// credentials, and browsers ignore a wildcard on credentialed requests.
+func ParseCORSOrigins(s string) ([]string, error) {
+	var origins []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if part == "*" {
+			return nil, fmt.Errorf("'*' is not allowed; list each origin")
+		}
+		u, err := url.Parse(part)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" {
+			return nil, fmt.Errorf("invalid origin '%s'; expected scheme://host[:port]", part)
+		}
+		origins = append(origins, normalizeOrigin(u))
+	}
+	return origins, nil
+}
+
+// normalizeOrigin formats an origin the way browsers send it in the Origin
+// header, so configured and received origins compare equal.
+func normalizeOrigin(u *url.URL) string {
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// CORSMiddleware lets browsers on the allowed origins call the API with
+// credentials. Preflight requests are answered directly with 204. Requests
+// from any other origin are rejected with 403 rather than served without
+// CORS headers, except same-origin requests from the dashboard, which
+// browsers also label with an Origin. Requests without an Origin, such as
+// those from curl or other servers, pass through untouched.
+//
+// It must wrap the router rather than be added with Use: the router answers
+// OPTIONS requests with 405 before route middleware runs.
+func CORSMiddleware(allowed []string) func(http.Handler) http.Handler {
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, origin := range allowed {
+		allowedSet[origin] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Origin")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+			if isSameOrigin(r, header) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			u, err := url.Parse(header)
+			if err != nil || !allowedSet[normalizeOrigin(u)] {
+				respondError(w, http.StatusForbidden, "Origin is not allowed")
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", header)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), corsOriginKey, true)))
+		})
+	}
+}
+
+// checkStreamOrigin lets WebSocket handshakes through from the API's own
+// origin, as the upgrader does by default, and from origins CORSMiddleware
+// allowed.
+func checkStreamOrigin(r *http.Request) bool {
+	if allowed, _ := r.Context().Value(corsOriginKey).(bool); allowed {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	return origin == "" || isSameOrigin(r, origin)
+}
+
+// isSameOrigin reports whether origin names the host the request was sent
+// to.
+func isSameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"food-delivery-api/db"
+	"food-delivery-api/models"
+	"net/http"
+	"time"
+)
+
+// CouponHandler manages promo codes.
+type CouponHandler struct {
+	Store Store
+}
+
+// NewCouponHandler creates a new CouponHandler.
+func NewCouponHandler(store Store) *CouponHandler {
+	return &CouponHandler{Store: store}
+}
+
+// CreateCoupon handles POST /api/admin/coupons
+// Admin only. Creates a coupon under its normalised code; a code that is
+// already taken returns 409.
+func (h *CouponHandler) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateCouponRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	coupon := &models.Coupon{
+		Code:           models.NormalizeCouponCode(req.Code),
+		DiscountType:   req.DiscountType,
+		Value:          req.Value,
+		MinOrderAmount: req.MinOrderAmount,
+		ExpiresAt:      req.ExpiresAt,
+		MaxUses:        req.MaxUses,
+	}
+	if err := coupon.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !coupon.ExpiresAt.IsZero() && !coupon.ExpiresAt.After(time.Now()) {
+		respondError(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	if err := h.Store.SaveCoupon(r.Context(), coupon); err != nil {
+		if err == db.ErrDuplicateCoupon {
+			respondError(w, http.StatusConflict, "Coupon already exists: "+coupon.Code)
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to save coupon")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, coupon)
+}
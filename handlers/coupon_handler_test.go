@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"food-delivery-api/memstore"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateCoupon(t *testing.T) {
+	store := memstore.New()
+	h := NewCouponHandler(store)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"percent coupon", `{"code": " summer15 ", "discount_type": "percent", "value": 15}`, http.StatusCreated},
+		{"same code in another case", `{"code": "SUMMER15", "discount_type": "flat", "value": 5}`, http.StatusConflict},
+		{"unknown discount type", `{"code": "BOGO", "discount_type": "bogo", "value": 1}`, http.StatusBadRequest},
+		{"percent over 100", `{"code": "FREE", "discount_type": "percent", "value": 150}`, http.StatusBadRequest},
+		{"zero flat discount", `{"code": "NOTHING", "discount_type": "flat", "value": 0}`, http.StatusBadRequest},
+		{"missing code", `{"code": "  ", "discount_type": "flat", "value": 5}`, http.StatusBadRequest},
+		{"expired", `{"code": "OLD", "discount_type": "flat", "value": 5, "expires_at": "2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/admin/coupons", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			h.CreateCoupon(w, r)
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	coupon, err := store.GetCoupon(context.Background(), "SUMMER15")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coupon.Value != 15 {
+		t.Errorf("the duplicate replaced the coupon: value = %v, want 15", coupon.Value)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import "net/http"
+
+// ErrorCode is a stable, machine-readable identifier for an error response.
+// Clients should branch on the code; messages may change.
+type ErrorCode string
+
+// Generic codes, used by default for each HTTP status.
+const (
+	CodeBadRequest           ErrorCode = "BAD_REQUEST"
+	CodeUnauthorized         ErrorCode = "UNAUTHORIZED"
+	CodeForbidden            ErrorCode = "FORBIDDEN"
+	CodeNotFound             ErrorCode = "NOT_FOUND"
+	CodeConflict             ErrorCode = "CONFLICT"
+	CodeBodyTooLarge         ErrorCode = "BODY_TOO_LARGE"
+	CodeUnsupportedMediaType ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	CodeRateLimited          ErrorCode = "RATE_LIMITED"
+	CodeInternal             ErrorCode = "INTERNAL_ERROR"
+	CodeUnavailable          ErrorCode = "SERVICE_UNAVAILABLE"
+)
+
+// Specific codes for common failures.
+const (
+	// CodeValidationFailed lists every invalid field under "errors".
+	CodeValidationFailed ErrorCode = "VALIDATION_FAILED"
+	// CodeInvalidBody is a body that is not valid JSON for the endpoint.
+	CodeInvalidBody  ErrorCode = "INVALID_BODY"
+	CodeTokenExpired ErrorCode = "TOKEN_EXPIRED"
+
+	CodeOrderNotFound      ErrorCode = "ORDER_NOT_FOUND"
+	CodeUserNotFound       ErrorCode = "USER_NOT_FOUND"
+	CodeRestaurantNotFound ErrorCode = "RESTAURANT_NOT_FOUND"
+	CodeMenuItemNotFound   ErrorCode = "MENU_ITEM_NOT_FOUND"
+
+	// CodeInvalidTransition is a status change the state machine does not
+	// allow from the order's current status.
+	CodeInvalidTransition ErrorCode = "INVALID_TRANSITION"
+	// CodeTransitionForbidden is a valid status change that the caller's
+	// role may not make.
+	CodeTransitionForbidden ErrorCode = "TRANSITION_FORBIDDEN"
+	// CodeTotalChanged means the order total no longer matches the one the
+	// client showed the customer.
+	CodeTotalChanged ErrorCode = "TOTAL_CHANGED"
+	// CodeDriverUnavailable means the driver must set themselves available
+	// first.
+	CodeDriverUnavailable ErrorCode = "DRIVER_UNAVAILABLE"
+	// CodePaymentFailed means the payment provider declined or could not
+	// process a card payment.
+	CodePaymentFailed ErrorCode = "PAYMENT_FAILED"
+	// CodeCancelWindowClosed means the customer's grace period for
+	// cancelling the order has passed.
+	CodeCancelWindowClosed ErrorCode = "CANCEL_WINDOW_CLOSED"
+)
+
+// APIError is the body of every error response.
+type APIError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Status  int       `json:"status"`
+}
+
+// codeForStatus returns the generic code for an HTTP status.
+func codeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeBodyTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// HealthHandler serves the liveness and readiness probes.
+type HealthHandler struct {
+	Store    Store
+	draining atomic.Bool
+}
+
+// NewHealthHandler creates a new HealthHandler.
+func NewHealthHandler(store Store) *HealthHandler {
+	return &HealthHandler{Store: store}
+}
+
+// Drain marks the server as shutting down, so readiness fails and load
+// balancers stop sending new requests while in-flight ones finish.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Live handles GET /healthz
+// Reports that the process is up. It never touches the database.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready handles GET /readyz
+// Reports whether the server can take traffic: MongoDB must be reachable
+// and the server must not be shutting down. Otherwise it returns 503.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		respondError(w, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+	if err := h.Store.Ping(r.Context()); err != nil {
+		respondError(w, http.StatusServiceUnavailable, "Database is unreachable")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"food-delivery-api/metrics"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ContextKeyRequestID is the context key for the per-request ID.
+const ContextKeyRequestID contextKey = "requestID"
+
+// requestLogKey holds the *requestLog for the current request.
+const requestLogKey contextKey = "requestLog"
+
+// accessLog writes one JSON line per request.
+var accessLog = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// requestLog collects details discovered while handling a request, such as
+// the user authenticated by a per-route middleware further down the chain.
+type requestLog struct {
+	userID string
+	// route is the matched route's path template, set by RouteMiddleware.
+	route string
+}
+
+// statusRecorder captures the status code written by downstream handlers.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.status == 0 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController, so
+// streaming handlers can flush.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Hijack hands the connection to a WebSocket upgrade. The request is logged
+// with status 101 once the stream ends.
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(sr.ResponseWriter).Hijack()
+	if err == nil && sr.status == 0 {
+		sr.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// LoggingMiddleware assigns each request an ID (reusing an incoming
+// X-Request-ID), exposes it via the request context and the X-Request-ID
+// response header, and logs method, path, status, duration and the
+// authenticated user as a JSON line once the response is written. Each
+// request is also recorded in m by route and status; a nil m records nothing.
+func LoggingMiddleware(m *metrics.Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			requestID := r.Header.Get("X-Request-ID")
+			if requestID == "" {
+				requestID = uuid.New().String()
+			}
+			w.Header().Set("X-Request-ID", requestID)
+
+			entry := &requestLog{}
+			ctx := context.WithValue(r.Context(), ContextKeyRequestID, requestID)
+			ctx = context.WithValue(ctx, requestLogKey, entry)
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			duration := time.Since(start)
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			attrs := []any{
+				slog.String("request_id", requestID),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+			}
+			if entry.userID != "" {
+				attrs = append(attrs, slog.String("user_id", entry.userID))
+			}
+			accessLog.Info("request", attrs...)
+
+			route := entry.route
+			if route == "" {
+				route = "unmatched"
+			}
+			m.ObserveRequest(r.Method, route, status, duration)
+		})
+	}
+}
+
+// requestIDFrom returns the request ID assigned by LoggingMiddleware, if any.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(ContextKeyRequestID).(string)
+	return id
+}
+
+// logUser records the authenticated user on the request's log entry.
+func logUser(ctx context.Context, userID string) {
+	if entry, ok := ctx.Value(requestLogKey).(*requestLog); ok {
+		entry.userID = userID
+	}
+}
+
+// RouteMiddleware records the matched route's path template on the request's
+// log entry, so metrics are grouped by route rather than by raw path. It is
+// installed on the router, where the match is known.
+func RouteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if entry, ok := r.Context().Value(requestLogKey).(*requestLog); ok {
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil {
+					entry.route = tmpl
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
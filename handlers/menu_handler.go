@@ -1,10 +1,15 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"food-delivery-api/db"
 	"food-delivery-api/models"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -12,11 +17,11 @@ import (
 
 // MenuHandler handles menu-related HTTP requests.
 type MenuHandler struct {
-	Store *db.Store
+	Store Store
 }
 
 // NewMenuHandler creates a new MenuHandler.
-func NewMenuHandler(store *db.Store) *MenuHandler {
+func NewMenuHandler(store Store) *MenuHandler {
 	return &MenuHandler{Store: store}
 }
 
@@ -39,54 +44,216 @@ func (h *MenuHandler) AddMenuItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req models.CreateMenuItemRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	if req.Name == "" {
-		respondError(w, http.StatusBadRequest, "Dish name is required")
+	itemType, errs := h.validateMenuItemRequest(r.Context(), restaurantID, "", &req)
+	if errs.respond(w) {
 		return
 	}
-	if req.Price <= 0 {
-		respondError(w, http.StatusBadRequest, "Price must be greater than 0")
+	if !h.checkNameFree(w, r, restaurantID, "", req.Name) {
 		return
 	}
-	if req.Category == "" {
-		req.Category = "General"
+	if err := h.resolveCategory(r.Context(), restaurantID, &req); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save category")
+		return
+	}
+
+	item := newMenuItem(restaurantID, &req, itemType)
+	if err := h.Store.SaveMenuItem(r.Context(), item); err != nil {
+		if err == db.ErrDuplicateMenuItem {
+			respondError(w, http.StatusConflict, "Your menu already has a dish named "+req.Name)
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to save menu item")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, item)
+}
+
+// maxBulkMenuItems caps the number of items in one bulk upload.
+const maxBulkMenuItems = 200
+
+// menuSortFields are the fields GET /api/restaurants/{id}/menu may sort by.
+var menuSortFields = map[string]bool{
+	"name":     true,
+	"price":    true,
+	"category": true,
+}
+
+// AddMenuItems handles POST /api/restaurants/{id}/menu/bulk
+// Adds many menu items at once. Each item is validated on its own; the
+// valid ones are inserted together and the response reports the outcome
+// for every item by its position in the request.
+func (h *MenuHandler) AddMenuItems(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant {
+		respondError(w, http.StatusForbidden, "Only restaurants can manage menus")
+		return
+	}
+	if userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only manage your own menu")
+		return
+	}
+
+	var reqs []models.CreateMenuItemRequest
+	if !decodeJSON(w, r, &reqs) {
+		return
+	}
+	if len(reqs) == 0 || len(reqs) > maxBulkMenuItems {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Between 1 and %d items are required", maxBulkMenuItems))
+		return
+	}
+
+	results := make([]models.BulkMenuItemResult, len(reqs))
+	var items []*models.MenuItem
+	var positions []int
+	names := make(map[string]bool, len(reqs))
+	for i := range reqs {
+		results[i].Index = i
+		itemType, errs := h.validateMenuItemRequest(r.Context(), restaurantID, "", &reqs[i])
+		if len(errs) > 0 {
+			results[i].Error = errs.Error()
+			continue
+		}
+		key := models.MenuItemKey(reqs[i].Name)
+		if names[key] {
+			results[i].Error = "Dish name repeats an earlier item in this upload"
+			continue
+		}
+		taken, err := h.Store.MenuItemNameTaken(r.Context(), restaurantID, reqs[i].Name, "")
+		if err != nil {
+			results[i].Error = "Failed to check dish name"
+			continue
+		}
+		if taken {
+			results[i].Error = "Your menu already has a dish named " + reqs[i].Name
+			continue
+		}
+		names[key] = true
+		if err := h.resolveCategory(r.Context(), restaurantID, &reqs[i]); err != nil {
+			results[i].Error = "Failed to save category"
+			continue
+		}
+		items = append(items, newMenuItem(restaurantID, &reqs[i], itemType))
+		positions = append(positions, i)
+	}
+
+	failed, err := h.Store.SaveMenuItems(r.Context(), items)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save menu items")
+		return
 	}
 
-	item := &models.MenuItem{
+	resp := models.BulkMenuItemResponse{Results: results}
+	for j, item := range items {
+		i := positions[j]
+		switch err := failed[j]; {
+		case err == db.ErrDuplicateMenuItem:
+			results[i].Error = "Your menu already has a dish named " + item.Name
+			continue
+		case err != nil:
+			results[i].Error = "Failed to save menu item: " + err.Error()
+			continue
+		}
+		results[i].ID = item.ID
+		resp.Created++
+	}
+	resp.Failed = len(reqs) - resp.Created
+
+	status := http.StatusCreated
+	if resp.Created == 0 {
+		status = http.StatusBadRequest
+	}
+	respondJSON(w, status, resp)
+}
+
+// newMenuItem builds a new, available menu item from a validated request.
+func newMenuItem(restaurantID string, req *models.CreateMenuItemRequest, itemType models.MenuItemType) *models.MenuItem {
+	return &models.MenuItem{
 		ID:           uuid.New().String(),
 		RestaurantID: restaurantID,
 		Name:         req.Name,
+		NameKey:      models.MenuItemKey(req.Name),
 		Description:  req.Description,
 		Price:        req.Price,
 		Category:     req.Category,
 		Available:    true,
 		ImageURL:     req.ImageURL,
+		MenuSchedule: req.MenuSchedule,
+		Type:         itemType,
+		ComponentIDs: req.ComponentIDs,
+		Version:      1,
 	}
-
-	if err := h.Store.SaveMenuItem(item); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to save menu item")
-		return
-	}
-
-	respondJSON(w, http.StatusCreated, item)
 }
 
 // GetMenu handles GET /api/restaurants/{id}/menu
-// Public endpoint — anyone can view a restaurant's menu.
+// Public endpoint — anyone can view a restaurant's menu. Availability
+// reflects each item's schedule at the time of the request. Supports
+// optional ?category=, ?max_price=, ?available_only=true and ?q= filters,
+// and ?sort= (default name:asc).
 func (h *MenuHandler) GetMenu(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	restaurantID := vars["id"]
 
-	items, err := h.Store.ListMenuItems(restaurantID)
+	q := r.URL.Query()
+	filter := db.MenuFilter{
+		RestaurantID: restaurantID,
+		Category:     strings.TrimSpace(q.Get("category")),
+		Query:        strings.TrimSpace(q.Get("q")),
+	}
+	if v := q.Get("max_price"); v != "" {
+		maxPrice, err := strconv.ParseFloat(v, 64)
+		if err != nil || maxPrice <= 0 {
+			respondError(w, http.StatusBadRequest, "max_price must be a positive number")
+			return
+		}
+		filter.MaxPrice = maxPrice
+	}
+	if v := q.Get("available_only"); v != "" {
+		availableOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "available_only must be true or false")
+			return
+		}
+		filter.AvailableOnly = availableOnly
+	}
+	sortBy, err := parseSort(q, menuSortFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Sort = sortBy
+
+	items, err := h.Store.ListMenuItems(r.Context(), filter)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to fetch menu")
 		return
 	}
 
+	// Items outside their schedule window are shown as unavailable right now.
+	loc := time.UTC
+	if restaurant, err := h.Store.GetUser(r.Context(), restaurantID); err == nil {
+		loc = restaurant.Settings.Location()
+	}
+	now := time.Now()
+	visible := make([]*models.MenuItem, 0, len(items))
+	for _, item := range items {
+		item.Available = item.IsAvailableAt(now, loc)
+		if filter.AvailableOnly && !item.Available {
+			continue
+		}
+		visible = append(visible, item)
+	}
+	items = visible
+
 	respondJSON(w, http.StatusOK, items)
 }
 
@@ -105,9 +272,9 @@ func (h *MenuHandler) DeleteMenuItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify the item belongs to this restaurant.
-	item, err := h.Store.GetMenuItem(itemID)
+	item, err := h.Store.GetMenuItem(r.Context(), itemID)
 	if err != nil {
-		respondError(w, http.StatusNotFound, "Menu item not found")
+		respondErrorCode(w, http.StatusNotFound, CodeMenuItemNotFound, "Menu item not found")
 		return
 	}
 	if item.RestaurantID != restaurantID {
@@ -115,10 +282,377 @@ func (h *MenuHandler) DeleteMenuItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.Store.DeleteMenuItem(itemID); err != nil {
+	if err := h.Store.DeleteMenuItem(r.Context(), itemID); err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to delete menu item")
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Menu item deleted"})
 }
+
+// SetAvailability handles PATCH /api/restaurants/{id}/menu/{itemId}/availability
+// Orders snapshot item details, so toggling availability never changes them.
+func (h *MenuHandler) SetAvailability(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+	itemID := vars["itemId"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only manage your own menu")
+		return
+	}
+
+	var req models.UpdateAvailabilityRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Available == nil {
+		respondError(w, http.StatusBadRequest, "available is required")
+		return
+	}
+
+	item, err := h.Store.GetMenuItem(r.Context(), itemID)
+	if err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeMenuItemNotFound, "Menu item not found")
+		return
+	}
+	if item.RestaurantID != restaurantID {
+		respondError(w, http.StatusForbidden, "Item does not belong to your restaurant")
+		return
+	}
+
+	if err := h.Store.SetMenuItemAvailability(r.Context(), itemID, *req.Available); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update menu item")
+		return
+	}
+	item.Available = *req.Available
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// SetAvailabilityBulk handles PATCH /api/restaurants/{id}/menu/availability
+// Switches several menu items on or off in one write, e.g. during a rush.
+// Every ID must be on the restaurant's menu; otherwise nothing is changed
+// and the unknown IDs are listed.
+func (h *MenuHandler) SetAvailabilityBulk(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only manage your own menu")
+		return
+	}
+
+	var req models.BulkAvailabilityRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	var errs validationErrors
+	if len(req.ItemIDs) == 0 || len(req.ItemIDs) > maxBulkMenuItems {
+		errs.add("item_ids", fmt.Sprintf("Between 1 and %d item IDs are required", maxBulkMenuItems))
+	}
+	if req.Available == nil {
+		errs.add("available", "available is required")
+	}
+	if errs.respond(w) {
+		return
+	}
+
+	found, err := h.Store.MenuItemIDsOf(r.Context(), restaurantID, req.ItemIDs)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load menu items")
+		return
+	}
+	for i, id := range req.ItemIDs {
+		if !found[id] {
+			errs.add(fmt.Sprintf("item_ids[%d]", i), "Menu item not found on this menu: "+id)
+		}
+	}
+	if errs.respond(w) {
+		return
+	}
+
+	modified, err := h.Store.SetMenuItemsAvailability(r.Context(), restaurantID, req.ItemIDs, *req.Available)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update menu items")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.BulkAvailabilityResponse{Available: *req.Available, Modified: modified})
+}
+
+// UpdateMenuItem handles PUT /api/restaurants/{id}/menu/{itemId}
+// Replaces an item's details in place, preserving its ID and availability.
+func (h *MenuHandler) UpdateMenuItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+	itemID := vars["itemId"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only manage your own menu")
+		return
+	}
+
+	var req models.CreateMenuItemRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	item, err := h.Store.GetMenuItem(r.Context(), itemID)
+	if err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeMenuItemNotFound, "Menu item not found")
+		return
+	}
+	if item.RestaurantID != restaurantID {
+		respondError(w, http.StatusForbidden, "Item does not belong to your restaurant")
+		return
+	}
+
+	itemType, errs := h.validateMenuItemRequest(r.Context(), restaurantID, itemID, &req)
+	if errs.respond(w) {
+		return
+	}
+	if !h.checkNameFree(w, r, restaurantID, itemID, req.Name) {
+		return
+	}
+	if err := h.resolveCategory(r.Context(), restaurantID, &req); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save category")
+		return
+	}
+
+	item.Name = req.Name
+	item.NameKey = models.MenuItemKey(req.Name)
+	item.Description = req.Description
+	item.Price = req.Price
+	item.Category = req.Category
+	item.ImageURL = req.ImageURL
+	item.MenuSchedule = req.MenuSchedule
+	item.Type = itemType
+	item.ComponentIDs = req.ComponentIDs
+	item.Version++
+
+	if err := h.Store.UpdateMenuItem(r.Context(), item); err != nil {
+		if err == db.ErrDuplicateMenuItem {
+			respondError(w, http.StatusConflict, "Your menu already has a dish named "+req.Name)
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to update menu item")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// validateMenuItemRequest applies the rules shared by creating and updating
+// menu items, defaulting the category, and returns the resulting item type
+// with every problem found. selfID is the item being updated, if any, so a
+// bundle cannot contain itself.
+func (h *MenuHandler) validateMenuItemRequest(ctx context.Context, restaurantID, selfID string, req *models.CreateMenuItemRequest) (models.MenuItemType, validationErrors) {
+	var errs validationErrors
+	if req.Name == "" {
+		errs.add("name", "Dish name is required")
+	}
+	if req.Price <= 0 {
+		errs.add("price", "Price must be greater than 0")
+	}
+	req.Category = models.CleanCategoryName(req.Category)
+	if req.Category == "" {
+		req.Category = models.DefaultMenuCategory
+	}
+	if utf8.RuneCountInString(req.Category) > models.MaxCategoryNameLength {
+		errs.add("category", fmt.Sprintf("Category must be at most %d characters", models.MaxCategoryNameLength))
+	}
+	if err := req.MenuSchedule.Validate(); err != nil {
+		errs.add("schedule", err.Error())
+	}
+	if len(req.ComponentIDs) == 0 {
+		return models.MenuItemTypeSingle, errs
+	}
+	for _, id := range req.ComponentIDs {
+		if id == selfID {
+			errs.add("component_ids", "a bundle cannot contain itself")
+			return models.MenuItemTypeBundle, errs
+		}
+	}
+	if err := h.validateBundleComponents(ctx, restaurantID, req.ComponentIDs); err != nil {
+		errs.add("component_ids", err.Error())
+	}
+	return models.MenuItemTypeBundle, errs
+}
+
+// checkNameFree answers 409 and returns false if another of the
+// restaurant's items, other than selfID, already uses name. The unique index
+// on name keys backs this up against concurrent requests.
+func (h *MenuHandler) checkNameFree(w http.ResponseWriter, r *http.Request, restaurantID, selfID, name string) bool {
+	taken, err := h.Store.MenuItemNameTaken(r.Context(), restaurantID, name, selfID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to check dish name")
+		return false
+	}
+	if taken {
+		respondError(w, http.StatusConflict, "Your menu already has a dish named "+name)
+		return false
+	}
+	return true
+}
+
+// resolveCategory files the item under the restaurant's existing category
+// with the same normalised name, or creates that category, so every item in
+// a category uses one spelling.
+func (h *MenuHandler) resolveCategory(ctx context.Context, restaurantID string, req *models.CreateMenuItemRequest) error {
+	category, err := h.Store.EnsureMenuCategory(ctx, newMenuCategory(restaurantID, req.Category))
+	if err != nil {
+		return err
+	}
+	req.Category = category.Name
+	return nil
+}
+
+// validateBundleComponents checks that every component of a bundle is an
+// existing single dish on the same restaurant's menu.
+func (h *MenuHandler) validateBundleComponents(ctx context.Context, restaurantID string, componentIDs []string) error {
+	for _, id := range componentIDs {
+		component, err := h.Store.GetMenuItem(ctx, id)
+		if err != nil || component.RestaurantID != restaurantID {
+			return fmt.Errorf("bundle component not found on this menu: %s", id)
+		}
+		if component.IsBundle() {
+			return fmt.Errorf("bundle component '%s' cannot itself be a bundle", component.Name)
+		}
+	}
+	return nil
+}
+
+// newMenuCategory builds a new category from a cleaned name.
+func newMenuCategory(restaurantID, name string) *models.MenuCategory {
+	return &models.MenuCategory{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurantID,
+		Name:         name,
+		Key:          models.CategoryKey(name),
+		CreatedAt:    time.Now(),
+	}
+}
+
+// AddCategory handles POST /api/restaurants/{id}/categories
+// Adds a category to the restaurant's menu. Names are unique per
+// restaurant, ignoring case and repeated spaces.
+func (h *MenuHandler) AddCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only manage your own menu")
+		return
+	}
+
+	var req models.CreateMenuCategoryRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	var errs validationErrors
+	name := models.CleanCategoryName(req.Name)
+	if name == "" {
+		errs.add("name", "Category name is required")
+	} else if utf8.RuneCountInString(name) > models.MaxCategoryNameLength {
+		errs.add("name", fmt.Sprintf("Category must be at most %d characters", models.MaxCategoryNameLength))
+	}
+	if errs.respond(w) {
+		return
+	}
+
+	category := newMenuCategory(restaurantID, name)
+	if err := h.Store.SaveMenuCategory(r.Context(), category); err != nil {
+		if err == db.ErrDuplicateCategory {
+			respondError(w, http.StatusConflict, "Category already exists: "+name)
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to save category")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, category)
+}
+
+// ListCategories handles GET /api/restaurants/{id}/categories
+// Public endpoint — lists the restaurant's menu categories by name.
+func (h *MenuHandler) ListCategories(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	categories, err := h.Store.ListMenuCategories(r.Context(), restaurantID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to fetch categories")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, categories)
+}
+
+// DeleteCategory handles DELETE /api/restaurants/{id}/categories/{categoryId}
+// A category can only be deleted once no menu items use it.
+func (h *MenuHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+	categoryID := vars["categoryId"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only manage your own menu")
+		return
+	}
+
+	category, err := h.Store.GetMenuCategory(r.Context(), categoryID)
+	if err != nil || category.RestaurantID != restaurantID {
+		respondError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	inUse, err := h.Store.CountMenuItems(r.Context(), db.MenuFilter{RestaurantID: restaurantID, Category: category.Name})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to check category")
+		return
+	}
+	if inUse > 0 {
+		respondError(w, http.StatusConflict, fmt.Sprintf("Category '%s' still has %d menu items", category.Name, inUse))
+		return
+	}
+
+	if err := h.Store.DeleteMenuCategory(r.Context(), categoryID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete category")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Category deleted"})
+}
+
+// GetMenuCategories handles GET /api/restaurants/{id}/menu/categories
+// Public endpoint — lists the categories used on the menu with the number
+// of items in each.
+func (h *MenuHandler) GetMenuCategories(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	counts, err := h.Store.CountMenuItemsByCategory(r.Context(), restaurantID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to fetch categories")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, counts)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"food-delivery-api/db"
+	"food-delivery-api/metrics"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultStatusRefresh is how long the order counts by status are reused
+// before the metrics endpoint queries the database again.
+const DefaultStatusRefresh = 30 * time.Second
+
+// MetricsHandler serves the metrics in Registry in the Prometheus text
+// format.
+type MetricsHandler struct {
+	Store    Store
+	Registry *metrics.Registry
+	// StatusRefresh is how long the orders_by_status gauge is cached, so
+	// frequent scrapes don't each count the orders collection.
+	StatusRefresh time.Duration
+
+	mu          sync.Mutex
+	refreshedAt time.Time
+}
+
+// NewMetricsHandler creates a new MetricsHandler.
+func NewMetricsHandler(store Store, registry *metrics.Registry) *MetricsHandler {
+	return &MetricsHandler{Store: store, Registry: registry, StatusRefresh: DefaultStatusRefresh}
+}
+
+// Metrics handles GET /metrics
+// Writes request counts and latencies by route and status, the number of
+// orders placed since startup, and the number of orders in each status.
+func (h *MetricsHandler) Metrics(w http.ResponseWriter, r *http.Request) {
+	h.refreshOrderStatuses(r)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := h.Registry.WriteTo(w); err != nil {
+		log.Printf("⚠️ metrics: writing response: %v", err)
+	}
+}
+
+// refreshOrderStatuses recounts orders by status once the cached counts are
+// older than StatusRefresh. A failed count keeps the previous values and is
+// not retried until the next refresh is due, so an unreachable database
+// doesn't slow every scrape.
+func (h *MetricsHandler) refreshOrderStatuses(r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.refreshedAt.IsZero() && time.Since(h.refreshedAt) < h.StatusRefresh {
+		return
+	}
+	h.refreshedAt = time.Now()
+	counts, err := h.Store.CountOrdersByStatus(r.Context(), db.OrderFilter{})
+	if err != nil {
+		log.Printf("⚠️ metrics: counting orders by status: %v", err)
+		return
+	}
+	h.Registry.SetOrdersByStatus(counts)
+}
@@ -2,7 +2,17 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"food-delivery-api/auth"
+	"food-delivery-api/models"
+	"log"
 	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 )
 
 type contextKey string
@@ -14,20 +24,108 @@ const (
 	ContextKeyUserRole contextKey = "userRole"
 )
 
-// AuthMiddleware extracts X-User-ID and X-User-Role headers and injects
-// them into the request context. Returns 401 if either header is missing.
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Header.Get("X-User-ID")
-		userRole := r.Header.Get("X-User-Role")
+// NewAuthMiddleware returns middleware that validates the
+// "Authorization: Bearer <token>" header and injects the token's user ID and
+// role into the request context. WebSocket handshakes may pass the token as
+// ?access_token= instead. Missing, malformed, and expired tokens and
+// tokens for users that no longer exist are rejected with 401; a role claim
+// that no longer matches the stored user is rejected with 403.
+func NewAuthMiddleware(store Store, secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if header == "" && websocket.IsWebSocketUpgrade(r) {
+				// Browsers cannot set headers on a WebSocket handshake.
+				token, ok = r.URL.Query().Get("access_token"), true
+			}
+			if !ok || token == "" {
+				respondError(w, http.StatusUnauthorized, "Authorization: Bearer <token> header is required")
+				return
+			}
+
+			claims, err := auth.Parse(token, secret, time.Now())
+			if errors.Is(err, auth.ErrTokenExpired) {
+				respondErrorCode(w, http.StatusUnauthorized, CodeTokenExpired, "Token has expired")
+				return
+			}
+			if err != nil {
+				respondError(w, http.StatusUnauthorized, "Invalid token")
+				return
+			}
+
+			user, err := store.GetUser(r.Context(), claims.Subject)
+			if err != nil {
+				respondError(w, http.StatusUnauthorized, "User no longer exists")
+				return
+			}
+			if user.Role != claims.Role {
+				respondError(w, http.StatusForbidden, "Token role does not match the user's role")
+				return
+			}
+
+			logUser(r.Context(), claims.Subject)
+			ctx := context.WithValue(r.Context(), ContextKeyUserID, claims.Subject)
+			ctx = context.WithValue(ctx, ContextKeyUserRole, string(claims.Role))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-		if userID == "" || userRole == "" {
-			http.Error(w, `{"error": "X-User-ID and X-User-Role headers are required"}`, http.StatusUnauthorized)
-			return
-		}
+// RequireRole returns middleware that only lets callers with one of the
+// given roles through, answering 403 otherwise. It must run after the auth
+// middleware, which puts the role in the request context.
+func RequireRole(roles ...models.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value(ContextKeyUserRole).(string)
+			for _, allowed := range roles {
+				if models.Role(role) == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			respondError(w, http.StatusForbidden, "This endpoint is restricted to: "+joinRoles(roles))
+		})
+	}
+}
 
-		ctx := context.WithValue(r.Context(), ContextKeyUserID, userID)
-		ctx = context.WithValue(ctx, ContextKeyUserRole, userRole)
-		next.ServeHTTP(w, r.WithContext(ctx))
+// joinRoles lists roles for an error message.
+func joinRoles(roles []models.Role) string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = string(role)
+	}
+	return strings.Join(names, ", ")
+}
+
+// RecoveryMiddleware recovers from panics in downstream handlers, logs the
+// stack trace with the request ID, and returns a clean 500 JSON error
+// instead of dropping the connection.
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			requestID := requestIDFrom(r.Context())
+			if requestID == "" {
+				requestID = r.Header.Get("X-Request-ID")
+			}
+			if requestID == "" {
+				requestID = w.Header().Get("X-Request-ID")
+			}
+			if requestID == "" {
+				requestID = uuid.New().String()
+				w.Header().Set("X-Request-ID", requestID)
+			}
+			log.Printf("💥 panic serving %s %s [request_id=%s]: %v\n%s", r.Method, r.URL.Path, requestID, rec, debug.Stack())
+			respondError(w, http.StatusInternalServerError, "Internal server error")
+		}()
+		next.ServeHTTP(w, r)
 	})
 }
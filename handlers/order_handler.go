@@ -1,29 +1,123 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"food-delivery-api/db"
+	"food-delivery-api/eta"
+	"food-delivery-api/events"
+	"food-delivery-api/geocode"
+	"food-delivery-api/metrics"
 	"food-delivery-api/models"
+	"food-delivery-api/notify"
+	"food-delivery-api/payment"
 	"food-delivery-api/statemachine"
+	"food-delivery-api/webhook"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+// updateStatusFields lists which UpdateStatusRequest fields each role may
+// set. Anything else is rejected so clients cannot smuggle privileged
+// fields (such as driver_id) through a status update.
+var updateStatusFields = map[models.Role]map[string]bool{
+	models.RoleCustomer:   {"status": true, "transition_id": true, "note": true, "cancellation_reason": true},
+	models.RoleRestaurant: {"status": true, "transition_id": true, "note": true, "cancellation_reason": true, "rejection_reason": true, "item_confirmation": true, "prep_minutes": true},
+	models.RoleDriver:     {"status": true, "transition_id": true, "note": true},
+}
+
+// orderSortFields are the fields GET /api/orders may sort by.
+var orderSortFields = map[string]bool{
+	"created_at":            true,
+	"updated_at":            true,
+	"total_amount":          true,
+	"status":                true,
+	"estimated_delivery_at": true,
+}
+
+// totalTolerance is how far a client's expected_total may drift from the
+// server total (floating-point noise) before the order is rejected.
+const totalTolerance = 0.005
+
+// errCouponUsedUp aborts order creation when the coupon's last use was
+// taken by a concurrent order.
+var errCouponUsedUp = errors.New("coupon has reached its usage limit")
+
+// DefaultTipWindow is how long after delivery customers may adjust the tip
+// unless configured otherwise.
+const DefaultTipWindow = 24 * time.Hour
+
+// DefaultRevertWindow is how long after a status change it may be reverted
+// unless configured otherwise.
+const DefaultRevertWindow = 2 * time.Minute
+
+// geocodeTimeout bounds the geocoder lookup made while placing an order.
+const geocodeTimeout = 3 * time.Second
+
+// etaSampleSize is how many recent deliveries feed the restaurant's stage averages.
+const etaSampleSize = 50
+
 // OrderHandler handles order-related HTTP requests.
 type OrderHandler struct {
-	Store *db.Store
+	Store Store
+	// CancellationFees is charged when a customer cancels, keyed by the
+	// order's status at cancel time.
+	CancellationFees models.CancellationFeePolicy
+	// CancelGracePeriod is how long after an order is placed its customer
+	// may cancel it free of charge. Zero disables the window, so the fee
+	// policy always applies.
+	CancelGracePeriod time.Duration
+	// BlockLateCancels refuses customer cancellations after the grace
+	// period instead of charging the fee policy.
+	BlockLateCancels bool
+	// ETA configures the promised delivery time stored on orders.
+	ETA eta.Settings
+	// TipWindow is how long after delivery the customer may adjust the tip.
+	TipWindow time.Duration
+	// RevertWindow is how long after a status change it may be reverted.
+	RevertWindow time.Duration
+	// Pricing sets the tax and delivery fee charged on new orders.
+	Pricing models.Pricing
+	// Webhooks notifies restaurants of status changes; nil disables them.
+	Webhooks *webhook.Dispatcher
+	// Events fans status changes out to clients streaming the order. The
+	// timeout sweeper and scheduler publish to the same bus.
+	Events *events.Bus
+	// DriverAlerts tells drivers when an order is ready for pickup; nil
+	// disables alerts.
+	DriverAlerts notify.Notifier
+	// Payments authorizes, captures and refunds card orders; nil leaves
+	// them to be recorded by hand.
+	Payments payment.Provider
+	// Metrics counts placed orders; nil disables counting.
+	Metrics *metrics.Registry
+	// Geocoder locates delivery addresses sent without coordinates, so
+	// delivery can be priced by distance; nil disables geocoding.
+	Geocoder geocode.Geocoder
 }
 
 // NewOrderHandler creates a new OrderHandler.
-func NewOrderHandler(store *db.Store) *OrderHandler {
-	return &OrderHandler{Store: store}
+func NewOrderHandler(store Store) *OrderHandler {
+	return &OrderHandler{Store: store, ETA: eta.DefaultSettings, TipWindow: DefaultTipWindow, RevertWindow: DefaultRevertWindow, Events: events.NewBus()}
 }
 
 // CreateOrder handles POST /api/orders
-// Customers select dishes from a restaurant's menu. Items are looked up by menu_item_id.
+// Customers select dishes from a restaurant's menu. Items are looked up by
+// menu_item_id. With scheduled_for the order starts SCHEDULED and is placed
+// automatically at that time.
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	role := r.Context().Value(ContextKeyUserRole).(string)
 	userID := r.Context().Value(ContextKeyUserID).(string)
@@ -34,104 +128,522 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req models.CreateOrderFromMenuRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
+	var errs validationErrors
 	if req.RestaurantID == "" {
-		respondError(w, http.StatusBadRequest, "restaurant_id is required")
-		return
+		errs.add("restaurant_id", "restaurant_id is required")
 	}
 	if len(req.Items) == 0 {
-		respondError(w, http.StatusBadRequest, "At least one item is required")
-		return
+		errs.add("items", "At least one item is required")
 	}
-	if req.DeliveryAddress == "" {
-		respondError(w, http.StatusBadRequest, "delivery_address is required")
-		return
+	for i, item := range req.Items {
+		if item.Quantity <= 0 {
+			errs.add(fmt.Sprintf("items[%d].quantity", i), "Quantity must be at least 1")
+		}
+		req.Items[i].SpecialInstructions = models.CleanNote(item.SpecialInstructions)
+		if utf8.RuneCountInString(req.Items[i].SpecialInstructions) > models.MaxItemInstructionsLength {
+			errs.add(fmt.Sprintf("items[%d].special_instructions", i),
+				fmt.Sprintf("special_instructions must be at most %d characters", models.MaxItemInstructionsLength))
+		}
+	}
+	req.Notes = models.CleanNote(req.Notes)
+	if utf8.RuneCountInString(req.Notes) > models.MaxOrderNotesLength {
+		errs.add("notes", fmt.Sprintf("notes must be at most %d characters", models.MaxOrderNotesLength))
 	}
-	if req.PaymentMethod == "" {
-		respondError(w, http.StatusBadRequest, "payment_method is required")
+	req.DeliveryAddress = models.NormalizeAddressText(req.DeliveryAddress)
+	switch {
+	case req.AddressID != "" && (req.DeliveryAddress != "" || req.PostalAddress != nil):
+		errs.add("address_id", "Provide either delivery_address and postal_address, or address_id, not both")
+	case req.AddressID != "":
+		addr, err := h.Store.GetAddress(r.Context(), req.AddressID)
+		if err != nil || addr.UserID != userID {
+			errs.add("address_id", "Invalid address_id")
+		} else {
+			req.DeliveryAddress = addr.Address
+			if req.DeliveryLat == nil && req.DeliveryLng == nil {
+				req.DeliveryLat, req.DeliveryLng = addr.Lat, addr.Lng
+			}
+		}
+	case req.PostalAddress != nil:
+		req.PostalAddress.Normalize()
+		checkPostalAddress(&errs, "postal_address", req.PostalAddress)
+		if req.DeliveryAddress == "" {
+			req.DeliveryAddress = req.PostalAddress.String()
+		}
+	case req.DeliveryAddress == "":
+		errs.add("delivery_address", "delivery_address, postal_address or address_id is required")
+	}
+	switch {
+	case (req.DeliveryLat == nil) != (req.DeliveryLng == nil):
+		errs.add("delivery_lat", "delivery_lat and delivery_lng must be provided together")
+	case req.DeliveryLat != nil && !models.ValidCoordinates(*req.DeliveryLat, *req.DeliveryLng):
+		errs.add("delivery_lat", "delivery_lat must be within ±90 and delivery_lng within ±180")
+	}
+	paymentMethod, ok := models.ParsePaymentMethod(req.PaymentMethod)
+	switch {
+	case paymentMethod == "":
+		errs.add("payment_method", "payment_method is required")
+	case !ok:
+		errs.add("payment_method", "payment_method must be one of cash, card or wallet")
+	}
+	if req.Tip < 0 {
+		errs.add("tip", "tip cannot be negative")
+	}
+	now := time.Now()
+	placeAt := now
+	if req.ScheduledFor != nil {
+		placeAt = req.ScheduledFor.UTC()
+		switch {
+		case !statemachine.IsKnownStatus(models.StatusScheduled):
+			errs.add("scheduled_for", "Scheduled orders are not enabled")
+		case !placeAt.After(now):
+			errs.add("scheduled_for", "scheduled_for must be in the future")
+		case placeAt.Sub(now) > models.MaxScheduleAhead:
+			errs.add("scheduled_for", fmt.Sprintf("Orders can be scheduled at most %s ahead", models.MaxScheduleAhead))
+		}
+	}
+	if errs.respond(w) {
 		return
 	}
 
-	// Verify the restaurant exists.
-	restaurant, err := h.Store.GetUser(req.RestaurantID)
+	// Verify the restaurant exists and is open when the order is placed.
+	restaurant, err := h.Store.GetUser(r.Context(), req.RestaurantID)
 	if err != nil || restaurant.Role != models.RoleRestaurant {
 		respondError(w, http.StatusBadRequest, "Invalid restaurant_id")
 		return
 	}
+	switch {
+	case restaurant.Settings.IsBlackedOut(placeAt) && req.ScheduledFor == nil:
+		respondError(w, http.StatusBadRequest, restaurant.Name+" is closed today and is not accepting orders")
+		return
+	case restaurant.Settings.IsBlackedOut(placeAt):
+		respondError(w, http.StatusBadRequest, restaurant.Name+" is closed on the requested day")
+		return
+	case !restaurant.Settings.IsOpenAt(placeAt):
+		respondError(w, http.StatusBadRequest, restaurant.Name+" is outside its opening hours at "+placeAt.In(restaurant.Settings.Location()).Format(models.TimeOfDayLayout))
+		return
+	}
 
-	// Look up each menu item and build order items.
-	var orderItems []models.OrderItem
-	var total float64
-	for _, ri := range req.Items {
-		if ri.Quantity <= 0 {
-			respondError(w, http.StatusBadRequest, "Quantity must be at least 1")
-			return
-		}
-		menuItem, err := h.Store.GetMenuItem(ri.MenuItemID)
+	// Look up each menu item and build order items. Scheduled orders must
+	// be orderable at their scheduled time.
+	orderItems, subtotal, invalid := h.buildOrderItems(r.Context(), restaurant, req.Items, placeAt)
+	if invalid != nil {
+		invalid.respond(w)
+		return
+	}
+
+	var coupon *models.Coupon
+	if code := models.NormalizeCouponCode(req.CouponCode); code != "" {
+		coupon, err = h.Store.GetCoupon(r.Context(), code)
 		if err != nil {
-			respondError(w, http.StatusBadRequest, "Menu item not found: "+ri.MenuItemID)
+			respondError(w, http.StatusBadRequest, "Invalid coupon code: "+code)
 			return
 		}
-		if menuItem.RestaurantID != req.RestaurantID {
-			respondError(w, http.StatusBadRequest, "Menu item "+menuItem.Name+" does not belong to this restaurant")
+		if err := coupon.CheckRedeemable(subtotal, now); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		if !menuItem.Available {
-			respondError(w, http.StatusBadRequest, "Menu item '"+menuItem.Name+"' is currently unavailable")
+	}
+
+	order := h.newPlacedOrder(userID, restaurant, orderItems, now)
+	order.DeliveryAddress = req.DeliveryAddress
+	order.PostalAddress = req.PostalAddress
+	order.DeliveryLat, order.DeliveryLng = req.DeliveryLat, req.DeliveryLng
+	h.geocodeDelivery(r.Context(), order)
+	order.ApplyPricing(h.Pricing, restaurant)
+	order.PaymentMethod = paymentMethod
+	order.Notes = req.Notes
+	if req.ScheduledFor != nil {
+		order.Status = models.StatusScheduled
+		order.StatusHistory[0].ToStatus = models.StatusScheduled
+		order.ScheduledFor = &placeAt
+		order.EstimatedDeliveryAt = h.ETA.AtCreation(placeAt, restaurant.Settings.PrepTime())
+	}
+	if coupon != nil {
+		order.Coupon = &models.AppliedCoupon{Code: coupon.Code, DiscountType: coupon.DiscountType, Value: coupon.Value}
+	}
+	order.SetTip(req.Tip)
+	order.SetSubtotal(subtotal)
+
+	// Prices may have changed since the customer saw the menu.
+	if req.ExpectedTotal != nil && math.Abs(*req.ExpectedTotal-order.TotalAmount) > totalTolerance {
+		respondErrorDetails(w, http.StatusConflict, CodeTotalChanged, "Order total has changed; please review and confirm the new total", map[string]interface{}{
+			"expected_total": *req.ExpectedTotal,
+			"total":          order.TotalAmount,
+		})
+		return
+	}
+
+	if err := payment.Authorize(r.Context(), h.Payments, order); err != nil {
+		respondErrorCode(w, http.StatusPaymentRequired, CodePaymentFailed, "Payment could not be authorized: "+err.Error())
+		return
+	}
+
+	// Redeem the coupon and save the order in one transaction, so a use is
+	// only counted for an order that exists. The usage limit was checked
+	// above, but a concurrent order may have taken the last use since.
+	redeemed := false
+	err = h.Store.WithTransaction(r.Context(), func(ctx context.Context) error {
+		if coupon != nil {
+			ok, err := h.Store.RedeemCoupon(ctx, coupon.Code)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errCouponUsedUp
+			}
+			redeemed = true
+		}
+		return h.saveNewOrder(ctx, order, restaurant)
+	})
+	if err != nil {
+		// Undo what the transaction could not, even if the client has gone.
+		ctx := context.WithoutCancel(r.Context())
+		if redeemed && !h.Store.SupportsTransactions() {
+			h.Store.ReleaseCoupon(ctx, coupon.Code)
+		}
+		if releaseErr := payment.Release(ctx, h.Payments, order); releaseErr != nil {
+			log.Printf("⚠️ payment: releasing hold for order %s: %v", order.ID, releaseErr)
+		}
+		if errors.Is(err, errCouponUsedUp) {
+			respondError(w, http.StatusConflict, "Coupon "+coupon.Code+" has reached its usage limit")
 			return
 		}
-		orderItems = append(orderItems, models.OrderItem{
-			MenuItemID: menuItem.ID,
-			Name:       menuItem.Name,
-			Quantity:   ri.Quantity,
-			Price:      menuItem.Price,
-		})
-		total += menuItem.Price * float64(ri.Quantity)
+		respondError(w, http.StatusInternalServerError, "Failed to save order")
+		return
+	}
+	h.Metrics.OrderCreated()
+
+	respondJSON(w, http.StatusCreated, order)
+}
+
+// Reorder handles POST /api/orders/{id}/reorder
+// Places a new order with the lines of one of the customer's delivered
+// orders, at current menu prices. Lines that can no longer be ordered are
+// left out and reported; if none remain the reorder fails. Coupons and tips
+// are not carried over.
+func (h *OrderHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	previous, err := h.Store.GetOrder(r.Context(), id)
+	if err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
+		return
+	}
+	if models.Role(role) != models.RoleCustomer || userID != previous.CustomerID {
+		respondError(w, http.StatusForbidden, "Only the order's customer can reorder it")
+		return
+	}
+	if previous.Status != models.StatusDelivered {
+		respondError(w, http.StatusConflict, "Only delivered orders can be reordered")
+		return
 	}
 
+	restaurant, err := h.Store.GetUser(r.Context(), previous.RestaurantID)
+	if err != nil || restaurant.Role != models.RoleRestaurant {
+		respondError(w, http.StatusConflict, "The restaurant is no longer available")
+		return
+	}
 	now := time.Now()
+	if !restaurant.Settings.IsOpenAt(now) {
+		respondError(w, http.StatusConflict, restaurant.Name+" is closed and is not accepting orders right now")
+		return
+	}
+
+	// Orders placed before payment methods were checked may use one that
+	// is no longer accepted.
+	paymentMethod, ok := models.ParsePaymentMethod(string(previous.PaymentMethod))
+	if !ok {
+		respondError(w, http.StatusConflict, "The order's payment method is no longer accepted; please place a new order")
+		return
+	}
+
+	var items []models.OrderItem
+	var subtotal float64
+	skipped := []models.SkippedItem{}
+	for _, line := range previous.Items {
+		item, err := h.buildOrderItem(r.Context(), restaurant, models.OrderItemRequest{
+			MenuItemID:          line.MenuItemID,
+			Quantity:            line.Quantity,
+			SpecialInstructions: line.SpecialInstructions,
+		}, now)
+		if err != nil {
+			skipped = append(skipped, models.SkippedItem{MenuItemID: line.MenuItemID, Name: line.Name, Reason: err.Error()})
+			continue
+		}
+		items = append(items, item)
+		subtotal += item.Price * float64(item.Quantity)
+	}
+	if len(items) == 0 {
+		respondErrorDetails(w, http.StatusConflict, CodeConflict, "None of the items from this order are available", map[string]interface{}{
+			"skipped_items": skipped,
+		})
+		return
+	}
+
+	order := h.newPlacedOrder(userID, restaurant, items, now)
+	order.DeliveryAddress = previous.DeliveryAddress
+	order.PostalAddress = previous.PostalAddress
+	order.DeliveryLat, order.DeliveryLng = previous.DeliveryLat, previous.DeliveryLng
+	h.geocodeDelivery(r.Context(), order)
+	order.ApplyPricing(h.Pricing, restaurant)
+	order.PaymentMethod = paymentMethod
+	order.Notes = previous.Notes
+	order.SetSubtotal(subtotal)
+
+	if err := payment.Authorize(r.Context(), h.Payments, order); err != nil {
+		respondErrorCode(w, http.StatusPaymentRequired, CodePaymentFailed, "Payment could not be authorized: "+err.Error())
+		return
+	}
+
+	if err := h.saveNewOrder(r.Context(), order, restaurant); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save order")
+		return
+	}
+	h.Metrics.OrderCreated()
+
+	respondJSON(w, http.StatusCreated, models.ReorderResponse{Order: order, SkippedItems: skipped})
+}
+
+// checkPostalAddress records problems with a normalized postal address
+// under field. Street, city and country are required; the postal code is
+// checked against the country's format when given.
+func checkPostalAddress(errs *validationErrors, field string, a *models.PostalAddress) {
+	parts := []struct{ name, value string }{
+		{"street", a.Street},
+		{"city", a.City},
+		{"postal_code", a.PostalCode},
+		{"country", a.Country},
+	}
+	for _, p := range parts {
+		switch {
+		case p.value == "" && p.name != "postal_code":
+			errs.add(field+"."+p.name, p.name+" is required")
+		case utf8.RuneCountInString(p.value) > models.MaxAddressPartLength:
+			errs.add(field+"."+p.name, fmt.Sprintf("%s must be at most %d characters", p.name, models.MaxAddressPartLength))
+		}
+	}
+	switch {
+	case a.Country != "" && !models.ValidCountryCode(a.Country):
+		errs.add(field+".country", "country must be a two-letter ISO 3166 code such as US")
+	case a.Country != "" && a.PostalCode != "" && !models.ValidPostalCode(a.Country, a.PostalCode):
+		errs.add(field+".postal_code", "postal_code is not a valid postal code for "+a.Country)
+	}
+}
+
+// itemError is why a requested line cannot be ordered.
+type itemError struct {
+	Status models.ItemStatus
+	// Name is the menu item's name, when it was found.
+	Name string
+	msg  string
+}
+
+func (e *itemError) Error() string {
+	return e.msg
+}
+
+// invalidItems reports the lines of an order that cannot be ordered, with
+// a check for every requested line so clients can fix them all at once.
+type invalidItems struct {
+	Items []models.ItemCheck
+}
+
+func (e *invalidItems) Error() string {
+	return e.errors().Error()
+}
+
+// errors lists each bad line as a field error on items[i].
+func (e *invalidItems) errors() validationErrors {
+	var errs validationErrors
+	for _, check := range e.Items {
+		if check.Status != models.ItemOK {
+			errs.add(fmt.Sprintf("items[%d]", check.Index), check.Reason)
+		}
+	}
+	return errs
+}
+
+// respond writes a 400 like validationErrors.respond, adding every line's
+// check under "items".
+func (e *invalidItems) respond(w http.ResponseWriter) {
+	errs := e.errors()
+	respondErrorDetails(w, http.StatusBadRequest, CodeValidationFailed, errs[0].Message, map[string]interface{}{
+		"errors": errs,
+		"items":  e.Items,
+	})
+}
+
+// buildOrderItems prices every requested line with buildOrderItem and
+// returns the lines with their total. If any line cannot be ordered, every
+// line is still checked and none are returned.
+func (h *OrderHandler) buildOrderItems(ctx context.Context, restaurant *models.User, reqItems []models.OrderItemRequest, now time.Time) ([]models.OrderItem, float64, *invalidItems) {
+	var orderItems []models.OrderItem
+	var total float64
+	checks := make([]models.ItemCheck, len(reqItems))
+	failed := false
+	for i, ri := range reqItems {
+		checks[i] = models.ItemCheck{Index: i, MenuItemID: ri.MenuItemID, Status: models.ItemOK}
+		orderItem, err := h.buildOrderItem(ctx, restaurant, ri, now)
+		if err != nil {
+			failed = true
+			checks[i].Name, checks[i].Status, checks[i].Reason = err.Name, err.Status, err.Error()
+			continue
+		}
+		checks[i].Name = orderItem.Name
+		orderItems = append(orderItems, orderItem)
+		total += orderItem.Price * float64(orderItem.Quantity)
+	}
+	if failed {
+		return nil, 0, &invalidItems{Items: checks}
+	}
+	return orderItems, total, nil
+}
+
+// buildOrderItem looks up a requested menu item on the restaurant's menu,
+// checks it can be ordered at now, expands bundles, and returns the order
+// line priced from the current menu.
+func (h *OrderHandler) buildOrderItem(ctx context.Context, restaurant *models.User, ri models.OrderItemRequest, now time.Time) (models.OrderItem, *itemError) {
+	if ri.Quantity <= 0 {
+		return models.OrderItem{}, &itemError{Status: models.ItemInvalidQuantity, msg: "Quantity must be at least 1"}
+	}
+	menuItem, err := h.Store.GetMenuItem(ctx, ri.MenuItemID)
+	if err != nil {
+		return models.OrderItem{}, &itemError{Status: models.ItemNotFound, msg: "Menu item not found: " + ri.MenuItemID}
+	}
+	if menuItem.RestaurantID != restaurant.ID {
+		return models.OrderItem{}, &itemError{Status: models.ItemWrongRestaurant, Name: menuItem.Name,
+			msg: fmt.Sprintf("Menu item %s does not belong to this restaurant", menuItem.Name)}
+	}
+	if !menuItem.IsAvailableAt(now, restaurant.Settings.Location()) {
+		return models.OrderItem{}, &itemError{Status: models.ItemUnavailable, Name: menuItem.Name,
+			msg: fmt.Sprintf("Menu item '%s' is currently unavailable", menuItem.Name)}
+	}
+	orderItem := models.OrderItem{
+		MenuItemID:          menuItem.ID,
+		Name:                menuItem.Name,
+		Quantity:            ri.Quantity,
+		Price:               menuItem.Price,
+		Description:         menuItem.Description,
+		Category:            menuItem.Category,
+		MenuItemVersion:     menuItem.Version,
+		SpecialInstructions: ri.SpecialInstructions,
+	}
+	if menuItem.IsBundle() {
+		// Expand the bundle so the kitchen sees every component, while
+		// the line is still charged at the bundle price.
+		for _, componentID := range menuItem.ComponentIDs {
+			component, err := h.Store.GetMenuItem(ctx, componentID)
+			if err != nil || !component.IsAvailableAt(now, restaurant.Settings.Location()) {
+				return models.OrderItem{}, &itemError{Status: models.ItemUnavailable, Name: menuItem.Name,
+					msg: fmt.Sprintf("Bundle '%s' is currently unavailable", menuItem.Name)}
+			}
+			orderItem.Components = append(orderItem.Components, models.BundleComponent{
+				MenuItemID: component.ID,
+				Name:       component.Name,
+				Price:      component.Price,
+			})
+		}
+	}
+	return orderItem, nil
+}
+
+// newPlacedOrder builds a PLACED order for the customer with the given
+// lines. The caller sets the delivery address and coordinates, applies the
+// handler's current pricing, sets any coupon and tip and then calls
+// SetSubtotal.
+func (h *OrderHandler) newPlacedOrder(customerID string, restaurant *models.User, items []models.OrderItem, now time.Time) *models.Order {
 	order := &models.Order{
-		ID:              uuid.New().String(),
-		CustomerID:      userID,
-		RestaurantID:    req.RestaurantID,
-		Items:           orderItems,
-		TotalAmount:     total,
-		Status:          models.StatusPlaced,
-		DeliveryAddress: req.DeliveryAddress,
-		PaymentMethod:   req.PaymentMethod,
+		ID:           uuid.New().String(),
+		CustomerID:   customerID,
+		RestaurantID: restaurant.ID,
+		Items:        items,
+		Status:       models.StatusPlaced,
 		StatusHistory: []models.StatusChange{
 			{
 				FromStatus: "",
 				ToStatus:   models.StatusPlaced,
-				ChangedBy:  userID,
+				ChangedBy:  customerID,
 				Role:       models.RoleCustomer,
 				Timestamp:  now,
 			},
 		},
-		CreatedAt: now,
-		UpdatedAt: now,
+		EstimatedDeliveryAt: h.ETA.AtCreation(now, restaurant.Settings.PrepTime()),
+		PaymentStatus:       models.PaymentPending,
+		CreatedAt:           now,
+		UpdatedAt:           now,
 	}
+	return order
+}
 
-	if err := h.Store.SaveOrder(order); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to save order")
+// geocodeDelivery locates a new order's delivery address when it has no
+// coordinates. A failed lookup is logged and the order goes ahead with the
+// flat delivery fee.
+func (h *OrderHandler) geocodeDelivery(ctx context.Context, order *models.Order) {
+	if h.Geocoder == nil || order.DeliveryLat != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, geocodeTimeout)
+	defer cancel()
+	p, err := h.Geocoder.Geocode(ctx, order.DeliveryAddress)
+	if err == nil && !models.ValidCoordinates(p.Lat, p.Lng) {
+		err = fmt.Errorf("geocoder returned out-of-range coordinates %v, %v", p.Lat, p.Lng)
+	}
+	if err != nil {
+		log.Printf("⚠️ geocode: locating order %s: %v", order.ID, err)
 		return
 	}
+	order.DeliveryLat, order.DeliveryLng = &p.Lat, &p.Lng
+}
 
-	respondJSON(w, http.StatusCreated, order)
+// saveNewOrder numbers a new order in the restaurant's sequence and saves
+// it. It may run inside a transaction, so callers count the order once it
+// has been committed.
+func (h *OrderHandler) saveNewOrder(ctx context.Context, order *models.Order, restaurant *models.User) error {
+	seq, err := h.Store.NextOrderSequence(ctx, restaurant.ID)
+	if err != nil {
+		return err
+	}
+	order.OrderNumber = fmt.Sprintf("%s%05d", restaurant.Settings.OrderNumberPrefix(), seq)
+	return h.Store.SaveOrder(ctx, order)
 }
 
-// GetOrder handles GET /api/orders/{id}
-func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+// GetOrderItems handles GET /api/orders/{id}/items
+// Returns the order's lines exactly as they were priced when ordered,
+// regardless of later menu changes.
+func (h *OrderHandler) GetOrderItems(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	order, err := h.Store.GetOrder(id)
-	if err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	snapshot, err := h.Store.GetOrderSnapshot(r.Context(), id)
+	if !orderFound(w, err) {
+		return
+	}
+	parties := &models.Order{CustomerID: snapshot.CustomerID, RestaurantID: snapshot.RestaurantID, DriverID: snapshot.DriverID}
+	if !canViewOrder(parties, userID, models.Role(role)) {
+		respondError(w, http.StatusForbidden, "You are not a party to this order")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, snapshot)
+}
+
+// GetOrder handles GET /api/orders/{id}
+// The order embeds a copy of each line's menu details, so it always shows
+// the order as placed, not the current menu.
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.viewableOrder(w, r)
+	if !ok {
 		return
 	}
 
@@ -139,10 +651,42 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 // ListOrders handles GET /api/orders
-// Supports optional ?status= query parameter for filtering.
+// Supports optional ?status=, ?customer_id=, ?restaurant_id=, ?driver_id=,
+// ?item=, ?created_after= and ?created_before= query parameters, which are
+// combined, and ?sort= (default created_at:desc).
+// Results are always scoped to the caller: customers and restaurants see
+// their own orders, drivers see their deliveries plus orders awaiting pickup,
+// and admins see everything.
 func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
-	statusFilter := models.OrderStatus(r.URL.Query().Get("status"))
-	orders, err := h.Store.ListOrders(statusFilter)
+	role := models.Role(r.Context().Value(ContextKeyUserRole).(string))
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if !role.IsValid() {
+		respondError(w, http.StatusForbidden, "Unknown role: "+string(role))
+		return
+	}
+
+	q := r.URL.Query()
+	filter := db.OrderFilter{
+		Status:       models.OrderStatus(q.Get("status")),
+		CustomerID:   q.Get("customer_id"),
+		RestaurantID: q.Get("restaurant_id"),
+		DriverID:     q.Get("driver_id"),
+		Item:         strings.TrimSpace(q.Get("item")),
+		ScopeRole:    role,
+		ScopeUserID:  userID,
+	}
+	if err := parseCreatedRange(q, &filter); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sortBy, err := parseSort(q, orderSortFields)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Sort = sortBy
+	orders, err := h.Store.ListOrders(r.Context(), filter)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to fetch orders")
 		return
@@ -150,6 +694,145 @@ func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, orders)
 }
 
+// parseCreatedRange reads the optional ?created_after= and ?created_before=
+// RFC3339 bounds into filter.
+func parseCreatedRange(q url.Values, filter *db.OrderFilter) error {
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("%s must be an RFC3339 timestamp", p.name)
+		}
+		*p.dst = t
+	}
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && !filter.CreatedAfter.Before(filter.CreatedBefore) {
+		return fmt.Errorf("created_after must be before created_before")
+	}
+	return nil
+}
+
+// BatchOrders handles POST /api/orders/batch
+// Returns the current status and a few key fields of up to
+// models.MaxBatchOrderIDs orders in one call, in request order. IDs that do
+// not exist or belong to orders the caller is not a party to are listed in
+// unavailable, without saying which. Admins may see every order.
+func (h *OrderHandler) BatchOrders(w http.ResponseWriter, r *http.Request) {
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	var req models.BatchOrdersRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	var errs validationErrors
+	if len(req.IDs) == 0 {
+		errs.add("ids", "At least one order ID is required")
+	}
+	if len(req.IDs) > models.MaxBatchOrderIDs {
+		errs.add("ids", fmt.Sprintf("At most %d order IDs are allowed", models.MaxBatchOrderIDs))
+	}
+	if errs.respond(w) {
+		return
+	}
+
+	// Repeated IDs are answered once.
+	seen := make(map[string]bool, len(req.IDs))
+	ids := make([]string, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	orders, err := h.Store.GetOrderBriefs(r.Context(), ids)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to fetch orders")
+		return
+	}
+	byID := make(map[string]*models.Order, len(orders))
+	for _, order := range orders {
+		if canViewOrder(order, userID, models.Role(role)) {
+			byID[order.ID] = order
+		}
+	}
+
+	resp := models.BatchOrdersResponse{Orders: []models.OrderBrief{}, Unavailable: []string{}}
+	for _, id := range ids {
+		if order, ok := byID[id]; ok {
+			resp.Orders = append(resp.Orders, order.Brief())
+		} else {
+			resp.Unavailable = append(resp.Unavailable, id)
+		}
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// GetDriverQueue handles GET /api/orders/driver-queue
+// Returns unclaimed orders awaiting pickup plus the driver's own active
+// deliveries, oldest-ready first.
+func (h *OrderHandler) GetDriverQueue(w http.ResponseWriter, r *http.Request) {
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleDriver {
+		respondError(w, http.StatusForbidden, "Only drivers can view the driver queue")
+		return
+	}
+
+	orders, err := h.Store.ListDriverQueue(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to fetch driver queue")
+		return
+	}
+
+	restaurants := make(map[string]*models.User)
+	queue := make([]models.DriverQueueEntry, 0, len(orders))
+	for _, order := range orders {
+		restaurant, ok := restaurants[order.RestaurantID]
+		if !ok {
+			restaurant, _ = h.Store.GetUser(r.Context(), order.RestaurantID)
+			restaurants[order.RestaurantID] = restaurant
+		}
+		entry := models.DriverQueueEntry{
+			Order:   order,
+			ReadyAt: readyAt(order),
+			Claimed: order.DriverID == userID,
+		}
+		if restaurant != nil {
+			entry.RestaurantName = restaurant.Name
+			entry.PickupAddress = restaurant.Address
+		}
+		queue = append(queue, entry)
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		return queue[i].ReadyAt.Before(queue[j].ReadyAt)
+	})
+
+	respondJSON(w, http.StatusOK, queue)
+}
+
+// readyAt returns when the order entered READY_FOR_PICKUP, falling back to
+// its last update time if the history has no such entry.
+func readyAt(order *models.Order) time.Time {
+	for i := len(order.StatusHistory) - 1; i >= 0; i-- {
+		if order.StatusHistory[i].ToStatus == models.StatusReadyForPickup {
+			return order.StatusHistory[i].Timestamp
+		}
+	}
+	return order.UpdatedAt
+}
+
 // UpdateOrderStatus handles PATCH /api/orders/{id}/status
 // Validates the transition using the state machine and role permissions.
 func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
@@ -159,18 +842,42 @@ func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 	role := r.Context().Value(ContextKeyUserRole).(string)
 	userID := r.Context().Value(ContextKeyUserID).(string)
 
-	order, err := h.Store.GetOrder(id)
+	order, err := h.Store.GetOrder(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
 		return
 	}
 
+	// Only the order's parties may change its status. The one exception is
+	// a driver picking up an order nobody has claimed yet.
+	unclaimed := models.Role(role) == models.RoleDriver && order.DriverID == "" && order.Status == models.StatusReadyForPickup
+	if !isOrderParty(order, userID) && !unclaimed {
+		respondError(w, http.StatusForbidden, "You are not a party to this order")
+		return
+	}
+
+	var body json.RawMessage
+	if !decodeJSON(w, r, &body) {
+		return
+	}
 	var req models.UpdateStatusRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+	if err := decodeUpdateStatusRequest(body, models.Role(role), &req); err != nil {
+		err.respond(w)
 		return
 	}
 
+	// A retried request whose transition was already recorded is a no-op.
+	// Only the caller's own changes match, so a driver let through above to
+	// claim the order cannot read it back by replaying someone else's ID.
+	if req.TransitionID != "" {
+		for _, change := range order.StatusHistory {
+			if change.TransitionID == req.TransitionID && change.ChangedBy == userID {
+				respondJSON(w, http.StatusOK, order)
+				return
+			}
+		}
+	}
+
 	// Validate the state transition using the state machine.
 	if err := statemachine.ValidateTransition(order.Status, req.Status, models.Role(role)); err != nil {
 		// Determine if it's a role permission issue (403) or invalid transition (400).
@@ -183,68 +890,1438 @@ func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request)
 		}
 
 		if allRoleErr == nil {
-			respondError(w, http.StatusForbidden, err.Error())
+			respondErrorCode(w, http.StatusForbidden, CodeTransitionForbidden, err.Error())
 		} else {
-			respondError(w, http.StatusBadRequest, err.Error())
+			respondErrorCode(w, http.StatusBadRequest, CodeInvalidTransition, err.Error())
 		}
 		return
 	}
 
-	// Assign driver if transitioning to PICKED_UP.
-	if req.Status == models.StatusPickedUp && order.DriverID == "" {
-		order.DriverID = userID
+	// Restaurants must justify cancellations; customers may leave it blank.
+	req.CancellationReason = strings.TrimSpace(req.CancellationReason)
+	if req.Status == models.StatusCancelled && models.Role(role) == models.RoleRestaurant && req.CancellationReason == "" {
+		respondError(w, http.StatusBadRequest, "cancellation_reason is required when a restaurant cancels an order")
+		return
 	}
 
-	// Record the status change.
-	now := time.Now()
-	order.StatusHistory = append(order.StatusHistory, models.StatusChange{
-		FromStatus: order.Status,
-		ToStatus:   req.Status,
-		ChangedBy:  userID,
-		Role:       models.Role(role),
-		Timestamp:  now,
-	})
+	// Rejections always carry the restaurant's reason.
+	req.RejectionReason = strings.TrimSpace(req.RejectionReason)
+	if req.Status == models.StatusRejected && req.RejectionReason == "" {
+		respondError(w, http.StatusBadRequest, "rejection_reason is required to reject an order")
+		return
+	}
+	if req.Status != models.StatusRejected && req.RejectionReason != "" {
+		respondError(w, http.StatusBadRequest, "rejection_reason can only be set when rejecting an order")
+		return
+	}
 
-	order.Status = req.Status
-	order.UpdatedAt = now
-	if err := h.Store.SaveOrder(order); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update order")
+	req.Note = strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(req.Note) > models.MaxStatusNoteLength {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("note must be at most %d characters", models.MaxStatusNoteLength))
 		return
 	}
 
-	respondJSON(w, http.StatusOK, order)
+	if req.PrepMinutes != nil {
+		if req.Status != models.StatusConfirmed {
+			respondError(w, http.StatusBadRequest, "prep_minutes can only be set when confirming an order")
+			return
+		}
+		if *req.PrepMinutes < 1 || *req.PrepMinutes > models.MaxPrepMinutes {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("prep_minutes must be between 1 and %d", models.MaxPrepMinutes))
+			return
+		}
+	}
+
+	now := time.Now()
+
+	// A revert undoes the most recent change, restoring the order as it was,
+	// so none of the side effects of entering the status apply again.
+	revert := statemachine.IsRevert(order.Status, req.Status)
+	if revert {
+		if status, err := h.checkRevert(order, req.Status, now); err != nil {
+			respondError(w, status, err.Error())
+			return
+		}
+	}
+
+	// Restaurants that require per-item confirmation must account for every
+	// line item when accepting. Unavailable items are dropped from the order;
+	// if nothing is left the order is cancelled right after confirmation.
+	cancelAfterConfirm := false
+	if req.Status == models.StatusConfirmed && !revert {
+		restaurant, err := h.Store.GetUser(r.Context(), order.RestaurantID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to load restaurant")
+			return
+		}
+		if restaurant.Settings != nil && restaurant.Settings.RequireItemConfirmation {
+			if req.ItemConfirmation == nil {
+				respondError(w, http.StatusBadRequest, "item_confirmation is required to accept this order")
+				return
+			}
+			if err := applyItemConfirmation(order, req.ItemConfirmation); err != nil {
+				respondError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			req.ItemConfirmation.ConfirmedBy = userID
+			req.ItemConfirmation.ConfirmedAt = &now
+			order.ItemConfirmation = req.ItemConfirmation
+			cancelAfterConfirm = len(order.Items) == 0
+		}
+
+		// The restaurant's estimate for this order replaces the guess made at
+		// creation. Without one, its default prep time is used if it has one.
+		prep := restaurant.Settings.PrepTime()
+		if req.PrepMinutes != nil {
+			prep = time.Duration(*req.PrepMinutes) * time.Minute
+		}
+		if prep > 0 {
+			order.PrepMinutes = int(prep / time.Minute)
+			order.EstimatedDeliveryAt = h.ETA.AtConfirmation(now, prep)
+		}
+	}
+
+	// Kitchen prep tracking starts with every line pending.
+	if req.Status == models.StatusPreparing && !revert {
+		for i := range order.Items {
+			order.Items[i].PrepStatus = models.PrepPending
+		}
+		order.ItemsReady = false
+	}
+
+	// Customers may cancel free of charge within the grace period. After
+	// it, cancelling is refused or owes the restaurant a fee. Scheduled
+	// orders have not been placed yet, so the window has not started.
+	if req.Status == models.StatusCancelled && models.Role(role) == models.RoleCustomer {
+		late := h.CancelGracePeriod > 0 && order.Status != models.StatusScheduled && now.Sub(placedAt(order)) > h.CancelGracePeriod
+		if late && h.BlockLateCancels {
+			respondErrorCode(w, http.StatusConflict, CodeCancelWindowClosed, fmt.Sprintf("Orders can only be cancelled within %s of being placed; please contact the restaurant", h.CancelGracePeriod))
+			return
+		}
+		if late || h.CancelGracePeriod == 0 {
+			order.SetCancellationFee(h.CancellationFees.FeeFor(order.Status, order.TotalAmount))
+		}
+	}
+
+	// Once the driver leaves, only travel time remains.
+	if req.Status == models.StatusOutForDelivery {
+		order.EstimatedDeliveryAt = h.ETA.AtDispatch(now)
+	}
+
+	// Picking up implicitly claims an unassigned order, using the same
+	// conditional update as AssignDriver so a concurrent claim is not
+	// overwritten. An order claimed by someone else cannot be picked up.
+	if req.Status == models.StatusPickedUp {
+		if order.DriverID == "" {
+			if !h.requireAvailableDriver(w, r, userID) {
+				return
+			}
+			claim := auditEntry(r, "driver_id", nil, userID, now)
+			claimed, err := h.Store.ClaimOrder(r.Context(), order.ID, userID, claim)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "Failed to assign driver")
+				return
+			}
+			if !claimed {
+				respondError(w, http.StatusConflict, "Order has already been claimed by another driver")
+				return
+			}
+			// Saving the order below must keep the claim's audit entry.
+			order.DriverID = userID
+			order.RecordAudit(claim)
+		} else if order.DriverID != userID {
+			respondError(w, http.StatusConflict, "Order has already been claimed by another driver")
+			return
+		}
+	}
+
+	// Record the status change.
+	original := order.Status
+	historyLen := len(order.StatusHistory)
+	change := models.StatusChange{
+		FromStatus:   order.Status,
+		ToStatus:     req.Status,
+		ChangedBy:    userID,
+		Role:         models.Role(role),
+		Timestamp:    now,
+		TransitionID: req.TransitionID,
+		Note:         req.Note,
+		Reverted:     revert,
+	}
+	if req.Status == models.StatusCancelled {
+		change.CancellationReason = req.CancellationReason
+		order.CancellationReason = req.CancellationReason
+	}
+	if req.Status == models.StatusRejected {
+		change.RejectionReason = req.RejectionReason
+		order.RejectionReason = req.RejectionReason
+	}
+	order.StatusHistory = append(order.StatusHistory, change)
+	order.Status = req.Status
+
+	if cancelAfterConfirm {
+		if err := statemachine.ValidateTransition(order.Status, models.StatusCancelled, models.Role(role)); err == nil {
+			const reason = "None of the ordered items are available"
+			order.StatusHistory = append(order.StatusHistory, models.StatusChange{
+				FromStatus:         order.Status,
+				ToStatus:           models.StatusCancelled,
+				ChangedBy:          userID,
+				Role:               models.Role(role),
+				Timestamp:          now,
+				CancellationReason: reason,
+			})
+			order.Status = models.StatusCancelled
+			order.CancellationReason = reason
+		}
+	}
+
+	// Cash is collected on delivery.
+	if order.Status == models.StatusDelivered && order.PaymentMethod == models.PaymentCash && order.IsPaymentPending() {
+		order.RecordAudit(auditEntry(r, "payment_status", order.PaymentStatus, models.PaymentPaid, now))
+		order.PaymentStatus = models.PaymentPaid
+	}
+
+	// The order may have changed status while we were working; that change
+	// wins, and nothing below may run for this one.
+	order.UpdatedAt = now
+	saved, err := h.Store.ReplaceOrderIfStatus(r.Context(), order, original)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update order")
+		return
+	}
+	if !saved {
+		respondError(w, http.StatusConflict, "Order status changed concurrently; reload and try again")
+		return
+	}
+
+	h.settlePayment(r, order, userID, models.Role(role), now)
+
+	h.notifyStatusChanges(r.Context(), order, order.StatusHistory[historyLen:])
+
+	respondJSON(w, http.StatusOK, order)
+}
+
+// settlePayment settles an order that has just reached its final status:
+// card intents are captured on delivery, and cancelled or rejected orders
+// are refunded. It runs only once the status change is saved, so an order
+// that moved on concurrently is never charged or refunded. A failed capture
+// or refund does not undo the status change; it is logged and can be
+// retried with UpdatePayment.
+func (h *OrderHandler) settlePayment(r *http.Request, order *models.Order, userID string, role models.Role, now time.Time) {
+	before := order.PaymentStatus
+	switch order.Status {
+	case models.StatusDelivered:
+		if err := payment.Capture(r.Context(), h.Payments, order, userID, role, now); err != nil {
+			log.Printf("⚠️ payment: capturing order %s: %v", order.ID, err)
+			return
+		}
+	case models.StatusCancelled, models.StatusRejected:
+		if err := payment.Refund(r.Context(), h.Payments, order, userID, role, now); err != nil {
+			log.Printf("⚠️ payment: refunding order %s: %v", order.ID, err)
+			return
+		}
+	default:
+		return
+	}
+	if order.PaymentStatus == before {
+		return
+	}
+	if _, err := h.Store.ReplaceOrderIfStatus(r.Context(), order, order.Status); err != nil {
+		log.Printf("⚠️ payment: saving payment for order %s: %v", order.ID, err)
+	}
+}
+
+// OverrideStatus handles POST /api/admin/orders/{id}/status
+// Admin only. Forces the order into any known status, bypassing the state
+// machine and its side effects. The history entry records the admin, the
+// original status and the reason.
+func (h *OrderHandler) OverrideStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	var req models.OverrideStatusRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	var errs validationErrors
+	if !statemachine.IsKnownStatus(req.Status) {
+		errs.add("status", "Unknown status: "+string(req.Status))
+	}
+	if req.Reason == "" {
+		errs.add("reason", "reason is required for an override")
+	}
+	if errs.respond(w) {
+		return
+	}
+
+	order, err := h.Store.GetOrder(r.Context(), id)
+	if err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
+		return
+	}
+	original := order.Status
+	if req.Status == original {
+		respondError(w, http.StatusConflict, "Order is already "+string(original))
+		return
+	}
+
+	now := time.Now()
+	change := models.StatusChange{
+		FromStatus: original,
+		ToStatus:   req.Status,
+		ChangedBy:  userID,
+		Role:       models.RoleAdmin,
+		Timestamp:  now,
+		Override:   true,
+		Reason:     req.Reason,
+	}
+	switch req.Status {
+	case models.StatusCancelled:
+		change.CancellationReason = req.Reason
+		order.CancellationReason = req.Reason
+	case models.StatusRejected:
+		change.RejectionReason = req.Reason
+		order.RejectionReason = req.Reason
+	}
+	order.StatusHistory = append(order.StatusHistory, change)
+	order.Status = req.Status
+	order.UpdatedAt = now
+
+	saved, err := h.Store.ReplaceOrderIfStatus(r.Context(), order, original)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update order")
+		return
+	}
+	if !saved {
+		respondError(w, http.StatusConflict, "Order status changed concurrently; reload and try again")
+		return
+	}
+
+	h.notifyStatusChanges(r.Context(), order, []models.StatusChange{change})
+
+	respondJSON(w, http.StatusOK, order)
+}
+
+// checkRevert verifies that moving the order back to status undoes its
+// most recent change, within RevertWindow and before a driver is involved.
+// It returns the HTTP status to respond with when the revert is refused.
+func (h *OrderHandler) checkRevert(order *models.Order, status models.OrderStatus, now time.Time) (int, error) {
+	if len(order.StatusHistory) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("order has no status change to revert")
+	}
+	last := order.StatusHistory[len(order.StatusHistory)-1]
+	if last.FromStatus != status || last.ToStatus != order.Status {
+		return http.StatusBadRequest, fmt.Errorf("only the most recent status change can be reverted; the order did not move from '%s' to '%s'", status, order.Status)
+	}
+	if now.Sub(last.Timestamp) > h.RevertWindow {
+		return http.StatusForbidden, fmt.Errorf("the change to '%s' can only be reverted within %s", order.Status, h.RevertWindow)
+	}
+	if order.DriverID != "" {
+		return http.StatusConflict, fmt.Errorf("a driver has already claimed this order")
+	}
+	return 0, nil
+}
+
+// notifyStatusChanges publishes each change to the order's stream
+// subscribers, alerts drivers when the order becomes ready for pickup, and
+// posts each change to the restaurant's webhook, if one is registered.
+// Alerts and webhook delivery happen in the background.
+func (h *OrderHandler) notifyStatusChanges(ctx context.Context, order *models.Order, changes []models.StatusChange) {
+	for _, change := range changes {
+		h.Events.Publish(order.ID, change)
+		if change.ToStatus == models.StatusReadyForPickup {
+			h.alertDrivers(ctx, order, change.Timestamp)
+		}
+	}
+	if h.Webhooks == nil || len(changes) == 0 {
+		return
+	}
+	// The changes are saved; notify even if the client has hung up.
+	restaurant, err := h.Store.GetUser(context.WithoutCancel(ctx), order.RestaurantID)
+	if err != nil || restaurant.Settings == nil || restaurant.Settings.WebhookURL == "" {
+		return
+	}
+	for _, change := range changes {
+		h.Webhooks.Send(restaurant.Settings.WebhookURL, webhook.Event{
+			OrderID:    order.ID,
+			FromStatus: change.FromStatus,
+			ToStatus:   change.ToStatus,
+			Timestamp:  change.Timestamp,
+			Role:       change.Role,
+		})
+	}
+}
+
+// alertDrivers tells drivers in the background that the order is ready:
+// its assigned driver if it has one, otherwise every available driver.
+func (h *OrderHandler) alertDrivers(ctx context.Context, order *models.Order, readyAt time.Time) {
+	if h.DriverAlerts == nil {
+		return
+	}
+	// The change is saved; alert even if the client has hung up.
+	ctx = context.WithoutCancel(ctx)
+	orderCopy := *order
+	go func() {
+		restaurant, err := h.Store.GetUser(ctx, orderCopy.RestaurantID)
+		if err != nil {
+			log.Printf("⚠️ pickup alert for order %s: loading restaurant: %v", orderCopy.ID, err)
+			return
+		}
+		driverIDs := []string{orderCopy.DriverID}
+		if orderCopy.DriverID == "" {
+			drivers, err := h.Store.ListAvailableDrivers(ctx)
+			if err != nil {
+				log.Printf("⚠️ pickup alert for order %s: listing drivers: %v", orderCopy.ID, err)
+				return
+			}
+			if len(drivers) == 0 {
+				log.Printf("⚠️ pickup alert for order %s: no drivers are available", orderCopy.ID)
+				return
+			}
+			driverIDs = make([]string, len(drivers))
+			for i, d := range drivers {
+				driverIDs[i] = d.ID
+			}
+		}
+		alert := notify.NewPickupAlert(&orderCopy, restaurant, driverIDs, readyAt)
+		if err := h.DriverAlerts.NotifyDrivers(alert); err != nil {
+			log.Printf("⚠️ pickup alert for order %s: %v", orderCopy.ID, err)
+		}
+	}()
+}
+
+// UpdateOrderItems handles PATCH /api/orders/{id}/items
+// Lets the customer add or remove items until the restaurant confirms. All
+// lines are re-priced from the current menu.
+func (h *OrderHandler) UpdateOrderItems(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	order, err := h.Store.GetOrder(r.Context(), id)
+	if err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
+		return
+	}
+	if models.Role(role) != models.RoleCustomer || userID != order.CustomerID {
+		respondError(w, http.StatusForbidden, "Only the order's customer can modify its items")
+		return
+	}
+	if order.Status != models.StatusPlaced {
+		respondError(w, http.StatusConflict, "Items can only be changed before the restaurant confirms the order")
+		return
+	}
+
+	var req models.UpdateOrderItemsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		respondError(w, http.StatusBadRequest, "Nothing to change; provide add or remove")
+		return
+	}
+
+	// Rebuild the request list from the current lines, then apply changes.
+	quantities := make(map[string]int, len(order.Items))
+	instructions := make(map[string]string, len(order.Items))
+	var lineOrder []string
+	for _, item := range order.Items {
+		if _, ok := quantities[item.MenuItemID]; !ok {
+			lineOrder = append(lineOrder, item.MenuItemID)
+		}
+		quantities[item.MenuItemID] += item.Quantity
+		if item.SpecialInstructions != "" {
+			instructions[item.MenuItemID] = item.SpecialInstructions
+		}
+	}
+	for _, menuItemID := range req.Remove {
+		if _, ok := quantities[menuItemID]; !ok {
+			respondError(w, http.StatusBadRequest, "Item not found in this order: "+menuItemID)
+			return
+		}
+		delete(quantities, menuItemID)
+	}
+	for _, add := range req.Add {
+		if add.Quantity <= 0 {
+			respondError(w, http.StatusBadRequest, "Quantity must be at least 1")
+			return
+		}
+		// New instructions for an item replace any it already had.
+		if note := models.CleanNote(add.SpecialInstructions); note != "" {
+			if utf8.RuneCountInString(note) > models.MaxItemInstructionsLength {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("special_instructions must be at most %d characters", models.MaxItemInstructionsLength))
+				return
+			}
+			instructions[add.MenuItemID] = note
+		}
+		if _, ok := quantities[add.MenuItemID]; !ok {
+			lineOrder = append(lineOrder, add.MenuItemID)
+		}
+		quantities[add.MenuItemID] += add.Quantity
+	}
+	var reqItems []models.OrderItemRequest
+	for _, menuItemID := range lineOrder {
+		if qty, ok := quantities[menuItemID]; ok {
+			reqItems = append(reqItems, models.OrderItemRequest{
+				MenuItemID:          menuItemID,
+				Quantity:            qty,
+				SpecialInstructions: instructions[menuItemID],
+			})
+		}
+	}
+	if len(reqItems) == 0 {
+		respondError(w, http.StatusBadRequest, "An order must keep at least one item; cancel it instead")
+		return
+	}
+
+	restaurant, err := h.Store.GetUser(r.Context(), order.RestaurantID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load restaurant")
+		return
+	}
+	now := time.Now()
+	items, subtotal, invalid := h.buildOrderItems(r.Context(), restaurant, reqItems, now)
+	if invalid != nil {
+		invalid.respond(w)
+		return
+	}
+
+	previousTotal := order.TotalAmount
+	previousGrandTotal := order.GrandTotal()
+	order.RecordAudit(auditEntry(r, "items", models.ItemSummary(order.Items), models.ItemSummary(items), now))
+	order.Items = items
+	order.SetSubtotal(subtotal)
+	if order.TotalAmount != previousTotal {
+		order.RecordAudit(auditEntry(r, "total_amount", previousTotal, order.TotalAmount, now))
+	}
+	order.ItemChanges = append(order.ItemChanges, models.ItemChange{
+		Added:         req.Add,
+		Removed:       req.Remove,
+		PreviousTotal: previousTotal,
+		NewTotal:      order.TotalAmount,
+		ChangedBy:     userID,
+		Timestamp:     now,
+	})
+	order.UpdatedAt = now
+
+	// A card hold covers the grand total at the time it was placed, so a
+	// new total needs a new hold; the old one is released once the change
+	// is saved.
+	var previousIntent string
+	if order.GrandTotal() != previousGrandTotal {
+		previousIntent, err = payment.Reauthorize(r.Context(), h.Payments, order)
+		if err != nil {
+			respondErrorCode(w, http.StatusPaymentRequired, CodePaymentFailed, "Payment could not be authorized: "+err.Error())
+			return
+		}
+	}
+
+	// The restaurant may confirm while we were working; its change wins.
+	saved, err := h.Store.ReplaceOrderIfStatus(r.Context(), order, models.StatusPlaced)
+	if err != nil || !saved {
+		if previousIntent != "" {
+			if releaseErr := payment.Release(r.Context(), h.Payments, order); releaseErr != nil {
+				log.Printf("⚠️ payment: releasing hold for order %s: %v", order.ID, releaseErr)
+			}
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to update order")
+			return
+		}
+		respondError(w, http.StatusConflict, "Items can only be changed before the restaurant confirms the order")
+		return
+	}
+	if err := payment.ReleaseIntent(r.Context(), h.Payments, previousIntent); err != nil {
+		log.Printf("⚠️ payment: releasing previous hold for order %s: %v", order.ID, err)
+	}
+
+	respondJSON(w, http.StatusOK, order)
+}
+
+// UpdateItemPrep handles PATCH /api/orders/{id}/items/{itemId}/prep
+// Lets the restaurant mark individual lines pending or ready while the order
+// is PREPARING. itemId is the line's menu_item_id.
+func (h *OrderHandler) UpdateItemPrep(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	itemID := vars["itemId"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	order, err := h.Store.GetOrder(r.Context(), id)
+	if err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
+		return
+	}
+	if models.Role(role) != models.RoleRestaurant || userID != order.RestaurantID {
+		respondError(w, http.StatusForbidden, "Only the order's restaurant can track preparation")
+		return
+	}
+	if order.Status != models.StatusPreparing {
+		respondError(w, http.StatusConflict, "Item preparation can only be updated while the order is PREPARING")
+		return
+	}
+
+	var req models.UpdateItemPrepRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !req.Status.IsValid() {
+		respondError(w, http.StatusBadRequest, "status must be one of: pending, ready")
+		return
+	}
+
+	found := false
+	var previous models.PrepStatus
+	for _, item := range order.Items {
+		if item.MenuItemID == itemID {
+			previous = item.PrepStatus
+			found = true
+		}
+	}
+	if !found {
+		respondError(w, http.StatusNotFound, "Item not found in this order")
+		return
+	}
+	if previous == req.Status {
+		respondJSON(w, http.StatusOK, order)
+		return
+	}
+
+	// Only this line is written, so stations working on other lines at the
+	// same time do not overwrite each other. The order may have moved on
+	// from PREPARING meanwhile; that change wins.
+	audit := auditEntry(r, "items."+itemID+".prep_status", previous, req.Status, time.Now())
+	updated, err := h.Store.SetItemPrepStatus(r.Context(), order.ID, itemID, req.Status, audit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update order")
+		return
+	}
+	if !updated {
+		respondError(w, http.StatusConflict, "Item preparation can only be updated while the order is PREPARING")
+		return
+	}
+
+	order, err = h.Store.GetOrder(r.Context(), order.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load order")
+		return
+	}
+	respondJSON(w, http.StatusOK, order)
+}
+
+// AssignDriver handles POST /api/orders/{id}/assign
+// Lets a driver claim an unassigned READY_FOR_PICKUP order. Returns 409 if
+// another driver got there first.
+func (h *OrderHandler) AssignDriver(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleDriver {
+		respondError(w, http.StatusForbidden, "Only drivers can claim orders")
+		return
+	}
+	if !h.requireAvailableDriver(w, r, userID) {
+		return
+	}
+
+	claimed, err := h.Store.ClaimOrder(r.Context(), id, userID, auditEntry(r, "driver_id", nil, userID, time.Now()))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to assign driver")
+		return
+	}
+
+	order, err := h.Store.GetOrder(r.Context(), id)
+	if err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
+		return
+	}
+	if !claimed {
+		switch {
+		case order.DriverID == userID:
+			// Already ours — treat a repeated claim as success.
+		case order.DriverID != "":
+			respondError(w, http.StatusConflict, "Order has already been claimed by another driver")
+			return
+		default:
+			respondError(w, http.StatusConflict, "Only READY_FOR_PICKUP orders can be claimed; order is "+string(order.Status))
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, order)
+}
+
+// requireAvailableDriver answers 409 and returns false unless the driver
+// has marked themselves available.
+func (h *OrderHandler) requireAvailableDriver(w http.ResponseWriter, r *http.Request, driverID string) bool {
+	driver, err := h.Store.GetUser(r.Context(), driverID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load driver")
+		return false
+	}
+	if !driver.IsAvailable() {
+		respondErrorCode(w, http.StatusConflict, CodeDriverUnavailable, "Set yourself available before claiming orders")
+		return false
+	}
+	return true
+}
+
+// RateOrder handles POST /api/orders/{id}/rating
+// The order's customer can rate it once, after it has been delivered.
+func (h *OrderHandler) RateOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	order, err := h.Store.GetOrder(r.Context(), id)
+	if err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
+		return
+	}
+	if models.Role(role) != models.RoleCustomer || userID != order.CustomerID {
+		respondError(w, http.StatusForbidden, "Only the order's customer can rate it")
+		return
+	}
+
+	var req models.RateOrderRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Stars < 1 || req.Stars > 5 {
+		respondError(w, http.StatusBadRequest, "stars must be between 1 and 5")
+		return
+	}
+
+	if order.Status != models.StatusDelivered {
+		respondError(w, http.StatusConflict, "Only delivered orders can be rated")
+		return
+	}
+	if order.Rating != nil {
+		respondError(w, http.StatusConflict, "Order has already been rated")
+		return
+	}
+
+	rating := &models.OrderRating{
+		Stars:     req.Stars,
+		Comment:   strings.TrimSpace(req.Comment),
+		CreatedAt: time.Now(),
+	}
+	rated, err := h.Store.RateOrder(r.Context(), order.ID, rating, auditEntry(r, "rating", nil, rating.Stars, rating.CreatedAt))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save rating")
+		return
+	}
+	if !rated {
+		respondError(w, http.StatusConflict, "Order has already been rated")
+		return
+	}
+	order.Rating = rating
+
+	respondJSON(w, http.StatusCreated, order)
+}
+
+// SetTip handles POST /api/orders/{id}/tip
+// The order's customer can adjust the tip for a limited time after delivery.
+func (h *OrderHandler) SetTip(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	order, err := h.Store.GetOrder(r.Context(), id)
+	if err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
+		return
+	}
+	if models.Role(role) != models.RoleCustomer || userID != order.CustomerID {
+		respondError(w, http.StatusForbidden, "Only the order's customer can tip")
+		return
+	}
+
+	var req models.SetTipRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Tip == nil {
+		respondError(w, http.StatusBadRequest, "tip is required")
+		return
+	}
+	if *req.Tip < 0 {
+		respondError(w, http.StatusBadRequest, "tip cannot be negative")
+		return
+	}
+
+	if order.Status != models.StatusDelivered {
+		respondError(w, http.StatusConflict, "Tips can only be adjusted after delivery")
+		return
+	}
+	now := time.Now()
+	if deliveredAt := deliveredAt(order); now.Sub(deliveredAt) > h.TipWindow {
+		respondError(w, http.StatusConflict, "The window for adjusting the tip has closed")
+		return
+	}
+
+	previousTip := order.Tip
+	order.SetTip(*req.Tip)
+	if order.Tip == previousTip {
+		respondJSON(w, http.StatusOK, order)
+		return
+	}
+	// A card payment was captured for the grand total on delivery, and the
+	// provider cannot charge the difference on the same intent.
+	if order.PaymentMethod == models.PaymentCard && order.PaymentIntentID != "" {
+		respondError(w, http.StatusConflict, "Tips on card orders cannot be changed after the payment is captured")
+		return
+	}
+
+	// Only the tip is written, so a rating saved meanwhile is kept.
+	audit := auditEntry(r, "tip", previousTip, order.Tip, now)
+	updated, err := h.Store.SetOrderTip(r.Context(), order.ID, order.Tip, order.PriceBreakdown, audit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update order")
+		return
+	}
+	if !updated {
+		respondError(w, http.StatusConflict, "Tips can only be adjusted after delivery")
+		return
+	}
+
+	order, err = h.Store.GetOrder(r.Context(), order.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load order")
+		return
+	}
+	respondJSON(w, http.StatusOK, order)
 }
 
-// GetOrderHistory handles GET /api/orders/{id}/history
-func (h *OrderHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+// UpdatePayment handles POST /api/orders/{id}/payment
+// The order's parties and admins can mark a pending order paid; admins and
+// the order's restaurant can refund a paid order that was cancelled or
+// rejected. Card orders are captured or refunded through the payment
+// provider, which also retries a capture or refund that failed during a
+// status change. Other payments are recorded as reported.
+func (h *OrderHandler) UpdatePayment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	order, err := h.Store.GetOrder(id)
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	order, err := h.Store.GetOrder(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
+		return
+	}
+	if !canViewOrder(order, userID, models.Role(role)) {
+		respondError(w, http.StatusForbidden, "You are not a party to this order")
 		return
 	}
 
-	respondJSON(w, http.StatusOK, order.StatusHistory)
+	var req models.UpdatePaymentRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	cancelled := order.Status == models.StatusCancelled || order.Status == models.StatusRejected
+	switch req.Status {
+	case models.PaymentPaid:
+		if cancelled {
+			respondError(w, http.StatusConflict, "Cancelled and rejected orders cannot be paid")
+			return
+		}
+		if !order.IsPaymentPending() {
+			respondError(w, http.StatusConflict, "Order is already "+string(order.PaymentStatus))
+			return
+		}
+	case models.PaymentRefunded:
+		if models.Role(role) != models.RoleAdmin && (models.Role(role) != models.RoleRestaurant || userID != order.RestaurantID) {
+			respondError(w, http.StatusForbidden, "Only admins and the order's restaurant can issue refunds")
+			return
+		}
+		if !cancelled {
+			respondError(w, http.StatusConflict, "Only cancelled or rejected orders can be refunded")
+			return
+		}
+		// A card hold that was never captured can be released.
+		holding := h.Payments != nil && order.PaymentIntentID != "" && order.IsPaymentPending()
+		if order.PaymentStatus != models.PaymentPaid && !holding {
+			respondError(w, http.StatusConflict, "Only paid orders can be refunded")
+			return
+		}
+	default:
+		respondError(w, http.StatusBadRequest, "status must be paid or refunded")
+		return
+	}
+
+	// Card orders with an intent are captured through the provider; other
+	// payments are recorded as reported. Refunds work out the amount due.
+	now := time.Now()
+	switch {
+	case req.Status == models.PaymentRefunded:
+		err = payment.Refund(r.Context(), h.Payments, order, userID, models.Role(role), now)
+	case h.Payments != nil && order.PaymentIntentID != "":
+		err = payment.Capture(r.Context(), h.Payments, order, userID, models.Role(role), now)
+	default:
+		order.RecordAudit(auditEntry(r, "payment_status", order.PaymentStatus, req.Status, now))
+		order.PaymentStatus = req.Status
+	}
+	if err != nil {
+		respondErrorCode(w, http.StatusPaymentRequired, CodePaymentFailed, "Payment provider error: "+err.Error())
+		return
+	}
+	order.UpdatedAt = now
+	saved, err := h.Store.ReplaceOrderIfStatus(r.Context(), order, order.Status)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update order")
+		return
+	}
+	if !saved {
+		respondError(w, http.StatusConflict, "Order status changed concurrently; reload and try again")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, order)
 }
 
-// GetAllowedTransitions handles GET /api/orders/{id}/transitions
-func (h *OrderHandler) GetAllowedTransitions(w http.ResponseWriter, r *http.Request) {
+// ReportDelay handles POST /api/orders/{id}/delay
+// The order's restaurant or assigned driver pushes the promised delivery
+// time back by a number of minutes, giving a reason. The delay is recorded
+// on the order and in its audit trail and pushed to clients streaming it.
+// Later estimates, made when the restaurant confirms or the driver picks
+// up, start from the actual time, so they absorb earlier delays.
+func (h *OrderHandler) ReportDelay(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	order, err := h.Store.GetOrder(r.Context(), id)
+	if !orderFound(w, err) {
+		return
+	}
+	switch models.Role(role) {
+	case models.RoleRestaurant:
+		if userID != order.RestaurantID {
+			respondError(w, http.StatusForbidden, "Only the order's restaurant or assigned driver can report a delay")
+			return
+		}
+	case models.RoleDriver:
+		if userID != order.DriverID {
+			respondError(w, http.StatusForbidden, "Only the order's restaurant or assigned driver can report a delay")
+			return
+		}
+	default:
+		respondError(w, http.StatusForbidden, "Only the order's restaurant or assigned driver can report a delay")
+		return
+	}
+
+	var req models.ReportDelayRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	var errs validationErrors
+	if req.Minutes < 1 || req.Minutes > models.MaxDelayMinutes {
+		errs.add("minutes", fmt.Sprintf("minutes must be between 1 and %d", models.MaxDelayMinutes))
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		errs.add("reason", "reason is required")
+	} else if utf8.RuneCountInString(req.Reason) > models.MaxDelayReasonLength {
+		errs.add("reason", fmt.Sprintf("reason must be at most %d characters", models.MaxDelayReasonLength))
+	}
+	if errs.respond(w) {
+		return
+	}
+
+	switch order.Status {
+	case models.StatusScheduled, models.StatusDelivered, models.StatusCancelled, models.StatusRejected:
+		respondError(w, http.StatusConflict, fmt.Sprintf("Cannot report a delay on a %s order", order.Status))
+		return
+	}
+
+	now := time.Now()
+	previous := order.EstimatedDeliveryAt
+	if previous.Before(now) {
+		// An estimate that has already passed is pushed back from now.
+		previous = now
+	}
+	delay := models.OrderDelay{
+		Minutes:             req.Minutes,
+		Reason:              req.Reason,
+		ReportedBy:          userID,
+		Role:                models.Role(role),
+		EstimatedDeliveryAt: previous.Add(time.Duration(req.Minutes) * time.Minute),
+		ReportedAt:          now,
+	}
+	entry := auditEntry(r, "estimated_delivery_at", order.EstimatedDeliveryAt, delay.EstimatedDeliveryAt, now)
+	entry.Reason = req.Reason
+	order.RecordAudit(entry)
+	order.Delays = append(order.Delays, delay)
+	order.EstimatedDeliveryAt = delay.EstimatedDeliveryAt
+	order.UpdatedAt = now
+
+	saved, err := h.Store.ReplaceOrderIfStatus(r.Context(), order, order.Status)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update order")
+		return
+	}
+	if !saved {
+		respondError(w, http.StatusConflict, "Order status changed concurrently; reload and try again")
+		return
+	}
+	h.Events.PublishDelay(order.ID, delay)
+
+	respondJSON(w, http.StatusOK, order)
+}
+
+// UpdateLocation handles POST /api/orders/{id}/location
+// The assigned driver reports their position while the order is in transit.
+func (h *OrderHandler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleDriver {
+		respondError(w, http.StatusForbidden, "Only drivers can report locations")
+		return
+	}
+
+	var req models.UpdateLocationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Lat == nil || req.Lng == nil {
+		respondError(w, http.StatusBadRequest, "lat and lng are required")
+		return
+	}
+	if !models.ValidCoordinates(*req.Lat, *req.Lng) {
+		respondError(w, http.StatusBadRequest, "lat must be within ±90 and lng within ±180")
+		return
+	}
+
+	order, err := h.Store.GetOrder(r.Context(), id)
+	if err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
+		return
+	}
+	if order.DriverID != userID {
+		respondError(w, http.StatusForbidden, "You are not assigned to this order")
+		return
+	}
+	if order.Status != models.StatusPickedUp && order.Status != models.StatusOutForDelivery {
+		respondError(w, http.StatusConflict, "Locations can only be reported while the order is in transit")
+		return
+	}
+
+	loc := models.DriverLocation{Lat: *req.Lat, Lng: *req.Lng, RecordedAt: time.Now()}
+	updated, err := h.Store.UpdateDriverLocation(r.Context(), order.ID, userID, loc)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to record location")
+		return
+	}
+	// The order was delivered or reassigned since it was loaded.
+	if !updated {
+		respondError(w, http.StatusConflict, "Locations can only be reported while the order is in transit")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, loc)
+}
+
+// GetLocation handles GET /api/orders/{id}/location
+// Returns the driver's last known position to the order's parties. With
+// ?trail=true the recent breadcrumb trail is included.
+func (h *OrderHandler) GetLocation(w http.ResponseWriter, r *http.Request) {
+	withTrail := false
+	if v := r.URL.Query().Get("trail"); v != "" {
+		var err error
+		withTrail, err = strconv.ParseBool(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "trail must be true or false")
+			return
+		}
+	}
+
+	order, ok := h.viewableOrder(w, r)
+	if !ok {
+		return
+	}
+	if order.DriverLocation == nil {
+		respondError(w, http.StatusNotFound, "No location has been reported for this order")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"order_id": order.ID,
+		"status":   order.Status,
+		"location": order.DriverLocation,
+	}
+	if withTrail {
+		trail, err := h.Store.ListLocationTrail(r.Context(), order.ID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to load location trail")
+			return
+		}
+		resp["trail"] = trail
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// GetOrderHistory handles GET /api/orders/{id}/history
+func (h *OrderHandler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.viewableOrder(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, order.StatusHistory)
+}
+
+// GetOrderAudit handles GET /api/orders/{id}/audit
+// Returns every change made to the order, oldest first: status changes and
+// edits such as item changes, tips, driver claims and ratings. Only the
+// order's parties and admins may see it.
+func (h *OrderHandler) GetOrderAudit(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.viewableOrder(w, r)
+	if !ok {
+		return
+	}
+
+	respondJSON(w, http.StatusOK, order.AuditTrail())
+}
+
+// GetOrderReceipt handles GET /api/orders/{id}/receipt
+// Returns an itemized receipt with the restaurant and customer names
+// resolved. ?format=text renders it as plain text for emailing, with times
+// in the restaurant's time zone. Only the order's parties may fetch it.
+func (h *OrderHandler) GetOrderReceipt(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "text" {
+		respondError(w, http.StatusBadRequest, "format must be json or text")
+		return
+	}
+
+	order, err := h.Store.GetOrder(r.Context(), mux.Vars(r)["id"])
+	if !orderFound(w, err) {
+		return
+	}
+	if !isOrderParty(order, userID) {
+		respondError(w, http.StatusForbidden, "You are not a party to this order")
+		return
+	}
+
+	restaurant, err := h.Store.GetUser(r.Context(), order.RestaurantID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load restaurant")
+		return
+	}
+	customer, err := h.Store.GetUser(r.Context(), order.CustomerID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load customer")
+		return
+	}
+
+	receipt := models.NewReceipt(order, restaurant.Name, customer.Name, time.Now())
+	if format != "text" {
+		respondJSON(w, http.StatusOK, receipt)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, receipt.Text(restaurant.Settings.Location()))
+}
+
+// GetOrderETA handles GET /api/orders/{id}/eta
+// Returns the promised delivery time stored on the order alongside a fresh
+// estimate recomputed from its status history and the restaurant's recent
+// delivery times. The order itself is not modified.
+func (h *OrderHandler) GetOrderETA(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.viewableOrder(w, r)
+	if !ok {
+		return
+	}
+	switch order.Status {
+	case models.StatusCancelled:
+		respondError(w, http.StatusConflict, "Cancelled orders have no delivery estimate")
+		return
+	case models.StatusRejected:
+		respondError(w, http.StatusConflict, "Rejected orders have no delivery estimate")
+		return
+	}
 
-	order, err := h.Store.GetOrder(id)
+	recent, err := h.Store.ListDeliveredOrders(r.Context(), order.RestaurantID, etaSampleSize)
 	if err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to load restaurant metrics")
+		return
+	}
+	durations, samples := eta.AverageStageDurations(recent)
+
+	now := time.Now()
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"order_id":              order.ID,
+		"estimated_delivery_at": order.EstimatedDeliveryAt,
+		"minutes_remaining":     eta.MinutesUntil(order.EstimatedDeliveryAt, now),
+		"recalculated":          eta.Calculate(order, durations, samples, now),
+	})
+}
+
+// GetAllowedTransitions handles GET /api/orders/{id}/transitions
+// Returns the transitions available to the caller's role by default. Use
+// ?role= to ask about another role, or ?all_roles=true for a map of every
+// role to its transitions.
+func (h *OrderHandler) GetAllowedTransitions(w http.ResponseWriter, r *http.Request) {
+	role := models.Role(r.Context().Value(ContextKeyUserRole).(string))
+
+	q := r.URL.Query()
+	allRoles := false
+	if v := q.Get("all_roles"); v != "" {
+		var err error
+		allRoles, err = strconv.ParseBool(v)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "all_roles must be true or false")
+			return
+		}
+	}
+	if v := q.Get("role"); v != "" {
+		if allRoles {
+			respondError(w, http.StatusBadRequest, "Use either role or all_roles, not both")
+			return
+		}
+		role = models.Role(v)
+		if !role.IsValid() {
+			respondError(w, http.StatusBadRequest, "Role must be one of: customer, restaurant, driver, admin")
+			return
+		}
+	}
+
+	order, ok := h.viewableOrder(w, r)
+	if !ok {
+		return
+	}
+
+	if allRoles {
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"current_status":      order.Status,
+			"transitions_by_role": statemachine.GetAllTransitions(order.Status),
+		})
 		return
 	}
 
-	transitions := statemachine.GetAllowedTransitions(order.Status, models.Role(role))
+	transitions := statemachine.GetAllowedTransitions(order.Status, role)
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"current_status":      order.Status,
 		"allowed_transitions": transitions,
 	})
 }
+
+// applyItemConfirmation checks that the confirmation accounts for every line
+// item exactly once, then removes unavailable items and recomputes the total.
+func applyItemConfirmation(order *models.Order, conf *models.ItemConfirmation) error {
+	lines := make(map[string]bool, len(order.Items))
+	for _, item := range order.Items {
+		lines[item.MenuItemID] = true
+	}
+
+	seen := make(map[string]bool, len(order.Items))
+	unavailable := make(map[string]bool, len(conf.UnavailableItems))
+	for _, ids := range [][]string{conf.AvailableItems, conf.UnavailableItems} {
+		for _, id := range ids {
+			if !lines[id] {
+				return fmt.Errorf("item %s is not part of this order", id)
+			}
+			if seen[id] {
+				return fmt.Errorf("item %s is listed more than once", id)
+			}
+			seen[id] = true
+		}
+	}
+	for _, id := range conf.UnavailableItems {
+		unavailable[id] = true
+	}
+	for id := range lines {
+		if !seen[id] {
+			return fmt.Errorf("item %s must be confirmed as available or unavailable", id)
+		}
+	}
+
+	kept := []models.OrderItem{}
+	var subtotal float64
+	for _, item := range order.Items {
+		if unavailable[item.MenuItemID] {
+			continue
+		}
+		kept = append(kept, item)
+		subtotal += item.Price * float64(item.Quantity)
+	}
+	order.Items = kept
+	order.SetSubtotal(subtotal)
+	return nil
+}
+
+// deliveredAt returns when the order was delivered, falling back to its
+// last update.
+func deliveredAt(order *models.Order) time.Time {
+	for i := len(order.StatusHistory) - 1; i >= 0; i-- {
+		if order.StatusHistory[i].ToStatus == models.StatusDelivered {
+			return order.StatusHistory[i].Timestamp
+		}
+	}
+	return order.UpdatedAt
+}
+
+// placedAt returns when the order was last placed, falling back to its
+// creation time.
+func placedAt(order *models.Order) time.Time {
+	for i := len(order.StatusHistory) - 1; i >= 0; i-- {
+		if order.StatusHistory[i].ToStatus == models.StatusPlaced {
+			return order.StatusHistory[i].Timestamp
+		}
+	}
+	return order.CreatedAt
+}
+
+// isOrderParty reports whether the user is the order's customer, restaurant,
+// or assigned driver.
+func isOrderParty(order *models.Order, userID string) bool {
+	return userID == order.CustomerID || userID == order.RestaurantID || userID == order.DriverID
+}
+
+// canViewOrder reports whether the user may see the order's details: its
+// parties and admins may.
+func canViewOrder(order *models.Order, userID string, role models.Role) bool {
+	return role == models.RoleAdmin || isOrderParty(order, userID)
+}
+
+// viewableOrder loads the order named in the route for a read endpoint.
+// It answers 404 if there is no such order and 403 if the caller may not
+// see it (see canViewOrder), and reports whether the handler should go on.
+func (h *OrderHandler) viewableOrder(w http.ResponseWriter, r *http.Request) (*models.Order, bool) {
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	order, err := h.Store.GetOrder(r.Context(), mux.Vars(r)["id"])
+	if !orderFound(w, err) {
+		return nil, false
+	}
+	if !canViewOrder(order, userID, models.Role(role)) {
+		respondError(w, http.StatusForbidden, "You are not a party to this order")
+		return nil, false
+	}
+	return order, true
+}
+
+// orderFound answers an error from loading an order: 404 if the order does
+// not exist, 500 for anything else. It reports whether there was no error.
+func orderFound(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, db.ErrOrderNotFound):
+		respondErrorCode(w, http.StatusNotFound, CodeOrderNotFound, err.Error())
+		return false
+	case err != nil:
+		respondError(w, http.StatusInternalServerError, "Failed to fetch order")
+		return false
+	}
+	return true
+}
+
+// auditEntry records a change to field by the caller of r.
+func auditEntry(r *http.Request, field string, oldValue, newValue interface{}, at time.Time) models.AuditEntry {
+	return models.AuditEntry{
+		Field:     field,
+		OldValue:  oldValue,
+		NewValue:  newValue,
+		ChangedBy: r.Context().Value(ContextKeyUserID).(string),
+		Role:      models.Role(r.Context().Value(ContextKeyUserRole).(string)),
+		Timestamp: at,
+	}
+}
+
+// GetStatusTransitions handles GET /api/statuses/{status}/transitions
+// Public metadata endpoint: returns the transitions allowed from a status,
+// optionally filtered by ?role=. Terminal statuses return an empty list.
+func (h *OrderHandler) GetStatusTransitions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	status := models.OrderStatus(vars["status"])
+	role := models.Role(r.URL.Query().Get("role"))
+
+	if !statemachine.IsKnownStatus(status) {
+		respondError(w, http.StatusNotFound, "Unknown status: "+string(status))
+		return
+	}
+	if role != "" && !role.IsValid() {
+		respondError(w, http.StatusBadRequest, "Role must be one of: customer, restaurant, driver, admin")
+		return
+	}
+
+	transitions := statemachine.GetAllowedTransitions(status, role)
+	if transitions == nil {
+		transitions = []models.OrderStatus{}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"status":              status,
+		"role":                role,
+		"allowed_transitions": transitions,
+	})
+}
+
+// GetLifecycle handles GET /api/orders/lifecycle
+// Public metadata endpoint: returns every status of the active lifecycle
+// with its transitions and the roles that may make each, so clients can
+// draw the lifecycle and set up each role's actions ahead of time.
+// Transitions for the "system" role are made by the server itself.
+func (h *OrderHandler) GetLifecycle(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"statuses": statemachine.GetTransitionGraph(),
+	})
+}
+
+// decodeUpdateStatusRequest strictly decodes a status update body, rejecting
+// unknown fields (400) and fields the caller's role may not set (403).
+func decodeUpdateStatusRequest(body []byte, role models.Role, req *models.UpdateStatusRequest) *bodyError {
+	if err := decodeBytes(body, req); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return &bodyError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+	allowed := updateStatusFields[role]
+	var denied []string
+	for name := range fields {
+		if !allowed[name] {
+			denied = append(denied, name)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+	sort.Strings(denied)
+	err := &bodyError{
+		Status:  http.StatusForbidden,
+		Message: fmt.Sprintf("field '%s' may not be set by role '%s'", denied[0], role),
+	}
+	for _, name := range denied {
+		err.Fields.add(name, "may not be set by role "+string(role))
+	}
+	return err
+}
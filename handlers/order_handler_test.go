@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"food-delivery-api/memstore"
+	"food-delivery-api/models"
+	"food-delivery-api/payment"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// newTestStore returns an in-memory store holding a customer, a restaurant
+// and two available drivers.
+func newTestStore(t *testing.T) *memstore.Store {
+	t.Helper()
+	store := memstore.New()
+	available := true
+	for _, u := range []*models.User{
+		{ID: "cust-1", Name: "Alice", Role: models.RoleCustomer, Phone: "+14155550101"},
+		{ID: "cust-2", Name: "Carol", Role: models.RoleCustomer, Phone: "+14155550103"},
+		{ID: "rest-1", Name: "Pizza Palace", Role: models.RoleRestaurant},
+		{ID: "drv-1", Name: "Bob", Role: models.RoleDriver, Available: &available},
+		{ID: "drv-2", Name: "Dan", Role: models.RoleDriver, Available: &available},
+	} {
+		if err := store.SaveUser(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+// saveTestOrder stores an order from cust-1 to rest-1 in the given status.
+func saveTestOrder(t *testing.T, store *memstore.Store, status models.OrderStatus) *models.Order {
+	t.Helper()
+	now := time.Now()
+	order := &models.Order{
+		ID:           "order-1",
+		CustomerID:   "cust-1",
+		RestaurantID: "rest-1",
+		Items:        []models.OrderItem{{MenuItemID: "item-1", Name: "Margherita", Quantity: 1, Price: 12}},
+		TotalAmount:  12,
+		Status:       status,
+		StatusHistory: []models.StatusChange{
+			{ToStatus: models.StatusPlaced, ChangedBy: "cust-1", Role: models.RoleCustomer, Timestamp: now},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := store.SaveOrder(context.Background(), order); err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// serve calls handler as the given user, with the route variables vars.
+func serve(handler http.HandlerFunc, method, path string, vars map[string]string, userID string, role models.Role, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	ctx := context.WithValue(r.Context(), ContextKeyUserID, userID)
+	ctx = context.WithValue(ctx, ContextKeyUserRole, string(role))
+	r = mux.SetURLVars(r.WithContext(ctx), vars)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// updateStatus sends PATCH /api/orders/{id}/status as the given user.
+func updateStatus(h *OrderHandler, orderID, userID string, role models.Role, body string) *httptest.ResponseRecorder {
+	return serve(h.UpdateOrderStatus, http.MethodPatch, "/api/orders/"+orderID+"/status", map[string]string{"id": orderID}, userID, role, body)
+}
+
+func TestUpdateOrderStatusRequiresParty(t *testing.T) {
+	store := newTestStore(t)
+	saveTestOrder(t, store, models.StatusPlaced)
+	h := NewOrderHandler(store)
+
+	if w := updateStatus(h, "order-1", "cust-2", models.RoleCustomer, `{"status": "CANCELLED"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("another customer cancelling: got %d, want 403: %s", w.Code, w.Body)
+	}
+	if w := updateStatus(h, "order-1", "rest-1", models.RoleRestaurant, `{"status": "CONFIRMED", "transition_id": "t-1"}`); w.Code != http.StatusOK {
+		t.Fatalf("restaurant confirming: got %d, want 200: %s", w.Code, w.Body)
+	}
+	if w := updateStatus(h, "order-1", "cust-2", models.RoleCustomer, `{"status": "CONFIRMED", "transition_id": "t-1"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("another customer replaying: got %d, want 403: %s", w.Code, w.Body)
+	}
+
+	w := updateStatus(h, "order-1", "rest-1", models.RoleRestaurant, `{"status": "CONFIRMED", "transition_id": "t-1"}`)
+	var replayed models.Order
+	if err := json.Unmarshal(w.Body.Bytes(), &replayed); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(replayed.StatusHistory) != 2 {
+		t.Fatalf("restaurant replaying: got %d with %d history entries, want 200 with 2", w.Code, len(replayed.StatusHistory))
+	}
+
+	order, err := store.GetOrder(context.Background(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != models.StatusConfirmed {
+		t.Errorf("status = %s, want CONFIRMED", order.Status)
+	}
+}
+
+func TestUpdateOrderStatusUnclaimedPickup(t *testing.T) {
+	store := newTestStore(t)
+	saveTestOrder(t, store, models.StatusReadyForPickup)
+	h := NewOrderHandler(store)
+
+	if w := updateStatus(h, "order-1", "drv-1", models.RoleDriver, `{"status": "PICKED_UP"}`); w.Code != http.StatusOK {
+		t.Fatalf("driver picking up an unclaimed order: got %d, want 200: %s", w.Code, w.Body)
+	}
+	order, err := store.GetOrder(context.Background(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != models.StatusPickedUp || order.DriverID != "drv-1" {
+		t.Fatalf("got status %s and driver %q, want PICKED_UP by drv-1", order.Status, order.DriverID)
+	}
+
+	if w := updateStatus(h, "order-1", "drv-2", models.RoleDriver, `{"status": "OUT_FOR_DELIVERY"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("another driver moving a claimed order: got %d, want 403: %s", w.Code, w.Body)
+	}
+}
+
+func TestAddingItemsReauthorizesCardPayment(t *testing.T) {
+	store := newTestStore(t)
+	for _, item := range []*models.MenuItem{
+		{ID: "item-1", RestaurantID: "rest-1", Name: "Margherita", Price: 12, Available: true},
+		{ID: "item-2", RestaurantID: "rest-1", Name: "Garlic Bread", Price: 8, Available: true},
+	} {
+		if err := store.SaveMenuItem(context.Background(), item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mock := payment.NewMock()
+	order := saveTestOrder(t, store, models.StatusPlaced)
+	order.PaymentMethod = models.PaymentCard
+	order.PaymentStatus = models.PaymentPending
+	if err := payment.Authorize(context.Background(), mock, order); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveOrder(context.Background(), order); err != nil {
+		t.Fatal(err)
+	}
+	h := NewOrderHandler(store)
+	h.Payments = mock
+
+	w := serve(h.UpdateOrderItems, http.MethodPatch, "/api/orders/order-1/items", map[string]string{"id": "order-1"},
+		"cust-1", models.RoleCustomer, `{"add": [{"menu_item_id": "item-2", "quantity": 1}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("adding an item: got %d, want 200: %s", w.Code, w.Body)
+	}
+	if _, err := mock.Capture(context.Background(), order.PaymentIntentID, 1); err == nil {
+		t.Error("the old hold was not released")
+	}
+
+	steps := []struct {
+		userID string
+		role   models.Role
+		status models.OrderStatus
+	}{
+		{"rest-1", models.RoleRestaurant, models.StatusConfirmed},
+		{"rest-1", models.RoleRestaurant, models.StatusPreparing},
+		{"rest-1", models.RoleRestaurant, models.StatusReadyForPickup},
+		{"drv-1", models.RoleDriver, models.StatusPickedUp},
+		{"drv-1", models.RoleDriver, models.StatusOutForDelivery},
+		{"drv-1", models.RoleDriver, models.StatusDelivered},
+	}
+	for _, step := range steps {
+		if w := updateStatus(h, "order-1", step.userID, step.role, `{"status": "`+string(step.status)+`"}`); w.Code != http.StatusOK {
+			t.Fatalf("moving to %s: got %d, want 200: %s", step.status, w.Code, w.Body)
+		}
+	}
+
+	delivered, err := store.GetOrder(context.Background(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered.GrandTotal() != 20 {
+		t.Errorf("grand total = %v, want 20", delivered.GrandTotal())
+	}
+	if delivered.PaymentStatus != models.PaymentPaid || delivered.PaymentChargeID == "" {
+		t.Errorf("got payment_status %s and charge %q, want paid with a charge", delivered.PaymentStatus, delivered.PaymentChargeID)
+	}
+}
+
+func TestUpdateItemPrepKeepsOtherLines(t *testing.T) {
+	store := newTestStore(t)
+	order := saveTestOrder(t, store, models.StatusPreparing)
+	order.Items = append(order.Items, models.OrderItem{MenuItemID: "item-2", Name: "Garlic Bread", Quantity: 1, Price: 8})
+	for i := range order.Items {
+		order.Items[i].PrepStatus = models.PrepPending
+	}
+	if err := store.SaveOrder(context.Background(), order); err != nil {
+		t.Fatal(err)
+	}
+	h := NewOrderHandler(store)
+	markReady := func(itemID string) *httptest.ResponseRecorder {
+		return serve(h.UpdateItemPrep, http.MethodPatch, "/api/orders/order-1/items/"+itemID+"/prep",
+			map[string]string{"id": "order-1", "itemId": itemID}, "rest-1", models.RoleRestaurant, `{"status": "ready"}`)
+	}
+
+	if w := markReady("item-1"); w.Code != http.StatusOK {
+		t.Fatalf("marking item-1 ready: got %d, want 200: %s", w.Code, w.Body)
+	}
+	if w := markReady("item-2"); w.Code != http.StatusOK {
+		t.Fatalf("marking item-2 ready: got %d, want 200: %s", w.Code, w.Body)
+	}
+	stored, err := store.GetOrder(context.Background(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.ItemsReady {
+		t.Errorf("items_ready = false with every line ready: %+v", stored.Items)
+	}
+
+	// A status change that lands first wins over a prep update.
+	stored.Status = models.StatusReadyForPickup
+	if saved, err := store.ReplaceOrderIfStatus(context.Background(), stored, models.StatusPreparing); err != nil || !saved {
+		t.Fatalf("ReplaceOrderIfStatus = %v, %v; want true", saved, err)
+	}
+	if ok, err := store.SetItemPrepStatus(context.Background(), "order-1", "item-1", models.PrepPending, models.AuditEntry{}); err != nil || ok {
+		t.Errorf("SetItemPrepStatus after READY_FOR_PICKUP = %v, %v; want false", ok, err)
+	}
+}
+
+func TestSetTipKeepsRating(t *testing.T) {
+	store := newTestStore(t)
+	order := saveTestOrder(t, store, models.StatusDelivered)
+	order.StatusHistory = append(order.StatusHistory, models.StatusChange{ToStatus: models.StatusDelivered, ChangedBy: "drv-1", Role: models.RoleDriver, Timestamp: time.Now()})
+	if err := store.SaveOrder(context.Background(), order); err != nil {
+		t.Fatal(err)
+	}
+	h := NewOrderHandler(store)
+
+	// The rating lands after SetTip has read the order but before it writes.
+	rating := &models.OrderRating{Stars: 5, CreatedAt: time.Now()}
+	if ok, err := store.RateOrder(context.Background(), "order-1", rating, models.AuditEntry{Field: "rating"}); err != nil || !ok {
+		t.Fatalf("RateOrder = %v, %v; want true", ok, err)
+	}
+	if ok, err := store.SetOrderTip(context.Background(), "order-1", 3, nil, models.AuditEntry{Field: "tip"}); err != nil || !ok {
+		t.Fatalf("SetOrderTip = %v, %v; want true", ok, err)
+	}
+	stored, err := store.GetOrder(context.Background(), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Rating == nil || stored.Tip != 3 {
+		t.Errorf("got rating %v and tip %v, want both kept", stored.Rating, stored.Tip)
+	}
+
+	w := serve(h.SetTip, http.MethodPost, "/api/orders/order-1/tip", map[string]string{"id": "order-1"}, "cust-1", models.RoleCustomer, `{"tip": 4}`)
+	var tipped models.Order
+	if err := json.Unmarshal(w.Body.Bytes(), &tipped); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || tipped.Tip != 4 || tipped.Rating == nil {
+		t.Errorf("changing a cash tip: got %d with tip %v and rating %v, want 200 with tip 4 and the rating", w.Code, tipped.Tip, tipped.Rating)
+	}
+
+	stored.PaymentMethod = models.PaymentCard
+	stored.PaymentIntentID = "pi_mock_1"
+	if err := store.SaveOrder(context.Background(), stored); err != nil {
+		t.Fatal(err)
+	}
+	w = serve(h.SetTip, http.MethodPost, "/api/orders/order-1/tip", map[string]string{"id": "order-1"}, "cust-1", models.RoleCustomer, `{"tip": 5}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("changing a captured card tip: got %d, want 409: %s", w.Code, w.Body)
+	}
+}
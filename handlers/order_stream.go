@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"food-delivery-api/events"
+	"food-delivery-api/models"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// streamWriteWait bounds each write to a streaming client.
+	streamWriteWait = 10 * time.Second
+	// streamPongWait is how long a client may stay silent, pongs included,
+	// before its stream is closed.
+	streamPongWait = 60 * time.Second
+	// streamPingPeriod must be shorter than streamPongWait.
+	streamPingPeriod = streamPongWait * 9 / 10
+	// streamReadLimit caps frames from the client, which has nothing to say.
+	streamReadLimit = 512
+	// sseHeartbeatInterval keeps idle event streams alive through proxies,
+	// which commonly drop connections silent for 30–60 seconds.
+	sseHeartbeatInterval = 15 * time.Second
+)
+
+// streamUpgrader upgrades order stream requests. Browsers may only connect
+// from the API's own origin or one allowed by CORSMiddleware.
+var streamUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024, CheckOrigin: checkStreamOrigin}
+
+// StreamOrder handles GET /api/orders/{id}/stream
+// Upgrades to a WebSocket for the order's parties and admins, sends the
+// current status and delivery estimate as a snapshot, then pushes each
+// status change and reported delay as it happens. Clients that fall
+// behind, and all clients on shutdown, are disconnected with a going away
+// close frame and should reconnect to resync.
+func (h *OrderHandler) StreamOrder(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Subscribe before reading the order so no change is missed in between.
+	sub := h.Events.Subscribe(id)
+	defer sub.Close()
+
+	order, ok := h.viewableOrder(w, r)
+	if !ok {
+		return
+	}
+
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already answered the client.
+		return
+	}
+	defer conn.Close()
+
+	seen := lastUpdateAt(order)
+	status := order.Status
+	if err := writeStreamMessage(conn, snapshotMessage(order)); err != nil {
+		return
+	}
+
+	// The client only sends control frames; reading handles pongs and
+	// notices when it goes away.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		conn.SetReadLimit(streamReadLimit)
+		conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				closeStream(conn, websocket.CloseGoingAway, "stream closed; reconnect to resume")
+				return
+			}
+			if !isNewEvent(event, seen) {
+				continue
+			}
+			if err := writeStreamMessage(conn, eventMessage(order.ID, &status, event)); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// StreamOrderEvents handles GET /api/orders/{id}/events
+// A server-sent events fallback for clients that cannot use WebSockets,
+// open to the same callers. It emits the same messages as StreamOrder, as
+// "snapshot", "status_change" and "delay" events, with a comment line every
+// sseHeartbeatInterval so proxies keep the connection open. The stream
+// ends when the client disconnects or the server closes the bus.
+func (h *OrderHandler) StreamOrderEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	sub := h.Events.Subscribe(id)
+	defer sub.Close()
+
+	order, ok := h.viewableOrder(w, r)
+	if !ok {
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stops nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	seen := lastUpdateAt(order)
+	status := order.Status
+	if err := writeEvent(w, rc, snapshotMessage(order)); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if !isNewEvent(event, seen) {
+				continue
+			}
+			if err := writeEvent(w, rc, eventMessage(order.ID, &status, event)); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent sends msg as a server-sent event named after its type.
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, msg models.OrderStreamMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	rc.SetWriteDeadline(time.Now().Add(streamWriteWait))
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// snapshotMessage is the first message of a stream: the order's current
+// status and delivery estimate.
+func snapshotMessage(order *models.Order) models.OrderStreamMessage {
+	estimate := order.EstimatedDeliveryAt
+	return models.OrderStreamMessage{Type: models.StreamSnapshot, OrderID: order.ID, Status: order.Status, EstimatedDeliveryAt: &estimate}
+}
+
+// eventMessage wraps a published update for a stream. status tracks the
+// order's status as the stream has reported it, so delays can carry it.
+func eventMessage(orderID string, status *models.OrderStatus, event events.Event) models.OrderStreamMessage {
+	if delay := event.Delay; delay != nil {
+		return models.OrderStreamMessage{Type: models.StreamDelay, OrderID: orderID, Status: *status, Delay: delay, EstimatedDeliveryAt: &delay.EstimatedDeliveryAt}
+	}
+	*status = event.Change.ToStatus
+	return models.OrderStreamMessage{Type: models.StreamStatusChange, OrderID: orderID, Status: event.Change.ToStatus, Change: event.Change}
+}
+
+// lastUpdateAt returns when the order last changed status or was delayed,
+// falling back to its creation time.
+func lastUpdateAt(order *models.Order) time.Time {
+	last := order.CreatedAt
+	if n := len(order.StatusHistory); n > 0 {
+		last = order.StatusHistory[n-1].Timestamp
+	}
+	if n := len(order.Delays); n > 0 && order.Delays[n-1].ReportedAt.After(last) {
+		last = order.Delays[n-1].ReportedAt
+	}
+	return last
+}
+
+// isNewEvent reports whether a published update is later than seen, the
+// last update in the snapshot. Streams subscribe before reading the order,
+// so updates saved in between arrive on both. Stored timestamps have
+// millisecond precision.
+func isNewEvent(event events.Event, seen time.Time) bool {
+	return event.Timestamp().Truncate(time.Millisecond).After(seen)
+}
+
+// writeStreamMessage sends msg as a JSON text frame.
+func writeStreamMessage(conn *websocket.Conn, msg models.OrderStreamMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+	return conn.WriteJSON(msg)
+}
+
+// closeStream sends a close frame; the connection is closed by the caller.
+func closeStream(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(streamWriteWait))
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket for one client.
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// RateLimiter is an in-memory token-bucket limiter keyed by the
+// authenticated user ID, or by remote IP for unauthenticated requests.
+// Each client may burst up to PerMinute requests and is refilled at
+// PerMinute per minute.
+type RateLimiter struct {
+	PerMinute int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewRateLimiter creates a limiter allowing perMinute requests per client.
+// A limit of zero or less disables limiting.
+func NewRateLimiter(perMinute int) *RateLimiter {
+	return &RateLimiter{PerMinute: perMinute, buckets: make(map[string]*bucket)}
+}
+
+// Middleware rejects requests over the limit with 429 and a Retry-After
+// header. Wrap it inside the auth middleware so requests are keyed by user.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.PerMinute <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if wait, ok := l.allow(clientKey(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondError(w, http.StatusTooManyRequests, "Rate limit exceeded; try again later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LimitByMethod applies reads to GET and HEAD requests and writes to
+// everything else.
+func LimitByMethod(reads, writes *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		read := reads.Middleware(next)
+		write := writes.Middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				read.ServeHTTP(w, r)
+				return
+			}
+			write.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allow takes a token for key, or reports how long until one is available.
+func (l *RateLimiter) allow(key string, now time.Time) (time.Duration, bool) {
+	capacity := float64(l.PerMinute)
+	perSecond := capacity / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, lastSeen: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.lastSeen).Seconds()*perSecond)
+	b.lastSeen = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / perSecond * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// Cleanup periodically drops buckets that have been idle long enough to be
+// full again, until ctx is cancelled.
+func (l *RateLimiter) Cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for key, b := range l.buckets {
+				if now.Sub(b.lastSeen) > time.Minute {
+					delete(l.buckets, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// clientKey identifies the caller for rate limiting.
+func clientKey(r *http.Request) string {
+	if userID, ok := r.Context().Value(ContextKeyUserID).(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
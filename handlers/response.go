@@ -1,18 +1,122 @@
 package handlers
 
 import (
+	"bufio"
 	"encoding/json"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
 )
 
+// Envelope is the standard wrapper used when a client opts into enveloped
+// responses. Data is set on success and Error on failure; an error may also
+// carry details in Data.
+type Envelope struct {
+	Data  interface{}  `json:"data"`
+	Error *APIError    `json:"error"`
+	Meta  EnvelopeMeta `json:"meta"`
+}
+
+// EnvelopeMeta carries request metadata alongside every enveloped response.
+type EnvelopeMeta struct {
+	RequestID string    `json:"request_id"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// envelopeWriter marks a response as enveloped so respondJSON and
+// respondError know to wrap their output.
+type envelopeWriter struct {
+	http.ResponseWriter
+	requestID string
+}
+
+func (ew *envelopeWriter) meta() EnvelopeMeta {
+	return EnvelopeMeta{RequestID: ew.requestID, Timestamp: time.Now().UTC()}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (ew *envelopeWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// Hijack passes WebSocket upgrades through; streamed messages are never
+// enveloped.
+func (ew *envelopeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(ew.ResponseWriter).Hijack()
+}
+
+// EnvelopeMiddleware wraps responses in an Envelope when enabled. The
+// X-Envelope request header ("true"/"false") overrides the default, so the
+// bare format stays in place for existing clients unless they opt in.
+func EnvelopeMiddleware(enabledByDefault bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			enabled := enabledByDefault
+			if v, err := strconv.ParseBool(r.Header.Get("X-Envelope")); err == nil {
+				enabled = v
+			}
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+			requestID := requestIDFrom(r.Context())
+			if requestID == "" {
+				requestID = r.Header.Get("X-Request-ID")
+			}
+			if requestID == "" {
+				requestID = uuid.New().String()
+			}
+			w.Header().Set("X-Request-ID", requestID)
+			next.ServeHTTP(&envelopeWriter{ResponseWriter: w, requestID: requestID}, r)
+		})
+	}
+}
+
 // respondJSON writes a JSON response with the given status code.
 func respondJSON(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(data)
+	if ew, ok := w.(*envelopeWriter); ok {
+		data = Envelope{Data: data, Meta: ew.meta()}
+	}
+	writeJSON(w, statusCode, data)
 }
 
-// respondError writes a JSON error response with the given status code.
+// respondError writes a JSON error response with the given status code and
+// the default code for that status.
 func respondError(w http.ResponseWriter, statusCode int, message string) {
-	respondJSON(w, statusCode, map[string]string{"error": message})
+	respondErrorCode(w, statusCode, codeForStatus(statusCode), message)
+}
+
+// respondErrorCode writes a JSON error response with a specific error code.
+func respondErrorCode(w http.ResponseWriter, statusCode int, code ErrorCode, message string) {
+	respondErrorDetails(w, statusCode, code, message, nil)
+}
+
+// respondErrorDetails writes a JSON error response that also carries
+// machine-readable details alongside the error. The message is repeated at
+// the top level for clients written before errors had codes.
+func respondErrorDetails(w http.ResponseWriter, statusCode int, code ErrorCode, message string, details map[string]interface{}) {
+	apiErr := &APIError{Code: code, Message: message, Status: statusCode}
+	if ew, ok := w.(*envelopeWriter); ok {
+		var data interface{}
+		if details != nil {
+			data = details
+		}
+		writeJSON(w, statusCode, Envelope{Data: data, Error: apiErr, Meta: ew.meta()})
+		return
+	}
+	body := map[string]interface{}{"error": apiErr, "message": message}
+	for k, v := range details {
+		body[k] = v
+	}
+	writeJSON(w, statusCode, body)
+}
+
+// writeJSON encodes data as the response body.
+func writeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
 }
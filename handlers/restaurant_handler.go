@@ -0,0 +1,599 @@
+package handlers
+
+import (
+	"fmt"
+	"food-delivery-api/db"
+	"food-delivery-api/models"
+	"food-delivery-api/webhook"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Restaurant listings are paged; clients may ask for up to maxPageSize.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// maxRestaurantTags caps how many tags a restaurant may set.
+const maxRestaurantTags = 10
+
+// Nearby searches cover defaultNearbyRadiusKM unless the client asks for
+// up to maxNearbyRadiusKM.
+const (
+	defaultNearbyRadiusKM = 5
+	maxNearbyRadiusKM     = 50
+)
+
+// Popularity rankings list defaultPopularItems unless the client asks for
+// up to maxPopularItems. Each ranking is reused for popularCacheTTL, since
+// it aggregates over every matching order.
+const (
+	defaultPopularItems = 10
+	maxPopularItems     = 50
+	popularCacheTTL     = time.Minute
+)
+
+// RestaurantHandler handles restaurant-level HTTP requests.
+type RestaurantHandler struct {
+	Store Store
+
+	popularMu sync.Mutex
+	popular   map[string]models.PopularItemsReport
+}
+
+// NewRestaurantHandler creates a new RestaurantHandler.
+func NewRestaurantHandler(store Store) *RestaurantHandler {
+	return &RestaurantHandler{Store: store, popular: make(map[string]models.PopularItemsReport)}
+}
+
+// UpdateSettings handles PATCH /api/restaurants/{id}/settings
+// Only the restaurant owner can change its settings.
+func (h *RestaurantHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only manage your own restaurant")
+		return
+	}
+
+	var req models.UpdateRestaurantSettingsRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	restaurant, err := h.Store.GetUser(r.Context(), restaurantID)
+	if err != nil || restaurant.Role != models.RoleRestaurant {
+		respondErrorCode(w, http.StatusNotFound, CodeRestaurantNotFound, "Restaurant not found")
+		return
+	}
+
+	if restaurant.Settings == nil {
+		restaurant.Settings = &models.RestaurantSettings{}
+	}
+	if req.RequireItemConfirmation != nil {
+		restaurant.Settings.RequireItemConfirmation = *req.RequireItemConfirmation
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid timezone: "+*req.Timezone)
+			return
+		}
+		restaurant.Settings.Timezone = *req.Timezone
+	}
+	if req.OrderPrefix != nil {
+		prefix := strings.ToUpper(strings.TrimSpace(*req.OrderPrefix))
+		if prefix != "" && !models.IsValidOrderPrefix(prefix) {
+			respondError(w, http.StatusBadRequest, "order_prefix must be 1-8 letters or digits, optionally ending in '-'")
+			return
+		}
+		restaurant.Settings.OrderPrefix = prefix
+	}
+	if req.DefaultPrepMinutes != nil {
+		if *req.DefaultPrepMinutes < 0 || *req.DefaultPrepMinutes > models.MaxPrepMinutes {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("default_prep_minutes must be between 0 and %d", models.MaxPrepMinutes))
+			return
+		}
+		restaurant.Settings.DefaultPrepMinutes = *req.DefaultPrepMinutes
+	}
+	if req.WebhookURL != nil {
+		hook := strings.TrimSpace(*req.WebhookURL)
+		// Webhooks are posted from inside our network, so they must not be
+		// aimed at loopback, private or link-local addresses.
+		if hook != "" {
+			if err := webhook.CheckURL(r.Context(), hook); err != nil {
+				respondError(w, http.StatusBadRequest, "webhook_url "+err.Error())
+				return
+			}
+		}
+		restaurant.Settings.WebhookURL = hook
+	}
+	if req.OpensAt != nil {
+		restaurant.Settings.OpensAt = strings.TrimSpace(*req.OpensAt)
+	}
+	if req.ClosesAt != nil {
+		restaurant.Settings.ClosesAt = strings.TrimSpace(*req.ClosesAt)
+	}
+	hours := models.MenuSchedule{AvailableFrom: restaurant.Settings.OpensAt, AvailableUntil: restaurant.Settings.ClosesAt}
+	if err := hours.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.Store.SaveUser(r.Context(), restaurant); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save settings")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, restaurant)
+}
+
+// ListRestaurants handles GET /api/restaurants
+// Public endpoint — lists restaurants by name. Supports optional ?cuisine=
+// and ?q= (name search) filters and ?limit= / ?offset= paging.
+func (h *RestaurantHandler) ListRestaurants(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, offset, err := parsePage(q)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	restaurants, err := h.Store.ListRestaurants(r.Context(), db.RestaurantFilter{
+		Cuisine: strings.ToLower(strings.TrimSpace(q.Get("cuisine"))),
+		Query:   strings.TrimSpace(q.Get("q")),
+		Offset:  offset,
+		Limit:   limit,
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to fetch restaurants")
+		return
+	}
+
+	listings := make([]models.RestaurantListing, 0, len(restaurants))
+	for _, restaurant := range restaurants {
+		listings = append(listings, restaurant.Listing())
+	}
+	respondJSON(w, http.StatusOK, listings)
+}
+
+// NearbyRestaurants handles GET /api/restaurants/nearby
+// Public endpoint — lists restaurants within ?radius_km= (default 5, at
+// most 50) of ?lat= and ?lng=, nearest first, with each one's distance_km.
+// Supports ?limit= / ?offset= paging.
+func (h *RestaurantHandler) NearbyRestaurants(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	lat, errLat := strconv.ParseFloat(q.Get("lat"), 64)
+	lng, errLng := strconv.ParseFloat(q.Get("lng"), 64)
+	if errLat != nil || errLng != nil {
+		respondError(w, http.StatusBadRequest, "lat and lng are required numbers")
+		return
+	}
+	if !models.ValidCoordinates(lat, lng) {
+		respondError(w, http.StatusBadRequest, "lat must be within ±90 and lng within ±180")
+		return
+	}
+	radius := float64(defaultNearbyRadiusKM)
+	if v := q.Get("radius_km"); v != "" {
+		var err error
+		radius, err = strconv.ParseFloat(v, 64)
+		if err != nil || !(radius > 0 && radius <= maxNearbyRadiusKM) {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("radius_km must be greater than 0 and at most %d", maxNearbyRadiusKM))
+			return
+		}
+	}
+	limit, offset, err := parsePage(q)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	restaurants, err := h.Store.ListNearbyRestaurants(r.Context(), lat, lng, radius*1000, offset, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to fetch restaurants")
+		return
+	}
+
+	listings := make([]models.RestaurantListing, 0, len(restaurants))
+	for _, restaurant := range restaurants {
+		listing := restaurant.Listing()
+		km := math.Round(restaurant.DistanceMeters) / 1000
+		listing.DistanceKM = &km
+		listings = append(listings, listing)
+	}
+	respondJSON(w, http.StatusOK, listings)
+}
+
+// parsePage reads ?limit= and ?offset=, defaulting to the first
+// defaultPageSize results.
+func parsePage(q url.Values) (limit, offset int64, err error) {
+	limit = defaultPageSize
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// parseSort reads ?sort= as field:asc or field:desc, where field must be
+// one of allowed. The direction defaults to asc. An empty value returns
+// the zero Sort, leaving the list's default order.
+func parseSort(q url.Values, allowed map[string]bool) (db.Sort, error) {
+	v := q.Get("sort")
+	if v == "" {
+		return db.Sort{}, nil
+	}
+	field, dir, _ := strings.Cut(v, ":")
+	if allowed[field] {
+		switch dir {
+		case "", "asc":
+			return db.Sort{Field: field}, nil
+		case "desc":
+			return db.Sort{Field: field, Desc: true}, nil
+		}
+	}
+	fields := make([]string, 0, len(allowed))
+	for f := range allowed {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return db.Sort{}, fmt.Errorf("sort must be field:asc or field:desc, with field one of: %s", strings.Join(fields, ", "))
+}
+
+// UpdateCuisine handles PUT /api/restaurants/{id}/cuisine
+// Sets the restaurant's cuisine and tags, which are stored lowercase.
+func (h *RestaurantHandler) UpdateCuisine(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only manage your own restaurant")
+		return
+	}
+
+	var req models.UpdateCuisineRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	cuisine := strings.ToLower(strings.TrimSpace(req.Cuisine))
+	if len(cuisine) > 40 {
+		respondError(w, http.StatusBadRequest, "cuisine must be at most 40 characters")
+		return
+	}
+	seen := make(map[string]bool, len(req.Tags))
+	tags := make([]string, 0, len(req.Tags))
+	for _, t := range req.Tags {
+		tag := strings.ToLower(strings.TrimSpace(t))
+		if tag == "" || len(tag) > 30 {
+			respondError(w, http.StatusBadRequest, "Tags must be 1-30 characters")
+			return
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxRestaurantTags {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("At most %d tags are allowed", maxRestaurantTags))
+		return
+	}
+	sort.Strings(tags)
+
+	restaurant, err := h.Store.GetUser(r.Context(), restaurantID)
+	if err != nil || restaurant.Role != models.RoleRestaurant {
+		respondErrorCode(w, http.StatusNotFound, CodeRestaurantNotFound, "Restaurant not found")
+		return
+	}
+	restaurant.Cuisine = cuisine
+	restaurant.Tags = tags
+
+	if err := h.Store.SaveUser(r.Context(), restaurant); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save cuisine")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, restaurant)
+}
+
+// UpdateRestaurantLocation handles PUT /api/restaurants/{id}/location
+// Sets where the restaurant is, which places it in nearby searches.
+func (h *RestaurantHandler) UpdateRestaurantLocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only manage your own restaurant")
+		return
+	}
+
+	var req models.UpdateLocationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Lat == nil || req.Lng == nil {
+		respondError(w, http.StatusBadRequest, "lat and lng are required")
+		return
+	}
+	if !models.ValidCoordinates(*req.Lat, *req.Lng) {
+		respondError(w, http.StatusBadRequest, "lat must be within ±90 and lng within ±180")
+		return
+	}
+
+	restaurant, err := h.Store.GetUser(r.Context(), restaurantID)
+	if err != nil || restaurant.Role != models.RoleRestaurant {
+		respondErrorCode(w, http.StatusNotFound, CodeRestaurantNotFound, "Restaurant not found")
+		return
+	}
+	restaurant.SetLocation(*req.Lat, *req.Lng)
+
+	if err := h.Store.SaveUser(r.Context(), restaurant); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save location")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, restaurant)
+}
+
+// UpdateBlackoutDates handles PUT /api/restaurants/{id}/blackout-dates
+// Replaces the list of dates on which the restaurant accepts no orders.
+func (h *RestaurantHandler) UpdateBlackoutDates(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only manage your own restaurant")
+		return
+	}
+
+	var req models.UpdateBlackoutDatesRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	seen := make(map[string]bool, len(req.Dates))
+	dates := make([]string, 0, len(req.Dates))
+	for _, d := range req.Dates {
+		if _, err := time.Parse(models.DateLayout, d); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid date '"+d+"'; expected YYYY-MM-DD")
+			return
+		}
+		if !seen[d] {
+			seen[d] = true
+			dates = append(dates, d)
+		}
+	}
+	sort.Strings(dates)
+
+	restaurant, err := h.Store.GetUser(r.Context(), restaurantID)
+	if err != nil || restaurant.Role != models.RoleRestaurant {
+		respondErrorCode(w, http.StatusNotFound, CodeRestaurantNotFound, "Restaurant not found")
+		return
+	}
+	if restaurant.Settings == nil {
+		restaurant.Settings = &models.RestaurantSettings{}
+	}
+	restaurant.Settings.BlackoutDates = dates
+
+	if err := h.Store.SaveUser(r.Context(), restaurant); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save blackout dates")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, restaurant)
+}
+
+// GetRating handles GET /api/restaurants/{id}/rating
+// Public endpoint — returns the restaurant's average star rating.
+func (h *RestaurantHandler) GetRating(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	restaurant, err := h.Store.GetUser(r.Context(), restaurantID)
+	if err != nil || restaurant.Role != models.RoleRestaurant {
+		respondErrorCode(w, http.StatusNotFound, CodeRestaurantNotFound, "Restaurant not found")
+		return
+	}
+
+	average, count, err := h.Store.RestaurantRating(r.Context(), restaurantID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to fetch rating")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.RatingSummary{
+		RestaurantID: restaurantID,
+		Average:      math.Round(average*10) / 10,
+		Count:        count,
+	})
+}
+
+// GetOrderSummary handles GET /api/restaurants/{id}/orders/summary
+// Counts the restaurant's orders by status, optionally limited to a
+// ?created_after= / ?created_before= range.
+func (h *RestaurantHandler) GetOrderSummary(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only view your own restaurant's orders")
+		return
+	}
+
+	filter := db.OrderFilter{RestaurantID: restaurantID}
+	if err := parseCreatedRange(r.URL.Query(), &filter); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	counts, err := h.Store.CountOrdersByStatus(r.Context(), filter)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to count orders")
+		return
+	}
+
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	respondJSON(w, http.StatusOK, models.OrderStatusSummary{
+		RestaurantID: restaurantID,
+		Counts:       counts,
+		Total:        total,
+	})
+}
+
+// GetKitchenQueue handles GET /api/restaurants/{id}/queue
+// Lists the restaurant's CONFIRMED and PREPARING orders in the order they
+// should be cooked, first in first out, with each order's position and how
+// long it has waited. Scheduled orders queue from their scheduled time.
+func (h *RestaurantHandler) GetKitchenQueue(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only view your own restaurant's queue")
+		return
+	}
+
+	orders, err := h.Store.ListKitchenQueue(r.Context(), restaurantID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to fetch queue")
+		return
+	}
+
+	// Ties, e.g. orders scheduled for the same time, keep a stable order.
+	sort.SliceStable(orders, func(i, j int) bool {
+		a, b := orders[i].QueueTime(), orders[j].QueueTime()
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return orders[i].ID < orders[j].ID
+	})
+
+	now := time.Now()
+	queue := make([]models.KitchenQueueEntry, 0, len(orders))
+	for i, order := range orders {
+		queuedAt := order.QueueTime()
+		age := now.Sub(queuedAt)
+		if age < 0 {
+			age = 0
+		}
+		queue = append(queue, models.KitchenQueueEntry{
+			Order:      order,
+			Position:   i + 1,
+			QueuedAt:   queuedAt,
+			AgeMinutes: int(age / time.Minute),
+		})
+	}
+
+	respondJSON(w, http.StatusOK, queue)
+}
+
+// GetPopularItems handles GET /api/restaurants/{id}/menu/popular
+// Ranks the restaurant's menu items by quantity sold, with the number of
+// orders each appeared on. Supports ?limit= (default 10, at most 50) and
+// the ?created_after= / ?created_before= range. Results may be up to
+// popularCacheTTL old; generated_at says when they were computed.
+func (h *RestaurantHandler) GetPopularItems(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	restaurantID := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleRestaurant || userID != restaurantID {
+		respondError(w, http.StatusForbidden, "You can only view your own restaurant's sales")
+		return
+	}
+
+	q := r.URL.Query()
+	limit := int64(defaultPopularItems)
+	if v := q.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || limit < 1 || limit > maxPopularItems {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPopularItems))
+			return
+		}
+	}
+	filter := db.OrderFilter{RestaurantID: restaurantID}
+	if err := parseCreatedRange(q, &filter); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now()
+	key := fmt.Sprintf("%s|%d|%s|%s", restaurantID, limit, q.Get("created_after"), q.Get("created_before"))
+	if report, ok := h.cachedPopular(key, now); ok {
+		respondJSON(w, http.StatusOK, report)
+		return
+	}
+
+	items, err := h.Store.PopularMenuItems(r.Context(), filter, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to rank menu items")
+		return
+	}
+	report := models.PopularItemsReport{RestaurantID: restaurantID, Items: items, GeneratedAt: now}
+	h.cachePopular(key, report)
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// cachedPopular returns the ranking cached under key if it is still fresh.
+func (h *RestaurantHandler) cachedPopular(key string, now time.Time) (models.PopularItemsReport, bool) {
+	h.popularMu.Lock()
+	defer h.popularMu.Unlock()
+	report, ok := h.popular[key]
+	if !ok || now.Sub(report.GeneratedAt) >= popularCacheTTL {
+		return models.PopularItemsReport{}, false
+	}
+	return report, true
+}
+
+// cachePopular stores a ranking under key, dropping any that have expired
+// so the cache stays small.
+func (h *RestaurantHandler) cachePopular(key string, report models.PopularItemsReport) {
+	h.popularMu.Lock()
+	defer h.popularMu.Unlock()
+	for k, cached := range h.popular {
+		if report.GeneratedAt.Sub(cached.GeneratedAt) >= popularCacheTTL {
+			delete(h.popular, k)
+		}
+	}
+	h.popular[key] = report
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"food-delivery-api/db"
+	"food-delivery-api/models"
+	"time"
+)
+
+// Store is the persistence the handlers need. *db.Store implements it on
+// MongoDB and *memstore.Store in memory, so handlers can run without a
+// database. Implementations return the sentinel errors of package db, such
+// as db.ErrOrderNotFound and db.ErrDuplicateEmail.
+type Store interface {
+	Ping(ctx context.Context) error
+	// WithTransaction runs fn so that its writes are applied together when
+	// SupportsTransactions reports true; see db.Store.WithTransaction.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+	SupportsTransactions() bool
+
+	SaveUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	ListUsers(ctx context.Context, roleFilter models.Role) ([]*models.User, error)
+	ListAvailableDrivers(ctx context.Context) ([]*models.User, error)
+	SetDriverAvailability(ctx context.Context, driverID string, available bool, seen time.Time) error
+	ListRestaurants(ctx context.Context, f db.RestaurantFilter) ([]*models.User, error)
+	ListNearbyRestaurants(ctx context.Context, lat, lng, radiusMeters float64, offset, limit int64) ([]*db.NearbyRestaurant, error)
+	DeleteUser(ctx context.Context, id string) error
+
+	SaveAddress(ctx context.Context, addr *models.SavedAddress) error
+	GetAddress(ctx context.Context, id string) (*models.SavedAddress, error)
+	ListAddresses(ctx context.Context, userID string) ([]*models.SavedAddress, error)
+	DeleteAddress(ctx context.Context, id string) error
+
+	SaveOrder(ctx context.Context, order *models.Order) error
+	GetOrder(ctx context.Context, id string) (*models.Order, error)
+	GetOrderSnapshot(ctx context.Context, id string) (*models.OrderSnapshot, error)
+	GetOrderBriefs(ctx context.Context, ids []string) ([]*models.Order, error)
+	ListOrders(ctx context.Context, f db.OrderFilter) ([]*models.Order, error)
+	ClaimOrder(ctx context.Context, orderID, driverID string, audit models.AuditEntry) (bool, error)
+	ReplaceOrderIfStatus(ctx context.Context, order *models.Order, expected models.OrderStatus) (bool, error)
+	SetOrderTip(ctx context.Context, orderID string, tip float64, breakdown *models.PriceBreakdown, audit models.AuditEntry) (bool, error)
+	SetItemPrepStatus(ctx context.Context, orderID, menuItemID string, status models.PrepStatus, audit models.AuditEntry) (bool, error)
+	RateOrder(ctx context.Context, orderID string, rating *models.OrderRating, audit models.AuditEntry) (bool, error)
+	RestaurantRating(ctx context.Context, restaurantID string) (float64, int, error)
+	CountOrdersByStatus(ctx context.Context, f db.OrderFilter) (map[models.OrderStatus]int, error)
+	PopularMenuItems(ctx context.Context, f db.OrderFilter, limit int64) ([]models.PopularItem, error)
+	UpdateDriverLocation(ctx context.Context, orderID, driverID string, loc models.DriverLocation) (bool, error)
+	ListLocationTrail(ctx context.Context, orderID string) ([]models.DriverLocation, error)
+	ListDeliveredOrders(ctx context.Context, restaurantID string, limit int64) ([]*models.Order, error)
+	ListKitchenQueue(ctx context.Context, restaurantID string) ([]*models.Order, error)
+	ListDriverQueue(ctx context.Context, driverID string) ([]*models.Order, error)
+	NextOrderSequence(ctx context.Context, restaurantID string) (int64, error)
+
+	SaveCoupon(ctx context.Context, coupon *models.Coupon) error
+	GetCoupon(ctx context.Context, code string) (*models.Coupon, error)
+	RedeemCoupon(ctx context.Context, code string) (bool, error)
+	ReleaseCoupon(ctx context.Context, code string) error
+
+	SaveMenuItem(ctx context.Context, item *models.MenuItem) error
+	SaveMenuItems(ctx context.Context, items []*models.MenuItem) (failed map[int]error, err error)
+	GetMenuItem(ctx context.Context, id string) (*models.MenuItem, error)
+	ListMenuItems(ctx context.Context, f db.MenuFilter) ([]*models.MenuItem, error)
+	UpdateMenuItem(ctx context.Context, item *models.MenuItem) error
+	SetMenuItemAvailability(ctx context.Context, id string, available bool) error
+	MenuItemNameTaken(ctx context.Context, restaurantID, name, excludeID string) (bool, error)
+	MenuItemIDsOf(ctx context.Context, restaurantID string, ids []string) (map[string]bool, error)
+	SetMenuItemsAvailability(ctx context.Context, restaurantID string, ids []string, available bool) (int64, error)
+	DeleteMenuItem(ctx context.Context, id string) error
+	CountMenuItems(ctx context.Context, f db.MenuFilter) (int64, error)
+	CountMenuItemsByCategory(ctx context.Context, restaurantID string) ([]models.MenuCategoryCount, error)
+
+	SaveMenuCategory(ctx context.Context, c *models.MenuCategory) error
+	EnsureMenuCategory(ctx context.Context, c *models.MenuCategory) (*models.MenuCategory, error)
+	GetMenuCategory(ctx context.Context, id string) (*models.MenuCategory, error)
+	ListMenuCategories(ctx context.Context, restaurantID string) ([]*models.MenuCategory, error)
+	DeleteMenuCategory(ctx context.Context, id string) error
+}
+
+var _ Store = (*db.Store)(nil)
@@ -1,10 +1,14 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
+	"food-delivery-api/auth"
 	"food-delivery-api/db"
 	"food-delivery-api/models"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -12,38 +16,71 @@ import (
 
 // UserHandler handles user-related HTTP requests.
 type UserHandler struct {
-	Store *db.Store
+	Store Store
 }
 
 // NewUserHandler creates a new UserHandler.
-func NewUserHandler(store *db.Store) *UserHandler {
+func NewUserHandler(store Store) *UserHandler {
 	return &UserHandler{Store: store}
 }
 
 // RegisterUser handles POST /api/users
-// Creates a new user with the specified name and role.
+// Creates a new user with the specified name, role and password.
 func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
+	req.Phone = strings.TrimSpace(req.Phone)
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+
+	var errs validationErrors
 	if req.Name == "" {
-		respondError(w, http.StatusBadRequest, "Name is required")
+		errs.add("name", "Name is required")
+	}
+	if !req.Role.IsValid() || req.Role == models.RoleAdmin {
+		errs.add("role", "Role must be one of: customer, restaurant, driver")
+	}
+	if req.Phone == "" && (req.Role == models.RoleCustomer || req.Role == models.RoleDriver) {
+		errs.add("phone", "Phone is required for customers and drivers")
+	}
+	if req.Phone != "" && !models.IsValidPhone(req.Phone) {
+		errs.add("phone", "Phone must be in E.164 format, e.g. +14155550123")
+	}
+	if req.Email != "" && !models.IsValidEmail(req.Email) {
+		errs.add("email", "Invalid email address")
+	}
+	if len(req.Password) < auth.MinPasswordLength || len(req.Password) > auth.MaxPasswordLength {
+		errs.add("password", fmt.Sprintf("Password must be %d to %d characters", auth.MinPasswordLength, auth.MaxPasswordLength))
+	}
+	if errs.respond(w) {
 		return
 	}
-	if !req.Role.IsValid() {
-		respondError(w, http.StatusBadRequest, "Role must be one of: customer, restaurant, driver")
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save user")
 		return
 	}
 
 	user := &models.User{
-		ID:   uuid.New().String(),
-		Name: req.Name,
-		Role: req.Role,
+		ID:      uuid.New().String(),
+		Name:    req.Name,
+		Role:    req.Role,
+		Address: req.Address,
+		Phone:   req.Phone,
+		Email:   req.Email,
+
+		PasswordHash: hash,
 	}
-	if err := h.Store.SaveUser(user); err != nil {
+	// Drivers start off unavailable until they go online.
+	user.ShowAvailability()
+	if err := h.Store.SaveUser(r.Context(), user); err != nil {
+		if errors.Is(err, db.ErrDuplicateEmail) {
+			respondError(w, http.StatusConflict, "A user with this email already exists")
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "Failed to save user")
 		return
 	}
@@ -52,27 +89,214 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetUser handles GET /api/users/{id}
+// The phone and email are only shown to the user themselves and admins.
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	user, err := h.Store.GetUser(id)
+	user, err := h.Store.GetUser(r.Context(), id)
 	if err != nil {
-		respondError(w, http.StatusNotFound, err.Error())
+		respondErrorCode(w, http.StatusNotFound, CodeUserNotFound, err.Error())
 		return
 	}
+	user.ShowAvailability()
+	if !canSeeContact(r, user.ID) {
+		user.HideContact()
+	}
 
 	respondJSON(w, http.StatusOK, user)
 }
 
 // ListUsers handles GET /api/users
-// Supports optional ?role= query parameter for filtering.
+// Supports optional ?role= query parameter for filtering. Phones and emails
+// are hidden as in GetUser.
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	roleFilter := models.Role(r.URL.Query().Get("role"))
-	users, err := h.Store.ListUsers(roleFilter)
+	users, err := h.Store.ListUsers(r.Context(), roleFilter)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to fetch users")
 		return
 	}
+	for _, user := range users {
+		user.ShowAvailability()
+		if !canSeeContact(r, user.ID) {
+			user.HideContact()
+		}
+	}
 	respondJSON(w, http.StatusOK, users)
 }
+
+// SetAvailability handles POST /api/users/{id}/availability
+// Drivers go online or offline. Only available drivers can claim orders or
+// receive pickup alerts. The call also records the driver as seen, so
+// online drivers repeat it as a heartbeat to stay available.
+func (h *UserHandler) SetAvailability(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+
+	if models.Role(role) != models.RoleDriver {
+		respondError(w, http.StatusForbidden, "Only drivers can set availability")
+		return
+	}
+	if id != userID {
+		respondError(w, http.StatusForbidden, "You can only set your own availability")
+		return
+	}
+
+	var req models.UpdateAvailabilityRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	var errs validationErrors
+	if req.Available == nil {
+		errs.add("available", "available is required")
+	}
+	if errs.respond(w) {
+		return
+	}
+
+	if err := h.Store.SetDriverAvailability(r.Context(), id, *req.Available, time.Now()); err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeUserNotFound, err.Error())
+		return
+	}
+	user, err := h.Store.GetUser(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load user")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, user)
+}
+
+// AddAddress handles POST /api/users/{id}/addresses
+// Customers can save delivery addresses for reuse.
+func (h *UserHandler) AddAddress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !canManageAddresses(r, id) {
+		respondError(w, http.StatusForbidden, "You can only manage your own addresses")
+		return
+	}
+
+	var req models.CreateAddressRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Label = strings.TrimSpace(req.Label)
+	req.Address = strings.TrimSpace(req.Address)
+	if req.Label == "" || req.Address == "" {
+		respondError(w, http.StatusBadRequest, "label and address are required")
+		return
+	}
+	if (req.Lat == nil) != (req.Lng == nil) {
+		respondError(w, http.StatusBadRequest, "lat and lng must be provided together")
+		return
+	}
+	if req.Lat != nil && !models.ValidCoordinates(*req.Lat, *req.Lng) {
+		respondError(w, http.StatusBadRequest, "lat must be within ±90 and lng within ±180")
+		return
+	}
+
+	addr := &models.SavedAddress{
+		ID:        uuid.New().String(),
+		UserID:    id,
+		Label:     req.Label,
+		Address:   req.Address,
+		Lat:       req.Lat,
+		Lng:       req.Lng,
+		CreatedAt: time.Now(),
+	}
+	if err := h.Store.SaveAddress(r.Context(), addr); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save address")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, addr)
+}
+
+// ListAddresses handles GET /api/users/{id}/addresses
+func (h *UserHandler) ListAddresses(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if !canManageAddresses(r, id) {
+		respondError(w, http.StatusForbidden, "You can only manage your own addresses")
+		return
+	}
+
+	addrs, err := h.Store.ListAddresses(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to fetch addresses")
+		return
+	}
+	respondJSON(w, http.StatusOK, addrs)
+}
+
+// DeleteAddress handles DELETE /api/users/{id}/addresses/{addressId}
+func (h *UserHandler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	addressID := vars["addressId"]
+
+	if !canManageAddresses(r, id) {
+		respondError(w, http.StatusForbidden, "You can only manage your own addresses")
+		return
+	}
+
+	addr, err := h.Store.GetAddress(r.Context(), addressID)
+	if err != nil || addr.UserID != id {
+		respondError(w, http.StatusNotFound, "Address not found")
+		return
+	}
+	if err := h.Store.DeleteAddress(r.Context(), addressID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete address")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Address deleted"})
+}
+
+// DeleteUser handles DELETE /api/admin/users/{id}
+// Admin only. Removes the account and its saved addresses; the user's
+// orders are kept. Admins cannot delete themselves.
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	userID := r.Context().Value(ContextKeyUserID).(string)
+	if id == userID {
+		respondError(w, http.StatusBadRequest, "Admins cannot delete their own account")
+		return
+	}
+
+	if _, err := h.Store.GetUser(r.Context(), id); err != nil {
+		respondErrorCode(w, http.StatusNotFound, CodeUserNotFound, "User not found")
+		return
+	}
+	if err := h.Store.DeleteUser(r.Context(), id); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete user")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "User deleted"})
+}
+
+// canSeeContact reports whether the caller may see the phone and email of
+// the given user: the user themselves and admins may.
+func canSeeContact(r *http.Request, userID string) bool {
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	callerID := r.Context().Value(ContextKeyUserID).(string)
+	return models.Role(role) == models.RoleAdmin || callerID == userID
+}
+
+// canManageAddresses reports whether the caller is the customer who owns
+// the address book.
+func canManageAddresses(r *http.Request, ownerID string) bool {
+	role := r.Context().Value(ContextKeyUserRole).(string)
+	userID := r.Context().Value(ContextKeyUserID).(string)
+	return models.Role(role) == models.RoleCustomer && userID == ownerID
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// FieldError describes a problem with one field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validationErrors collects every problem with a request so clients can
+// show them all at once rather than one per round trip.
+type validationErrors []FieldError
+
+// add records a problem with field.
+func (v *validationErrors) add(field, message string) {
+	*v = append(*v, FieldError{Field: field, Message: message})
+}
+
+// Error joins the messages, for callers that report a single string.
+func (v validationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, e := range v {
+		messages[i] = e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// respond writes a 400 listing every problem under "errors" and reports
+// whether there were any. The top-level error is the first message, so
+// clients that only read it still get a useful explanation.
+func (v validationErrors) respond(w http.ResponseWriter) bool {
+	if len(v) == 0 {
+		return false
+	}
+	respondErrorDetails(w, http.StatusBadRequest, CodeValidationFailed, v[0].Message, map[string]interface{}{"errors": v})
+	return true
+}
@@ -1,86 +1,377 @@
 package main
 
 import (
+	"context"
+	"food-delivery-api/config"
 	"food-delivery-api/db"
+	"food-delivery-api/geocode"
 	"food-delivery-api/handlers"
+	"food-delivery-api/metrics"
+	"food-delivery-api/models"
+	"food-delivery-api/notify"
+	"food-delivery-api/payment"
+	"food-delivery-api/presence"
+	"food-delivery-api/scheduler"
+	"food-delivery-api/statemachine"
+	"food-delivery-api/timeout"
+	"food-delivery-api/webhook"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	// MongoDB connection URI — defaults to localhost.
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		mongoURI = "mongodb://localhost:27017"
+	// All configuration comes from the environment; see the README's
+	// Configuration table.
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("❌ Invalid configuration: %v", err)
+	}
+
+	// Optionally replace the built-in order lifecycle with one from a JSON file.
+	if cfg.StateMachineFile != "" {
+		if err := statemachine.Load(cfg.StateMachineFile); err != nil {
+			log.Fatalf("❌ Invalid state machine file: %v", err)
+		}
+		log.Printf("🔀 Loaded order lifecycle from %s", cfg.StateMachineFile)
 	}
 
 	// Connect to MongoDB.
-	store, err := db.NewStore(mongoURI)
+	store, err := db.NewStore(cfg.MongoURI, cfg.MongoDatabase)
 	if err != nil {
 		log.Fatalf("❌ Failed to connect to MongoDB: %v", err)
 	}
 	defer store.Disconnect()
 
+	// Optionally seed empty collections from a JSON fixtures file.
+	if cfg.SeedFile != "" {
+		fixtures, err := db.LoadFixtures(cfg.SeedFile)
+		if err != nil {
+			log.Fatalf("❌ Invalid seed file: %v", err)
+		}
+		if err := store.Seed(context.Background(), fixtures); err != nil {
+			log.Fatalf("❌ Failed to seed database: %v", err)
+		}
+	}
+
 	// Initialize handlers.
+	authHandler := handlers.NewAuthHandler(store, []byte(cfg.JWTSecret), cfg.JWTTTL)
 	orderHandler := handlers.NewOrderHandler(store)
+	orderHandler.CancellationFees = cfg.CancellationFees
+	orderHandler.CancelGracePeriod = cfg.CancelGracePeriod
+	orderHandler.BlockLateCancels = cfg.BlockLateCancels
+	orderHandler.ETA = cfg.ETA
+	orderHandler.TipWindow = cfg.TipWindow
+	orderHandler.Pricing = cfg.Pricing
+	orderHandler.RevertWindow = cfg.RevertWindow
+
+	// Restaurants with a webhook_url are notified of status changes, signed
+	// with WEBHOOK_SECRET. Webhooks are disabled when it is unset.
+	if cfg.WebhookSecret != "" {
+		orderHandler.Webhooks = webhook.NewDispatcher([]byte(cfg.WebhookSecret))
+	}
+
+	// Drivers are alerted when an order is ready for pickup. DRIVER_NOTIFIER
+	// is "log" (default), "webhook" (posts to DRIVER_NOTIFY_URL) or "none".
+	// DRIVER_NOTIFY_URL is ours, so unlike restaurant webhooks it may be an
+	// internal address.
+	var alertDispatcher *webhook.Dispatcher
+	if cfg.WebhookSecret != "" {
+		alertDispatcher = webhook.NewInternalDispatcher([]byte(cfg.WebhookSecret))
+	}
+	orderHandler.DriverAlerts, err = notify.Parse(cfg.DriverNotifier, cfg.DriverNotifyURL, alertDispatcher)
+	if err != nil {
+		log.Fatalf("❌ Invalid DRIVER_NOTIFIER: %v", err)
+	}
+
+	// Card orders are paid through PAYMENT_PROVIDER: "mock" (default), an
+	// in-memory gateway that approves everything, or "none" to record card
+	// payments by hand.
+	orderHandler.Payments, err = payment.Parse(cfg.PaymentProvider)
+	if err != nil {
+		log.Fatalf("❌ Invalid PAYMENT_PROVIDER: %v", err)
+	}
+
+	// Delivery addresses sent without coordinates are located through
+	// GEOCODER: "nominatim" (at GEOCODER_URL, or OpenStreetMap's public
+	// server), "mock" or "none" (default). Answers are cached for
+	// GEOCODE_CACHE_TTL so repeated addresses are only looked up once.
+	geocoder, err := geocode.Parse(cfg.Geocoder, cfg.GeocoderURL)
+	if err != nil {
+		log.Fatalf("❌ Invalid GEOCODER: %v", err)
+	}
+	if geocoder != nil {
+		orderHandler.Geocoder = geocode.NewCache(geocoder, cfg.GeocodeCacheTTL, geocode.DefaultCacheSize)
+	}
+
 	userHandler := handlers.NewUserHandler(store)
 	menuHandler := handlers.NewMenuHandler(store)
+	restaurantHandler := handlers.NewRestaurantHandler(store)
+	couponHandler := handlers.NewCouponHandler(store)
+	healthHandler := handlers.NewHealthHandler(store)
+
+	// Request and order metrics are served in the Prometheus text format at
+	// /metrics. Order counts by status come from the database and are cached
+	// for METRICS_STATUS_REFRESH between scrapes.
+	registry := metrics.New()
+	orderHandler.Metrics = registry
+	metricsHandler := handlers.NewMetricsHandler(store, registry)
+	metricsHandler.StatusRefresh = cfg.MetricsStatusRefresh
 
 	// Set up router.
 	r := mux.NewRouter()
 
+	// Wrap responses in a {data, error, meta} envelope when RESPONSE_ENVELOPE
+	// is true; clients can also opt in or out per request with X-Envelope.
+	r.Use(handlers.EnvelopeMiddleware(cfg.ResponseEnvelope))
+	r.Use(handlers.RouteMiddleware)
+
+	// Per-client rate limits, in requests per minute. Authenticated requests
+	// are keyed by user, public ones by IP. Placing orders has its own,
+	// stricter budget.
+	readLimit := handlers.NewRateLimiter(cfg.RateLimitReads)
+	writeLimit := handlers.NewRateLimiter(cfg.RateLimitWrites)
+	orderLimit := handlers.NewRateLimiter(cfg.RateLimitOrders)
+	limit := handlers.LimitByMethod(readLimit, writeLimit)
+
 	// --- Public routes (no auth required) ---
-	r.HandleFunc("/api/users", userHandler.RegisterUser).Methods("POST")
-	r.HandleFunc("/api/users", userHandler.ListUsers).Methods("GET")
-	r.HandleFunc("/api/users/{id}", userHandler.GetUser).Methods("GET")
-	r.HandleFunc("/api/restaurants/{id}/menu", menuHandler.GetMenu).Methods("GET")
-
-	// Health check.
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status": "ok"}`))
-	}).Methods("GET")
+	r.Handle("/api/auth/login", limit(http.HandlerFunc(authHandler.Login))).Methods("POST")
+	r.Handle("/api/users", limit(http.HandlerFunc(userHandler.RegisterUser))).Methods("POST")
+	r.Handle("/api/restaurants", limit(http.HandlerFunc(restaurantHandler.ListRestaurants))).Methods("GET")
+	r.Handle("/api/restaurants/nearby", limit(http.HandlerFunc(restaurantHandler.NearbyRestaurants))).Methods("GET")
+	r.Handle("/api/restaurants/{id}/menu", limit(http.HandlerFunc(menuHandler.GetMenu))).Methods("GET")
+	r.Handle("/api/restaurants/{id}/menu/categories", limit(http.HandlerFunc(menuHandler.GetMenuCategories))).Methods("GET")
+	r.Handle("/api/restaurants/{id}/categories", limit(http.HandlerFunc(menuHandler.ListCategories))).Methods("GET")
+	r.Handle("/api/restaurants/{id}/rating", limit(http.HandlerFunc(restaurantHandler.GetRating))).Methods("GET")
+	r.Handle("/api/statuses/{status}/transitions", limit(http.HandlerFunc(orderHandler.GetStatusTransitions))).Methods("GET")
+	r.Handle("/api/orders/lifecycle", limit(http.HandlerFunc(orderHandler.GetLifecycle))).Methods("GET")
+
+	// Health checks. /health is kept as an alias of /healthz for existing
+	// monitors.
+	r.HandleFunc("/healthz", healthHandler.Live).Methods("GET")
+	r.HandleFunc("/health", healthHandler.Live).Methods("GET")
+	r.HandleFunc("/readyz", healthHandler.Ready).Methods("GET")
+	r.HandleFunc("/metrics", metricsHandler.Metrics).Methods("GET")
 
 	// --- Protected routes (auth middleware applied per-handler) ---
-	auth := handlers.AuthMiddleware
-	r.Handle("/api/orders", auth(http.HandlerFunc(orderHandler.CreateOrder))).Methods("POST")
+	// Rate limiting runs after authentication so it can key on the user.
+	authenticate := handlers.NewAuthMiddleware(store, []byte(cfg.JWTSecret))
+	auth := func(h http.Handler) http.Handler { return authenticate(limit(h)) }
+	r.Handle("/api/users", auth(http.HandlerFunc(userHandler.ListUsers))).Methods("GET")
+	r.Handle("/api/users/{id}", auth(http.HandlerFunc(userHandler.GetUser))).Methods("GET")
+	r.Handle("/api/users/{id}/addresses", auth(http.HandlerFunc(userHandler.AddAddress))).Methods("POST")
+	r.Handle("/api/users/{id}/addresses", auth(http.HandlerFunc(userHandler.ListAddresses))).Methods("GET")
+	r.Handle("/api/users/{id}/addresses/{addressId}", auth(http.HandlerFunc(userHandler.DeleteAddress))).Methods("DELETE")
+	r.Handle("/api/users/{id}/availability", auth(http.HandlerFunc(userHandler.SetAvailability))).Methods("POST")
+	r.Handle("/api/orders", authenticate(orderLimit.Middleware(http.HandlerFunc(orderHandler.CreateOrder)))).Methods("POST")
 	r.Handle("/api/orders", auth(http.HandlerFunc(orderHandler.ListOrders))).Methods("GET")
+	r.Handle("/api/orders/driver-queue", auth(http.HandlerFunc(orderHandler.GetDriverQueue))).Methods("GET")
+	r.Handle("/api/orders/batch", auth(http.HandlerFunc(orderHandler.BatchOrders))).Methods("POST")
 	r.Handle("/api/orders/{id}", auth(http.HandlerFunc(orderHandler.GetOrder))).Methods("GET")
 	r.Handle("/api/orders/{id}/status", auth(http.HandlerFunc(orderHandler.UpdateOrderStatus))).Methods("PATCH")
+	r.Handle("/api/orders/{id}/reorder", authenticate(orderLimit.Middleware(http.HandlerFunc(orderHandler.Reorder)))).Methods("POST")
+	r.Handle("/api/orders/{id}/items", auth(http.HandlerFunc(orderHandler.GetOrderItems))).Methods("GET")
+	r.Handle("/api/orders/{id}/items", auth(http.HandlerFunc(orderHandler.UpdateOrderItems))).Methods("PATCH")
+	r.Handle("/api/orders/{id}/items/{itemId}/prep", auth(http.HandlerFunc(orderHandler.UpdateItemPrep))).Methods("PATCH")
+	r.Handle("/api/orders/{id}/assign", auth(http.HandlerFunc(orderHandler.AssignDriver))).Methods("POST")
+	r.Handle("/api/orders/{id}/tip", auth(http.HandlerFunc(orderHandler.SetTip))).Methods("POST")
+	r.Handle("/api/orders/{id}/payment", auth(http.HandlerFunc(orderHandler.UpdatePayment))).Methods("POST")
+	r.Handle("/api/orders/{id}/delay", auth(http.HandlerFunc(orderHandler.ReportDelay))).Methods("POST")
+	r.Handle("/api/orders/{id}/location", auth(http.HandlerFunc(orderHandler.UpdateLocation))).Methods("POST")
+	r.Handle("/api/orders/{id}/location", auth(http.HandlerFunc(orderHandler.GetLocation))).Methods("GET")
+	r.Handle("/api/orders/{id}/rating", auth(http.HandlerFunc(orderHandler.RateOrder))).Methods("POST")
 	r.Handle("/api/orders/{id}/history", auth(http.HandlerFunc(orderHandler.GetOrderHistory))).Methods("GET")
+	r.Handle("/api/orders/{id}/audit", auth(http.HandlerFunc(orderHandler.GetOrderAudit))).Methods("GET")
+	r.Handle("/api/orders/{id}/receipt", auth(http.HandlerFunc(orderHandler.GetOrderReceipt))).Methods("GET")
 	r.Handle("/api/orders/{id}/transitions", auth(http.HandlerFunc(orderHandler.GetAllowedTransitions))).Methods("GET")
+	r.Handle("/api/orders/{id}/eta", auth(http.HandlerFunc(orderHandler.GetOrderETA))).Methods("GET")
+	r.Handle("/api/orders/{id}/stream", auth(http.HandlerFunc(orderHandler.StreamOrder))).Methods("GET")
+	r.Handle("/api/orders/{id}/events", auth(http.HandlerFunc(orderHandler.StreamOrderEvents))).Methods("GET")
 
 	// Menu management (auth required — only restaurant owner).
 	r.Handle("/api/restaurants/{id}/menu", auth(http.HandlerFunc(menuHandler.AddMenuItem))).Methods("POST")
+	r.Handle("/api/restaurants/{id}/menu/bulk", auth(http.HandlerFunc(menuHandler.AddMenuItems))).Methods("POST")
+	r.Handle("/api/restaurants/{id}/menu/availability", auth(http.HandlerFunc(menuHandler.SetAvailabilityBulk))).Methods("PATCH")
+	r.Handle("/api/restaurants/{id}/menu/{itemId}", auth(http.HandlerFunc(menuHandler.UpdateMenuItem))).Methods("PUT")
 	r.Handle("/api/restaurants/{id}/menu/{itemId}", auth(http.HandlerFunc(menuHandler.DeleteMenuItem))).Methods("DELETE")
+	r.Handle("/api/restaurants/{id}/menu/{itemId}/availability", auth(http.HandlerFunc(menuHandler.SetAvailability))).Methods("PATCH")
+	r.Handle("/api/restaurants/{id}/categories", auth(http.HandlerFunc(menuHandler.AddCategory))).Methods("POST")
+	r.Handle("/api/restaurants/{id}/categories/{categoryId}", auth(http.HandlerFunc(menuHandler.DeleteCategory))).Methods("DELETE")
+
+	// Restaurant settings (auth required — only restaurant owner).
+	r.Handle("/api/restaurants/{id}/settings", auth(http.HandlerFunc(restaurantHandler.UpdateSettings))).Methods("PATCH")
+	r.Handle("/api/restaurants/{id}/blackout-dates", auth(http.HandlerFunc(restaurantHandler.UpdateBlackoutDates))).Methods("PUT")
+	r.Handle("/api/restaurants/{id}/cuisine", auth(http.HandlerFunc(restaurantHandler.UpdateCuisine))).Methods("PUT")
+	r.Handle("/api/restaurants/{id}/location", auth(http.HandlerFunc(restaurantHandler.UpdateRestaurantLocation))).Methods("PUT")
+	r.Handle("/api/restaurants/{id}/orders/summary", auth(http.HandlerFunc(restaurantHandler.GetOrderSummary))).Methods("GET")
+	r.Handle("/api/restaurants/{id}/queue", auth(http.HandlerFunc(restaurantHandler.GetKitchenQueue))).Methods("GET")
+	r.Handle("/api/restaurants/{id}/menu/popular", auth(http.HandlerFunc(restaurantHandler.GetPopularItems))).Methods("GET")
+
+	// Admin endpoints (auth required — admin role only).
+	admin := func(h http.Handler) http.Handler {
+		return authenticate(handlers.RequireRole(models.RoleAdmin)(limit(h)))
+	}
+	r.Handle("/api/admin/orders", admin(http.HandlerFunc(orderHandler.ListOrders))).Methods("GET")
+	r.Handle("/api/admin/orders/{id}/status", admin(http.HandlerFunc(orderHandler.OverrideStatus))).Methods("POST")
+	r.Handle("/api/admin/users/{id}", admin(http.HandlerFunc(userHandler.DeleteUser))).Methods("DELETE")
+	r.Handle("/api/admin/coupons", admin(http.HandlerFunc(couponHandler.CreateCoupon))).Methods("POST")
 
 	// --- Serve frontend static files ---
 	r.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
 
 	// Start server.
-	addr := ":8080"
+	addr := cfg.ListenAddr
 	log.Printf("🚀 Food Delivery API running on http://localhost%s", addr)
 	log.Printf("🌐 Open http://localhost%s in your browser for the dashboard", addr)
 	log.Printf("📖 API Endpoints:")
+	log.Printf("   POST   /api/auth/login                     - Obtain access token")
 	log.Printf("   POST   /api/users                          - Register user")
 	log.Printf("   GET    /api/users                          - List users")
 	log.Printf("   GET    /api/users/{id}                     - Get user")
+	log.Printf("   POST   /api/users/{id}/addresses            - Save delivery address (customer)")
+	log.Printf("   GET    /api/users/{id}/addresses            - List saved addresses (customer)")
+	log.Printf("   DELETE /api/users/{id}/addresses/{addressId} - Delete saved address (customer)")
+	log.Printf("   POST   /api/users/{id}/availability         - Go online/offline (driver)")
+	log.Printf("   GET    /api/restaurants                     - Search restaurants")
+	log.Printf("   GET    /api/restaurants/nearby              - Restaurants near a location")
 	log.Printf("   GET    /api/restaurants/{id}/menu           - View restaurant menu")
+	log.Printf("   GET    /api/restaurants/{id}/menu/categories - Menu categories with item counts")
+	log.Printf("   GET    /api/restaurants/{id}/categories     - List menu categories")
+	log.Printf("   GET    /api/restaurants/{id}/rating         - Restaurant average rating")
 	log.Printf("   POST   /api/restaurants/{id}/menu           - Add menu item (restaurant)")
+	log.Printf("   POST   /api/restaurants/{id}/menu/bulk      - Add many menu items (restaurant)")
+	log.Printf("   PATCH  /api/restaurants/{id}/menu/availability - Toggle many items' availability (restaurant)")
+	log.Printf("   PUT    /api/restaurants/{id}/menu/{itemId}  - Update menu item")
 	log.Printf("   DELETE /api/restaurants/{id}/menu/{itemId}  - Delete menu item")
+	log.Printf("   PATCH  /api/restaurants/{id}/menu/{itemId}/availability - Toggle item availability")
+	log.Printf("   POST   /api/restaurants/{id}/categories     - Add menu category (restaurant)")
+	log.Printf("   DELETE /api/restaurants/{id}/categories/{categoryId} - Delete unused menu category (restaurant)")
+	log.Printf("   PATCH  /api/restaurants/{id}/settings       - Update restaurant settings")
+	log.Printf("   PUT    /api/restaurants/{id}/blackout-dates - Set blackout dates")
+	log.Printf("   PUT    /api/restaurants/{id}/cuisine        - Set cuisine and tags")
+	log.Printf("   PUT    /api/restaurants/{id}/location       - Set restaurant location")
+	log.Printf("   GET    /api/restaurants/{id}/orders/summary - Order counts by status (restaurant)")
+	log.Printf("   GET    /api/restaurants/{id}/queue          - Orders to cook next, oldest first (restaurant)")
+	log.Printf("   GET    /api/restaurants/{id}/menu/popular   - Best-selling menu items (restaurant)")
 	log.Printf("   POST   /api/orders                         - Create order (customer)")
 	log.Printf("   GET    /api/orders                          - List orders")
+	log.Printf("   GET    /api/orders/driver-queue             - Driver work queue (driver)")
+	log.Printf("   POST   /api/orders/batch                    - Statuses of many orders")
 	log.Printf("   GET    /api/orders/{id}                     - Get order")
 	log.Printf("   PATCH  /api/orders/{id}/status              - Update status")
+	log.Printf("   POST   /api/orders/{id}/reorder             - Reorder a delivered order (customer)")
+	log.Printf("   GET    /api/orders/{id}/items               - Order lines as ordered")
+	log.Printf("   PATCH  /api/orders/{id}/items               - Add/remove items before confirmation (customer)")
+	log.Printf("   PATCH  /api/orders/{id}/items/{itemId}/prep - Mark item prep status (restaurant)")
+	log.Printf("   POST   /api/orders/{id}/assign              - Claim order (driver)")
+	log.Printf("   POST   /api/orders/{id}/tip                 - Adjust tip after delivery (customer)")
+	log.Printf("   POST   /api/orders/{id}/payment             - Mark order paid or refunded")
+	log.Printf("   POST   /api/orders/{id}/delay               - Report a delay (restaurant or driver)")
+	log.Printf("   POST   /api/orders/{id}/location            - Report driver location (driver)")
+	log.Printf("   GET    /api/orders/{id}/location            - Last known driver location")
+	log.Printf("   POST   /api/orders/{id}/rating              - Rate delivered order (customer)")
 	log.Printf("   GET    /api/orders/{id}/history             - Status history")
+	log.Printf("   GET    /api/orders/{id}/audit               - Audit trail of all changes")
+	log.Printf("   GET    /api/orders/{id}/receipt             - Itemized receipt (?format=text)")
 	log.Printf("   GET    /api/orders/{id}/transitions         - Allowed transitions")
-	log.Printf("   GET    /health                              - Health check")
+	log.Printf("   GET    /api/orders/{id}/eta                 - Delivery estimate")
+	log.Printf("   GET    /api/orders/{id}/stream              - Live status (WebSocket)")
+	log.Printf("   GET    /api/orders/{id}/events              - Live status (server-sent events)")
+	log.Printf("   GET    /api/statuses/{status}/transitions   - Transitions for a status")
+	log.Printf("   GET    /api/orders/lifecycle                - Full order lifecycle graph")
+	log.Printf("   GET    /api/admin/orders                    - List all orders (admin)")
+	log.Printf("   POST   /api/admin/orders/{id}/status        - Force order status (admin)")
+	log.Printf("   DELETE /api/admin/users/{id}                - Delete user (admin)")
+	log.Printf("   POST   /api/admin/coupons                   - Create coupon (admin)")
+	log.Printf("   GET    /healthz                             - Liveness probe")
+	log.Printf("   GET    /readyz                              - Readiness probe")
+	log.Printf("   GET    /metrics                             - Prometheus metrics")
+
+	// Stop background work and drain requests on SIGINT/SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var background sync.WaitGroup
+	for _, l := range []*handlers.RateLimiter{readLimit, writeLimit, orderLimit} {
+		background.Add(1)
+		go func(l *handlers.RateLimiter) {
+			defer background.Done()
+			l.Cleanup(ctx, time.Minute)
+		}(l)
+	}
+	if len(cfg.OrderTimeouts) > 0 {
+		sweeper := timeout.NewSweeper(store, cfg.OrderTimeouts, cfg.OrderTimeoutInterval)
+		sweeper.Events = orderHandler.Events
+		sweeper.Payments = orderHandler.Payments
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			sweeper.Run(ctx)
+		}()
+	}
+	if cfg.DriverIdleTimeout > 0 {
+		presenceSweeper := presence.NewSweeper(store, cfg.DriverIdleTimeout, time.Minute)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			presenceSweeper.Run(ctx)
+		}()
+	}
+	if statemachine.IsKnownStatus(models.StatusScheduled) {
+		activator := scheduler.NewActivator(store, cfg.ScheduleInterval)
+		activator.Events = orderHandler.Events
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			activator.Run(ctx)
+		}()
+	}
+
+	// Request bodies over MAX_BODY_BYTES are rejected with 413.
+	maxBody := handlers.MaxBodyMiddleware(cfg.MaxBodyBytes)
+
+	// Browsers on CORS_ALLOWED_ORIGINS may call the API from another origin,
+	// e.g. a separately deployed dashboard. Unset leaves CORS off.
+	router := maxBody(r)
+	if len(cfg.CORSOrigins) > 0 {
+		router = handlers.CORSMiddleware(cfg.CORSOrigins)(router)
+	}
+
+	// Request logging wraps panic recovery so every route is covered and
+	// recovered panics are logged and counted with their 500 status.
+	logging := handlers.LoggingMiddleware(registry)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           logging(handlers.RecoveryMiddleware(router)),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
 
-	if err := http.ListenAndServe(addr, r); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	<-ctx.Done()
+	log.Printf("🛑 Shutting down")
+	// Fail readiness first and give load balancers SHUTDOWN_DELAY to notice
+	// before the listener closes.
+	healthHandler.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+	// Shutdown does not wait for hijacked WebSocket connections and would
+	// wait out open event streams; closing the bus ends both so clients
+	// reconnect elsewhere.
+	orderHandler.Events.Close()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown: %v", err)
 	}
+	background.Wait()
 }
@@ -0,0 +1,204 @@
+package memstore
+
+import (
+	"bytes"
+	"cmp"
+	"food-delivery-api/db"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// collection holds documents by ID, encoded as BSON. Stored documents are
+// copies, so callers cannot change them by accident, and values round-trip
+// as they do through MongoDB: times keep millisecond precision and
+// omitempty fields come back empty.
+type collection struct {
+	docs map[string]bson.Raw
+	// ids lists the documents in insertion order, MongoDB's natural order
+	// for unsorted queries.
+	ids []string
+}
+
+func newCollection() *collection {
+	return &collection{docs: make(map[string]bson.Raw)}
+}
+
+// put inserts or replaces the document with the given ID.
+func (c *collection) put(id string, doc interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.docs[id]; !ok {
+		c.ids = append(c.ids, id)
+	}
+	c.docs[id] = raw
+	return nil
+}
+
+// has reports whether a document with the given ID exists.
+func (c *collection) has(id string) bool {
+	_, ok := c.docs[id]
+	return ok
+}
+
+// delete removes the document with the given ID, if any.
+func (c *collection) delete(id string) {
+	if !c.has(id) {
+		return
+	}
+	delete(c.docs, id)
+	c.ids = slices.DeleteFunc(c.ids, func(other string) bool { return other == id })
+}
+
+// get decodes the document with the given ID, returning nil if there is
+// none.
+func get[T any](c *collection, id string) (*T, error) {
+	raw, ok := c.docs[id]
+	if !ok {
+		return nil, nil
+	}
+	doc := new(T)
+	if err := bson.Unmarshal(raw, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// find decodes the documents match accepts, in natural order. A nil match
+// accepts every document. The result is never nil.
+func find[T any](c *collection, match func(*T) bool) ([]*T, error) {
+	docs := []*T{}
+	for _, id := range c.ids {
+		doc := new(T)
+		if err := bson.Unmarshal(c.docs[id], doc); err != nil {
+			return nil, err
+		}
+		if match == nil || match(doc) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// sortDocs orders docs by the BSON field named in s, or in def if s is
+// empty. Ties are broken by ID in the same direction, as db.Store does.
+func sortDocs[T any](docs []*T, s, def db.Sort) error {
+	if s.Field == "" {
+		s = def
+	}
+	type keyed struct {
+		doc       *T
+		field, id bson.RawValue
+	}
+	keys := make([]keyed, len(docs))
+	for i, doc := range docs {
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		raw := bson.Raw(data)
+		keys[i] = keyed{doc: doc, field: raw.Lookup(strings.Split(s.Field, ".")...), id: raw.Lookup("_id")}
+	}
+	slices.SortStableFunc(keys, func(a, b keyed) int {
+		c := compareValues(a.field, b.field)
+		if c == 0 {
+			c = compareValues(a.id, b.id)
+		}
+		if s.Desc {
+			return -c
+		}
+		return c
+	})
+	for i, k := range keys {
+		docs[i] = k.doc
+	}
+	return nil
+}
+
+// page returns the docs selected by offset and limit; zero limit means all.
+func page[T any](docs []T, offset, limit int64) []T {
+	if offset >= int64(len(docs)) {
+		return docs[:0]
+	}
+	docs = docs[offset:]
+	if limit > 0 && limit < int64(len(docs)) {
+		docs = docs[:limit]
+	}
+	return docs
+}
+
+// compareValues compares BSON values in MongoDB's sort order: missing and
+// null first, then numbers, strings, documents, arrays, booleans and dates.
+func compareValues(a, b bson.RawValue) int {
+	if c := cmp.Compare(typeRank(a.Type), typeRank(b.Type)); c != 0 {
+		return c
+	}
+	switch typeRank(a.Type) {
+	case rankNull:
+		return 0
+	case rankNumber:
+		return cmp.Compare(number(a), number(b))
+	case rankString:
+		return strings.Compare(a.StringValue(), b.StringValue())
+	case rankBoolean:
+		return cmp.Compare(boolRank(a.Boolean()), boolRank(b.Boolean()))
+	case rankDate:
+		return cmp.Compare(a.DateTime(), b.DateTime())
+	}
+	return bytes.Compare(a.Value, b.Value)
+}
+
+const (
+	rankNull = iota
+	rankNumber
+	rankString
+	rankDocument
+	rankArray
+	rankBoolean
+	rankDate
+	rankOther
+)
+
+// typeRank places a BSON type in MongoDB's comparison order. A missing
+// field has type 0 and sorts with null.
+func typeRank(t bsontype.Type) int {
+	switch t {
+	case 0, bsontype.Null, bsontype.Undefined:
+		return rankNull
+	case bsontype.Double, bsontype.Int32, bsontype.Int64:
+		return rankNumber
+	case bsontype.String:
+		return rankString
+	case bsontype.EmbeddedDocument:
+		return rankDocument
+	case bsontype.Array:
+		return rankArray
+	case bsontype.Boolean:
+		return rankBoolean
+	case bsontype.DateTime:
+		return rankDate
+	}
+	return rankOther
+}
+
+// number returns a numeric BSON value as a float64.
+func number(v bson.RawValue) float64 {
+	switch v.Type {
+	case bsontype.Int32:
+		return float64(v.Int32())
+	case bsontype.Int64:
+		return float64(v.Int64())
+	}
+	return v.Double()
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,1076 @@
+// Package memstore keeps the API's data in memory. Store implements the
+// same operations as db.Store, with the same results and errors, so
+// handlers can be exercised without MongoDB. Nothing is persisted.
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"food-delivery-api/db"
+	"food-delivery-api/models"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is an in-memory stand-in for db.Store. It is safe for concurrent
+// use; each operation is atomic, like the single-document updates db.Store
+// relies on.
+type Store struct {
+	mu         sync.Mutex
+	users      *collection
+	orders     *collection
+	menuItems  *collection
+	addresses  *collection
+	coupons    *collection
+	categories *collection
+	// locations is every driver breadcrumb, in the order recorded.
+	locations []models.LocationPing
+	// counters holds each restaurant's last order sequence number.
+	counters map[string]int64
+}
+
+// New returns an empty Store.
+func New() *Store {
+	return &Store{
+		users:      newCollection(),
+		orders:     newCollection(),
+		menuItems:  newCollection(),
+		addresses:  newCollection(),
+		coupons:    newCollection(),
+		categories: newCollection(),
+		counters:   make(map[string]int64),
+	}
+}
+
+// Ping always succeeds.
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+// WithTransaction runs fn once. Writes are not rolled back when it fails,
+// as with db.Store on a standalone MongoDB server, so callers take the
+// path that undoes partial writes by hand.
+func (s *Store) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// SupportsTransactions reports false; see WithTransaction.
+func (s *Store) SupportsTransactions() bool {
+	return false
+}
+
+// Seed inserts the fixtures into any collection that is currently empty,
+// like db.Store.Seed.
+func (s *Store) Seed(ctx context.Context, f *db.Fixtures) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.users.ids) == 0 {
+		for _, u := range f.Users {
+			if err := s.users.put(u.ID, &u.User); err != nil {
+				return fmt.Errorf("failed to seed users: %w", err)
+			}
+		}
+	}
+	if len(s.menuItems.ids) == 0 {
+		for _, m := range f.MenuItems {
+			if err := s.menuItems.put(m.ID, m); err != nil {
+				return fmt.Errorf("failed to seed menu_items: %w", err)
+			}
+		}
+	}
+	if len(s.orders.ids) == 0 {
+		for _, o := range f.Orders {
+			if err := s.orders.put(o.ID, o); err != nil {
+				return fmt.Errorf("failed to seed orders: %w", err)
+			}
+		}
+	}
+	if len(s.coupons.ids) == 0 {
+		for _, c := range f.Coupons {
+			if err := s.coupons.put(c.Code, c); err != nil {
+				return fmt.Errorf("failed to seed coupons: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// containsFold reports whether substr is within s, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// ==================== USER OPERATIONS ====================
+
+// SaveUser inserts or replaces a user. It returns db.ErrDuplicateEmail if
+// another user has the same email.
+func (s *Store) SaveUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user.Email != "" {
+		taken, err := find(s.users, func(u *models.User) bool {
+			return u.Email == user.Email && u.ID != user.ID
+		})
+		if err != nil {
+			return err
+		}
+		if len(taken) > 0 {
+			return db.ErrDuplicateEmail
+		}
+	}
+	return s.users.put(user.ID, user)
+}
+
+// GetUser retrieves a user by ID.
+func (s *Store) GetUser(ctx context.Context, id string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, err := get[models.User](s.users, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found: %s", id)
+	}
+	return user, nil
+}
+
+// ListUsers returns all users, optionally filtered by role.
+func (s *Store) ListUsers(ctx context.Context, roleFilter models.Role) ([]*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return find(s.users, func(u *models.User) bool {
+		return roleFilter == "" || u.Role == roleFilter
+	})
+}
+
+// ListAvailableDrivers returns the drivers who are currently available.
+func (s *Store) ListAvailableDrivers(ctx context.Context) ([]*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return find(s.users, (*models.User).IsAvailable)
+}
+
+// SetDriverAvailability records whether a driver is available and when
+// they were last seen.
+func (s *Store) SetDriverAvailability(ctx context.Context, driverID string, available bool, seen time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, err := get[models.User](s.users, driverID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Role != models.RoleDriver {
+		return fmt.Errorf("driver not found: %s", driverID)
+	}
+	user.Available = &available
+	user.LastSeen = &seen
+	return s.users.put(user.ID, user)
+}
+
+// MarkIdleDriversUnavailable marks every available driver not seen since
+// before as unavailable and returns how many were changed.
+func (s *Store) MarkIdleDriversUnavailable(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idle, err := find(s.users, func(u *models.User) bool {
+		return u.IsAvailable() && (u.LastSeen == nil || u.LastSeen.Before(before))
+	})
+	if err != nil {
+		return 0, err
+	}
+	unavailable := false
+	for _, u := range idle {
+		u.Available = &unavailable
+		if err := s.users.put(u.ID, u); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(idle)), nil
+}
+
+// ListRestaurants returns restaurant users matching the filter, ordered by
+// name.
+func (s *Store) ListRestaurants(ctx context.Context, f db.RestaurantFilter) ([]*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users, err := find(s.users, func(u *models.User) bool {
+		return u.Role == models.RoleRestaurant &&
+			(f.Cuisine == "" || u.Cuisine == f.Cuisine) &&
+			containsFold(u.Name, f.Query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := sortDocs(users, db.Sort{Field: "name"}, db.Sort{}); err != nil {
+		return nil, err
+	}
+	return page(users, f.Offset, f.Limit), nil
+}
+
+// ListNearbyRestaurants returns restaurants within radiusMeters of lat, lng,
+// nearest first. Restaurants without a location are never included.
+func (s *Store) ListNearbyRestaurants(ctx context.Context, lat, lng, radiusMeters float64, offset, limit int64) ([]*db.NearbyRestaurant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users, err := find(s.users, func(u *models.User) bool {
+		return u.Role == models.RoleRestaurant && u.Geo != nil && len(u.Geo.Coordinates) == 2
+	})
+	if err != nil {
+		return nil, err
+	}
+	nearby := []*db.NearbyRestaurant{}
+	for _, u := range users {
+		// GeoJSON points are [lng, lat].
+		meters := models.DistanceKM(lat, lng, u.Geo.Coordinates[1], u.Geo.Coordinates[0]) * 1000
+		if meters <= radiusMeters {
+			nearby = append(nearby, &db.NearbyRestaurant{User: *u, DistanceMeters: meters})
+		}
+	}
+	slices.SortStableFunc(nearby, func(a, b *db.NearbyRestaurant) int {
+		return cmp.Compare(a.DistanceMeters, b.DistanceMeters)
+	})
+	return page(nearby, offset, limit), nil
+}
+
+// DeleteUser removes a user and their saved addresses. Orders and menu
+// items that reference the user are kept for the record.
+func (s *Store) DeleteUser(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users.delete(id)
+	addrs, err := find(s.addresses, func(a *models.SavedAddress) bool { return a.UserID == id })
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		s.addresses.delete(a.ID)
+	}
+	return nil
+}
+
+// ==================== ADDRESS OPERATIONS ====================
+
+// SaveAddress inserts or replaces a saved address.
+func (s *Store) SaveAddress(ctx context.Context, addr *models.SavedAddress) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addresses.put(addr.ID, addr)
+}
+
+// GetAddress retrieves a saved address by ID.
+func (s *Store) GetAddress(ctx context.Context, id string) (*models.SavedAddress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addr, err := get[models.SavedAddress](s.addresses, id)
+	if err != nil {
+		return nil, err
+	}
+	if addr == nil {
+		return nil, fmt.Errorf("address not found: %s", id)
+	}
+	return addr, nil
+}
+
+// ListAddresses returns a user's saved addresses, oldest first.
+func (s *Store) ListAddresses(ctx context.Context, userID string) ([]*models.SavedAddress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs, err := find(s.addresses, func(a *models.SavedAddress) bool { return a.UserID == userID })
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(addrs, func(a, b *models.SavedAddress) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return addrs, nil
+}
+
+// DeleteAddress removes a saved address.
+func (s *Store) DeleteAddress(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addresses.delete(id)
+	return nil
+}
+
+// ==================== ORDER OPERATIONS ====================
+
+// SaveOrder inserts or replaces an order.
+func (s *Store) SaveOrder(ctx context.Context, order *models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.orders.put(order.ID, order)
+}
+
+// GetOrder retrieves an order by ID.
+func (s *Store) GetOrder(ctx context.Context, id string) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, err := get[models.Order](s.orders, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, fmt.Errorf("%w: %s", db.ErrOrderNotFound, id)
+	}
+	return order, nil
+}
+
+// GetOrderSnapshot retrieves only an order's as-ordered lines and the
+// parties to it.
+func (s *Store) GetOrderSnapshot(ctx context.Context, id string) (*models.OrderSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Decoding skips the fields OrderSnapshot does not have, like a
+	// projection.
+	snapshot, err := get[models.OrderSnapshot](s.orders, id)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("%w: %s", db.ErrOrderNotFound, id)
+	}
+	return snapshot, nil
+}
+
+// GetOrderBriefs retrieves the orders with the given IDs, with only the
+// fields of models.OrderBrief set. Missing IDs are skipped.
+func (s *Store) GetOrderBriefs(ctx context.Context, ids []string) ([]*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders, err := find(s.orders, func(o *models.Order) bool { return slices.Contains(ids, o.ID) })
+	if err != nil {
+		return nil, err
+	}
+	for i, o := range orders {
+		orders[i] = &models.Order{
+			ID:                  o.ID,
+			OrderNumber:         o.OrderNumber,
+			Status:              o.Status,
+			CustomerID:          o.CustomerID,
+			RestaurantID:        o.RestaurantID,
+			DriverID:            o.DriverID,
+			EstimatedDeliveryAt: o.EstimatedDeliveryAt,
+			UpdatedAt:           o.UpdatedAt,
+		}
+	}
+	return orders, nil
+}
+
+// matchOrder reports whether an order meets every criterion of the filter,
+// as db.Store's query does.
+func matchOrder(o *models.Order, f db.OrderFilter) bool {
+	if f.Status != "" && o.Status != f.Status {
+		return false
+	}
+	if f.CustomerID != "" && o.CustomerID != f.CustomerID {
+		return false
+	}
+	if f.RestaurantID != "" && o.RestaurantID != f.RestaurantID {
+		return false
+	}
+	if f.DriverID != "" && o.DriverID != f.DriverID {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && o.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !o.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	if f.Item != "" && !slices.ContainsFunc(o.Items, func(item models.OrderItem) bool {
+		return containsFold(item.Name, f.Item)
+	}) {
+		return false
+	}
+
+	// Admins, like unscoped internal callers, see every order.
+	switch f.ScopeRole {
+	case models.RoleCustomer:
+		return o.CustomerID == f.ScopeUserID
+	case models.RoleRestaurant:
+		return o.RestaurantID == f.ScopeUserID
+	case models.RoleDriver:
+		// Drivers see their own deliveries plus anything awaiting pickup.
+		return o.DriverID == f.ScopeUserID || o.Status == models.StatusReadyForPickup
+	}
+	return true
+}
+
+// ListOrders returns all orders matching the filter, in its sort order.
+func (s *Store) ListOrders(ctx context.Context, f db.OrderFilter) ([]*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders, err := find(s.orders, func(o *models.Order) bool { return matchOrder(o, f) })
+	if err != nil {
+		return nil, err
+	}
+	if err := sortDocs(orders, f.Sort, db.Sort{Field: "created_at", Desc: true}); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// ClaimOrder assigns a driver to a READY_FOR_PICKUP order that has no driver
+// yet, recording the claim in the order's audit trail. It reports whether
+// the claim succeeded.
+func (s *Store) ClaimOrder(ctx context.Context, orderID, driverID string, audit models.AuditEntry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, err := get[models.Order](s.orders, orderID)
+	if err != nil || order == nil || order.Status != models.StatusReadyForPickup || order.DriverID != "" {
+		return false, err
+	}
+	order.DriverID = driverID
+	order.UpdatedAt = time.Now()
+	order.Audit = append(order.Audit, audit)
+	if err := s.orders.put(order.ID, order); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ListStaleOrders returns orders in the given status that have not been
+// updated since before.
+func (s *Store) ListStaleOrders(ctx context.Context, status models.OrderStatus, before time.Time) ([]*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return find(s.orders, func(o *models.Order) bool {
+		return o.Status == status && o.UpdatedAt.Before(before)
+	})
+}
+
+// ListDueScheduledOrders returns SCHEDULED orders whose scheduled time is
+// at or before now.
+func (s *Store) ListDueScheduledOrders(ctx context.Context, now time.Time) ([]*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return find(s.orders, func(o *models.Order) bool {
+		return o.Status == models.StatusScheduled && o.ScheduledFor != nil && !o.ScheduledFor.After(now)
+	})
+}
+
+// ReplaceOrderIfStatus saves the order only if it is still in the expected
+// status. It reports whether the order was saved.
+func (s *Store) ReplaceOrderIfStatus(ctx context.Context, order *models.Order, expected models.OrderStatus) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := get[models.Order](s.orders, order.ID)
+	if err != nil || current == nil || current.Status != expected {
+		return false, err
+	}
+	if err := s.orders.put(order.ID, order); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RateOrder attaches a rating to a DELIVERED order that has not been rated
+// yet, and records it in the order's audit trail. It reports whether the
+// rating was stored.
+func (s *Store) RateOrder(ctx context.Context, orderID string, rating *models.OrderRating, audit models.AuditEntry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, err := get[models.Order](s.orders, orderID)
+	if err != nil || order == nil || order.Status != models.StatusDelivered || order.Rating != nil {
+		return false, err
+	}
+	order.Rating = rating
+	order.Audit = append(order.Audit, audit)
+	if err := s.orders.put(order.ID, order); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetOrderTip changes a DELIVERED order's tip and price breakdown, like
+// db.Store.SetOrderTip.
+func (s *Store) SetOrderTip(ctx context.Context, orderID string, tip float64, breakdown *models.PriceBreakdown, audit models.AuditEntry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, err := get[models.Order](s.orders, orderID)
+	if err != nil || order == nil || order.Status != models.StatusDelivered {
+		return false, err
+	}
+	order.Tip = tip
+	if breakdown != nil {
+		order.PriceBreakdown = breakdown
+	}
+	order.Audit = append(order.Audit, audit)
+	order.UpdatedAt = audit.Timestamp
+	if err := s.orders.put(order.ID, order); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SetItemPrepStatus sets the prep status of the order's lines for a menu
+// item, like db.Store.SetItemPrepStatus.
+func (s *Store) SetItemPrepStatus(ctx context.Context, orderID, menuItemID string, status models.PrepStatus, audit models.AuditEntry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, err := get[models.Order](s.orders, orderID)
+	if err != nil || order == nil || order.Status != models.StatusPreparing {
+		return false, err
+	}
+	for i := range order.Items {
+		if order.Items[i].MenuItemID == menuItemID {
+			order.Items[i].PrepStatus = status
+		}
+	}
+	order.ItemsReady = order.AllItemsReady()
+	order.Audit = append(order.Audit, audit)
+	order.UpdatedAt = audit.Timestamp
+	if err := s.orders.put(order.ID, order); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RestaurantRating averages the star ratings across a restaurant's orders.
+func (s *Store) RestaurantRating(ctx context.Context, restaurantID string) (float64, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rated, err := find(s.orders, func(o *models.Order) bool {
+		return o.RestaurantID == restaurantID && o.Rating != nil
+	})
+	if err != nil || len(rated) == 0 {
+		return 0, 0, err
+	}
+	stars := 0
+	for _, o := range rated {
+		stars += o.Rating.Stars
+	}
+	return float64(stars) / float64(len(rated)), len(rated), nil
+}
+
+// CountOrdersByStatus counts the orders matching the filter, grouped by
+// status.
+func (s *Store) CountOrdersByStatus(ctx context.Context, f db.OrderFilter) (map[models.OrderStatus]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders, err := find(s.orders, func(o *models.Order) bool { return matchOrder(o, f) })
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[models.OrderStatus]int)
+	for _, o := range orders {
+		counts[o.Status]++
+	}
+	return counts, nil
+}
+
+// PopularMenuItems ranks the menu items sold in orders matching the filter
+// by total quantity, returning at most limit items. Cancelled and rejected
+// orders are not sales and are left out.
+func (s *Store) PopularMenuItems(ctx context.Context, f db.OrderFilter, limit int64) ([]models.PopularItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders, err := find(s.orders, func(o *models.Order) bool {
+		return matchOrder(o, f) && o.Status != models.StatusCancelled && o.Status != models.StatusRejected
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Newest first, so each item keeps the name from its latest order.
+	slices.SortStableFunc(orders, func(a, b *models.Order) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	var ranked []*models.PopularItem
+	byID := make(map[string]*models.PopularItem)
+	for _, o := range orders {
+		// An item may appear on several lines of one order; count the order once.
+		counted := make(map[string]bool)
+		for _, line := range o.Items {
+			item := byID[line.MenuItemID]
+			if item == nil {
+				item = &models.PopularItem{MenuItemID: line.MenuItemID, Name: line.Name}
+				byID[line.MenuItemID] = item
+				ranked = append(ranked, item)
+			}
+			item.Quantity += line.Quantity
+			if !counted[line.MenuItemID] {
+				counted[line.MenuItemID] = true
+				item.OrderCount++
+			}
+		}
+	}
+	slices.SortStableFunc(ranked, func(a, b *models.PopularItem) int {
+		if c := cmp.Compare(b.Quantity, a.Quantity); c != 0 {
+			return c
+		}
+		return strings.Compare(a.MenuItemID, b.MenuItemID)
+	})
+	ranked = page(ranked, 0, limit)
+	items := make([]models.PopularItem, len(ranked))
+	for i, item := range ranked {
+		items[i] = *item
+	}
+	return items, nil
+}
+
+// UpdateDriverLocation records the driver's latest position on an order
+// and appends it to the order's breadcrumb trail. The update only applies
+// while the order is assigned to the driver and in transit; it reports
+// false otherwise.
+func (s *Store) UpdateDriverLocation(ctx context.Context, orderID, driverID string, loc models.DriverLocation) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, err := get[models.Order](s.orders, orderID)
+	if err != nil || order == nil || order.DriverID != driverID {
+		return false, err
+	}
+	if order.Status != models.StatusPickedUp && order.Status != models.StatusOutForDelivery {
+		return false, nil
+	}
+	order.DriverLocation = &loc
+	if err := s.orders.put(order.ID, order); err != nil {
+		return false, err
+	}
+	// MongoDB stores times to the millisecond.
+	loc.RecordedAt = loc.RecordedAt.Truncate(time.Millisecond)
+	s.locations = append(s.locations, models.LocationPing{OrderID: orderID, DriverID: driverID, DriverLocation: loc})
+	return true, nil
+}
+
+// ListLocationTrail returns an order's driver breadcrumbs, oldest first.
+// Breadcrumbs older than db.LocationTrailTTL have expired.
+func (s *Store) ListLocationTrail(ctx context.Context, orderID string) ([]models.DriverLocation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expired := time.Now().Add(-db.LocationTrailTTL)
+	trail := []models.DriverLocation{}
+	for _, ping := range s.locations {
+		if ping.OrderID == orderID && ping.RecordedAt.After(expired) {
+			trail = append(trail, ping.DriverLocation)
+		}
+	}
+	slices.SortStableFunc(trail, func(a, b models.DriverLocation) int {
+		return a.RecordedAt.Compare(b.RecordedAt)
+	})
+	return trail, nil
+}
+
+// ListDeliveredOrders returns a restaurant's most recently delivered orders,
+// newest first, capped at limit.
+func (s *Store) ListDeliveredOrders(ctx context.Context, restaurantID string, limit int64) ([]*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders, err := find(s.orders, func(o *models.Order) bool {
+		return o.RestaurantID == restaurantID && o.Status == models.StatusDelivered
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(orders, func(a, b *models.Order) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+	return page(orders, 0, limit), nil
+}
+
+// ListKitchenQueue returns the restaurant's CONFIRMED and PREPARING orders,
+// the ones its kitchen still has to cook.
+func (s *Store) ListKitchenQueue(ctx context.Context, restaurantID string) ([]*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return find(s.orders, func(o *models.Order) bool {
+		return o.RestaurantID == restaurantID &&
+			(o.Status == models.StatusConfirmed || o.Status == models.StatusPreparing)
+	})
+}
+
+// ListDriverQueue returns unclaimed READY_FOR_PICKUP orders together with the
+// driver's own orders that are still in progress.
+func (s *Store) ListDriverQueue(ctx context.Context, driverID string) ([]*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return find(s.orders, func(o *models.Order) bool {
+		if o.Status == models.StatusReadyForPickup && o.DriverID == "" {
+			return true
+		}
+		return o.DriverID == driverID && (o.Status == models.StatusReadyForPickup ||
+			o.Status == models.StatusPickedUp ||
+			o.Status == models.StatusOutForDelivery)
+	})
+}
+
+// NextOrderSequence increments and returns the order sequence for a
+// restaurant, starting at 1.
+func (s *Store) NextOrderSequence(ctx context.Context, restaurantID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[restaurantID]++
+	return s.counters[restaurantID], nil
+}
+
+// ==================== COUPON OPERATIONS ====================
+
+// SaveCoupon inserts a new coupon. It returns db.ErrDuplicateCoupon if the
+// code is already taken.
+func (s *Store) SaveCoupon(ctx context.Context, coupon *models.Coupon) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.coupons.has(coupon.Code) {
+		return db.ErrDuplicateCoupon
+	}
+	return s.coupons.put(coupon.Code, coupon)
+}
+
+// GetCoupon retrieves a coupon by code.
+func (s *Store) GetCoupon(ctx context.Context, code string) (*models.Coupon, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coupon, err := get[models.Coupon](s.coupons, code)
+	if err != nil {
+		return nil, err
+	}
+	if coupon == nil {
+		return nil, fmt.Errorf("coupon not found: %s", code)
+	}
+	return coupon, nil
+}
+
+// RedeemCoupon records one use of a coupon if it is still under its usage
+// limit. It reports whether a use was recorded.
+func (s *Store) RedeemCoupon(ctx context.Context, code string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coupon, err := get[models.Coupon](s.coupons, code)
+	if err != nil || coupon == nil || (coupon.MaxUses != 0 && coupon.Uses >= coupon.MaxUses) {
+		return false, err
+	}
+	coupon.Uses++
+	if err := s.coupons.put(coupon.Code, coupon); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseCoupon gives back a use recorded by RedeemCoupon, for when the
+// order could not be saved.
+func (s *Store) ReleaseCoupon(ctx context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coupon, err := get[models.Coupon](s.coupons, code)
+	if err != nil || coupon == nil || coupon.Uses <= 0 {
+		return err
+	}
+	coupon.Uses--
+	return s.coupons.put(coupon.Code, coupon)
+}
+
+// ==================== MENU OPERATIONS ====================
+
+// duplicateMenuItem reports whether another of the restaurant's items has
+// item's name key, which db.Store's unique index forbids. Items without a
+// name key are not checked.
+func (s *Store) duplicateMenuItem(item *models.MenuItem) (bool, error) {
+	if item.NameKey == "" {
+		return false, nil
+	}
+	same, err := find(s.menuItems, func(m *models.MenuItem) bool {
+		return m.RestaurantID == item.RestaurantID && m.NameKey == item.NameKey && m.ID != item.ID
+	})
+	return len(same) > 0, err
+}
+
+// SaveMenuItem inserts or replaces a menu item. It returns
+// db.ErrDuplicateMenuItem if the restaurant has another item with the same
+// name key.
+func (s *Store) SaveMenuItem(ctx context.Context, item *models.MenuItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dup, err := s.duplicateMenuItem(item)
+	if err != nil {
+		return err
+	}
+	if dup {
+		return db.ErrDuplicateMenuItem
+	}
+	return s.menuItems.put(item.ID, item)
+}
+
+// SaveMenuItems inserts new menu items, skipping any whose ID or name key
+// is taken. failed maps the index of each skipped item to
+// db.ErrDuplicateMenuItem.
+func (s *Store) SaveMenuItems(ctx context.Context, items []*models.MenuItem) (failed map[int]error, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range items {
+		dup, err := s.duplicateMenuItem(item)
+		if err != nil {
+			return nil, err
+		}
+		if dup || s.menuItems.has(item.ID) {
+			if failed == nil {
+				failed = make(map[int]error)
+			}
+			failed[i] = db.ErrDuplicateMenuItem
+			continue
+		}
+		if err := s.menuItems.put(item.ID, item); err != nil {
+			return nil, err
+		}
+	}
+	return failed, nil
+}
+
+// GetMenuItem retrieves a menu item by ID.
+func (s *Store) GetMenuItem(ctx context.Context, id string) (*models.MenuItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, err := get[models.MenuItem](s.menuItems, id)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, fmt.Errorf("menu item not found: %s", id)
+	}
+	return item, nil
+}
+
+// matchMenuItem reports whether a menu item meets every criterion of the
+// filter, as db.Store's query does.
+func matchMenuItem(m *models.MenuItem, f db.MenuFilter) bool {
+	return m.RestaurantID == f.RestaurantID &&
+		(f.Category == "" || strings.EqualFold(m.Category, f.Category)) &&
+		(f.MaxPrice <= 0 || m.Price <= f.MaxPrice) &&
+		(!f.AvailableOnly || m.Available) &&
+		(f.Query == "" || containsFold(m.Name, f.Query) || containsFold(m.Description, f.Query))
+}
+
+// ListMenuItems returns a restaurant's menu items matching the filter, in
+// its sort order.
+func (s *Store) ListMenuItems(ctx context.Context, f db.MenuFilter) ([]*models.MenuItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items, err := find(s.menuItems, func(m *models.MenuItem) bool { return matchMenuItem(m, f) })
+	if err != nil {
+		return nil, err
+	}
+	if err := sortDocs(items, f.Sort, db.Sort{Field: "name"}); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// UpdateMenuItem replaces an existing menu item, keeping its ID. It returns
+// db.ErrDuplicateMenuItem if the new name is taken by another of the
+// restaurant's items.
+func (s *Store) UpdateMenuItem(ctx context.Context, item *models.MenuItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.menuItems.has(item.ID) {
+		return fmt.Errorf("menu item not found: %s", item.ID)
+	}
+	dup, err := s.duplicateMenuItem(item)
+	if err != nil {
+		return err
+	}
+	if dup {
+		return db.ErrDuplicateMenuItem
+	}
+	return s.menuItems.put(item.ID, item)
+}
+
+// SetMenuItemAvailability updates only the available flag of a menu item.
+func (s *Store) SetMenuItemAvailability(ctx context.Context, id string, available bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, err := get[models.MenuItem](s.menuItems, id)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return fmt.Errorf("menu item not found: %s", id)
+	}
+	item.Available = available
+	return s.menuItems.put(item.ID, item)
+}
+
+// MenuItemNameTaken reports whether the restaurant has a menu item other
+// than excludeID whose name matches name, ignoring case and repeated
+// spaces. Items saved before names were unique are compared by name.
+func (s *Store) MenuItemNameTaken(ctx context.Context, restaurantID, name, excludeID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := models.MenuItemKey(name)
+	taken, err := find(s.menuItems, func(m *models.MenuItem) bool {
+		if m.RestaurantID != restaurantID || (excludeID != "" && m.ID == excludeID) {
+			return false
+		}
+		if m.NameKey == "" {
+			return models.MenuItemKey(m.Name) == key
+		}
+		return m.NameKey == key
+	})
+	return len(taken) > 0, err
+}
+
+// MenuItemIDsOf returns which of ids are menu items of the restaurant.
+func (s *Store) MenuItemIDsOf(ctx context.Context, restaurantID string, ids []string) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := make(map[string]bool)
+	for _, id := range ids {
+		item, err := get[models.MenuItem](s.menuItems, id)
+		if err != nil {
+			return nil, err
+		}
+		if item != nil && item.RestaurantID == restaurantID {
+			found[id] = true
+		}
+	}
+	return found, nil
+}
+
+// SetMenuItemsAvailability updates the available flag of the restaurant's
+// menu items among ids, and returns how many changed.
+func (s *Store) SetMenuItemsAvailability(ctx context.Context, restaurantID string, ids []string, available bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items, err := find(s.menuItems, func(m *models.MenuItem) bool {
+		return m.RestaurantID == restaurantID && m.Available != available && slices.Contains(ids, m.ID)
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		item.Available = available
+		if err := s.menuItems.put(item.ID, item); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(items)), nil
+}
+
+// DeleteMenuItem removes a menu item by ID.
+func (s *Store) DeleteMenuItem(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.menuItems.delete(id)
+	return nil
+}
+
+// CountMenuItems returns how many menu items match the filter.
+func (s *Store) CountMenuItems(ctx context.Context, f db.MenuFilter) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items, err := find(s.menuItems, func(m *models.MenuItem) bool { return matchMenuItem(m, f) })
+	return int64(len(items)), err
+}
+
+// CountMenuItemsByCategory counts a restaurant's menu items per category,
+// sorted by category. Categories differing only in case are counted
+// together under the first spelling found.
+func (s *Store) CountMenuItemsByCategory(ctx context.Context, restaurantID string) ([]models.MenuCategoryCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items, err := find(s.menuItems, func(m *models.MenuItem) bool { return m.RestaurantID == restaurantID })
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	byKey := make(map[string]*models.MenuCategoryCount)
+	for _, item := range items {
+		key := strings.ToLower(item.Category)
+		count := byKey[key]
+		if count == nil {
+			count = &models.MenuCategoryCount{Category: item.Category}
+			byKey[key] = count
+			keys = append(keys, key)
+		}
+		count.Count++
+	}
+	slices.Sort(keys)
+	counts := make([]models.MenuCategoryCount, 0, len(keys))
+	for _, key := range keys {
+		counts = append(counts, *byKey[key])
+	}
+	return counts, nil
+}
+
+// ==================== MENU CATEGORY OPERATIONS ====================
+
+// findMenuCategory returns the restaurant's category with the given key,
+// or nil.
+func (s *Store) findMenuCategory(restaurantID, key string) (*models.MenuCategory, error) {
+	same, err := find(s.categories, func(c *models.MenuCategory) bool {
+		return c.RestaurantID == restaurantID && c.Key == key
+	})
+	if err != nil || len(same) == 0 {
+		return nil, err
+	}
+	return same[0], nil
+}
+
+// SaveMenuCategory inserts a new menu category. It returns
+// db.ErrDuplicateCategory if the restaurant already has one with the same
+// key.
+func (s *Store) SaveMenuCategory(ctx context.Context, c *models.MenuCategory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.findMenuCategory(c.RestaurantID, c.Key)
+	if err != nil {
+		return err
+	}
+	if existing != nil || s.categories.has(c.ID) {
+		return db.ErrDuplicateCategory
+	}
+	return s.categories.put(c.ID, c)
+}
+
+// EnsureMenuCategory returns the restaurant's category with c's key,
+// inserting c if there is none yet.
+func (s *Store) EnsureMenuCategory(ctx context.Context, c *models.MenuCategory) (*models.MenuCategory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := s.findMenuCategory(c.RestaurantID, c.Key)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	if err := s.categories.put(c.ID, c); err != nil {
+		return nil, err
+	}
+	return get[models.MenuCategory](s.categories, c.ID)
+}
+
+// GetMenuCategory retrieves a menu category by ID.
+func (s *Store) GetMenuCategory(ctx context.Context, id string) (*models.MenuCategory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := get[models.MenuCategory](s.categories, id)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, fmt.Errorf("category not found: %s", id)
+	}
+	return c, nil
+}
+
+// ListMenuCategories returns a restaurant's menu categories by name.
+func (s *Store) ListMenuCategories(ctx context.Context, restaurantID string) ([]*models.MenuCategory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	categories, err := find(s.categories, func(c *models.MenuCategory) bool { return c.RestaurantID == restaurantID })
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(categories, func(a, b *models.MenuCategory) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return categories, nil
+}
+
+// DeleteMenuCategory removes a menu category by ID.
+func (s *Store) DeleteMenuCategory(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.categories.delete(id)
+	return nil
+}
@@ -0,0 +1,17 @@
+package memstore_test
+
+import (
+	"food-delivery-api/handlers"
+	"food-delivery-api/memstore"
+	"food-delivery-api/presence"
+	"food-delivery-api/scheduler"
+	"food-delivery-api/timeout"
+)
+
+// Store must stay a drop-in for db.Store wherever the API uses one.
+var (
+	_ handlers.Store  = (*memstore.Store)(nil)
+	_ timeout.Store   = (*memstore.Store)(nil)
+	_ scheduler.Store = (*memstore.Store)(nil)
+	_ presence.Store  = (*memstore.Store)(nil)
+)
@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"food-delivery-api/models"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the request latency
+// histogram.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry collects the API's metrics and writes them in the Prometheus text
+// exposition format. It is safe for concurrent use. A nil Registry discards
+// everything recorded to it.
+type Registry struct {
+	mu            sync.Mutex
+	requests      map[requestKey]*histogram
+	ordersCreated uint64
+	// ordersByStatus is a snapshot of the orders collection, set by the
+	// metrics endpoint rather than counted here.
+	ordersByStatus map[models.OrderStatus]int
+}
+
+// requestKey identifies a series of HTTP request metrics. Route is the
+// route's path template, not the raw path, to keep the number of series
+// bounded.
+type requestKey struct {
+	method string
+	route  string
+	status int
+}
+
+type histogram struct {
+	// counts[i] is the number of observations in bucket i alone; the
+	// last element counts those above every bound.
+	counts []uint64
+	total  uint64
+	sum    float64
+}
+
+// New creates an empty Registry.
+func New() *Registry {
+	return &Registry{requests: make(map[requestKey]*histogram)}
+}
+
+// ObserveRequest records one HTTP request and how long it took.
+func (r *Registry) ObserveRequest(method, route string, status int, d time.Duration) {
+	if r == nil {
+		return
+	}
+	key := requestKey{method: method, route: route, status: status}
+	seconds := d.Seconds()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.requests[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(LatencyBuckets)+1)}
+		r.requests[key] = h
+	}
+	h.counts[sort.SearchFloat64s(LatencyBuckets, seconds)]++
+	h.total++
+	h.sum += seconds
+}
+
+// OrderCreated counts a newly placed order.
+func (r *Registry) OrderCreated() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ordersCreated++
+}
+
+// SetOrdersByStatus replaces the number of orders in each status.
+func (r *Registry) SetOrdersByStatus(counts map[models.OrderStatus]int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ordersByStatus = counts
+}
+
+// WriteTo writes every metric in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	if r != nil {
+		r.mu.Lock()
+		r.write(cw)
+		r.mu.Unlock()
+	}
+	if err := cw.w.(*bufio.Writer).Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+// write renders the metrics; the caller holds r.mu.
+func (r *Registry) write(w *countingWriter) {
+	keys := make([]requestKey, 0, len(r.requests))
+	for key := range r.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	w.printf("# HELP http_requests_total HTTP requests by method, route and status.\n")
+	w.printf("# TYPE http_requests_total counter\n")
+	for _, key := range keys {
+		w.printf("http_requests_total{%s} %d\n", key.labels(), r.requests[key].total)
+	}
+
+	w.printf("# HELP http_request_duration_seconds HTTP request latency by method, route and status.\n")
+	w.printf("# TYPE http_request_duration_seconds histogram\n")
+	for _, key := range keys {
+		h := r.requests[key]
+		labels := key.labels()
+		var cumulative uint64
+		for i, bound := range LatencyBuckets {
+			cumulative += h.counts[i]
+			w.printf("http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(bound), cumulative)
+		}
+		w.printf("http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.total)
+		w.printf("http_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(h.sum))
+		w.printf("http_request_duration_seconds_count{%s} %d\n", labels, h.total)
+	}
+
+	w.printf("# HELP orders_created_total Orders placed since the server started.\n")
+	w.printf("# TYPE orders_created_total counter\n")
+	w.printf("orders_created_total %d\n", r.ordersCreated)
+
+	statuses := make([]string, 0, len(r.ordersByStatus))
+	for status := range r.ordersByStatus {
+		statuses = append(statuses, string(status))
+	}
+	sort.Strings(statuses)
+	w.printf("# HELP orders_by_status Orders currently in each status.\n")
+	w.printf("# TYPE orders_by_status gauge\n")
+	for _, status := range statuses {
+		w.printf("orders_by_status{status=\"%s\"} %d\n", escapeLabel(status), r.ordersByStatus[models.OrderStatus(status)])
+	}
+}
+
+func (k requestKey) labels() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\",status=\"%d\"", escapeLabel(k.method), escapeLabel(k.route), k.status)
+}
+
+// escapeLabel escapes a label value as the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countingWriter keeps the first write error and the bytes written, so the
+// rendering code can write without checking each line.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) printf(format string, args ...interface{}) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
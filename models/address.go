@@ -0,0 +1,117 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SavedAddress is a delivery address a customer has stored for reuse.
+type SavedAddress struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	Label     string    `json:"label" bson:"label"`
+	Address   string    `json:"address" bson:"address"`
+	Lat       *float64  `json:"lat,omitempty" bson:"lat,omitempty"`
+	Lng       *float64  `json:"lng,omitempty" bson:"lng,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// CreateAddressRequest is the payload for saving a delivery address.
+type CreateAddressRequest struct {
+	Label   string   `json:"label"`
+	Address string   `json:"address"`
+	Lat     *float64 `json:"lat,omitempty"`
+	Lng     *float64 `json:"lng,omitempty"`
+}
+
+// PostalAddress is a delivery address split into parts, for geocoding and
+// routing. Country is an ISO 3166-1 alpha-2 code such as "US".
+type PostalAddress struct {
+	Street     string `json:"street" bson:"street"`
+	City       string `json:"city" bson:"city"`
+	PostalCode string `json:"postal_code,omitempty" bson:"postal_code,omitempty"`
+	Country    string `json:"country" bson:"country"`
+}
+
+// MaxAddressPartLength caps each part of a PostalAddress.
+const MaxAddressPartLength = 200
+
+// countryCodePattern matches an ISO 3166-1 alpha-2 code. Codes are not
+// checked against the list of assigned ones.
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// postalCodePatterns are the postal code formats of countries we check.
+// Codes for other countries only need to look like a postal code.
+var postalCodePatterns = map[string]*regexp.Regexp{
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] \d[A-Z]\d$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"ES": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? \d[A-Z]{2}$`),
+	"IN": regexp.MustCompile(`^\d{6}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"JP": regexp.MustCompile(`^\d{3}-\d{4}$`),
+	"NL": regexp.MustCompile(`^\d{4} [A-Z]{2}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+}
+
+// genericPostalCodePattern is the loose format for countries without an
+// entry in postalCodePatterns.
+var genericPostalCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,9}$`)
+
+// NormalizeAddressText trims an address and collapses runs of whitespace,
+// newlines included, into single spaces.
+func NormalizeAddressText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Normalize collapses whitespace in every part and upper-cases the country
+// and postal code. Postal codes that are commonly written without their
+// separator, such as "SW1A1AA" or "1000001", get it back.
+func (a *PostalAddress) Normalize() {
+	a.Street = NormalizeAddressText(a.Street)
+	a.City = NormalizeAddressText(a.City)
+	a.Country = strings.ToUpper(NormalizeAddressText(a.Country))
+	a.PostalCode = strings.ToUpper(NormalizeAddressText(a.PostalCode))
+
+	compact := strings.NewReplacer(" ", "", "-", "").Replace(a.PostalCode)
+	switch {
+	case (a.Country == "CA" || a.Country == "GB") && len(compact) >= 5 && len(compact) <= 7:
+		// The inward code is always the last three characters.
+		a.PostalCode = compact[:len(compact)-3] + " " + compact[len(compact)-3:]
+	case a.Country == "NL" && len(compact) == 6:
+		a.PostalCode = compact[:4] + " " + compact[4:]
+	case a.Country == "JP" && len(compact) == 7:
+		a.PostalCode = compact[:3] + "-" + compact[3:]
+	}
+}
+
+// ValidCountryCode reports whether code is shaped like an ISO 3166-1
+// alpha-2 code.
+func ValidCountryCode(code string) bool {
+	return countryCodePattern.MatchString(code)
+}
+
+// ValidPostalCode reports whether code is a valid postal code for the
+// country, both already normalized.
+func ValidPostalCode(country, code string) bool {
+	if pattern, ok := postalCodePatterns[country]; ok {
+		return pattern.MatchString(code)
+	}
+	return genericPostalCodePattern.MatchString(code)
+}
+
+// String formats the address on one line, e.g.
+// "1 Main St, Springfield 12345, US".
+func (a *PostalAddress) String() string {
+	city := strings.TrimSpace(a.City + " " + a.PostalCode)
+	parts := make([]string, 0, 3)
+	for _, p := range []string{a.Street, city, a.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AuditEntry records one change to a field of an order: who made it, when,
+// and the value before and after. Values are plain JSON values: strings,
+// numbers, lists of strings, or null when the field was unset.
+type AuditEntry struct {
+	Field     string      `json:"field" bson:"field"`
+	OldValue  interface{} `json:"old_value" bson:"old_value"`
+	NewValue  interface{} `json:"new_value" bson:"new_value"`
+	ChangedBy string      `json:"changed_by" bson:"changed_by"`
+	Role      Role        `json:"role" bson:"role"`
+	Timestamp time.Time   `json:"timestamp" bson:"timestamp"`
+	// Reason explains the change where one was given, e.g. a cancellation.
+	Reason string `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// RecordAudit appends entry to the order's audit trail.
+func (o *Order) RecordAudit(entry AuditEntry) {
+	o.Audit = append(o.Audit, entry)
+}
+
+// AuditTrail returns every recorded change to the order, oldest first.
+// Status changes are kept in StatusHistory and appear here as changes to
+// the "status" field.
+func (o *Order) AuditTrail() []AuditEntry {
+	trail := make([]AuditEntry, 0, len(o.StatusHistory)+len(o.Audit))
+	for _, change := range o.StatusHistory {
+		entry := AuditEntry{
+			Field:     "status",
+			NewValue:  change.ToStatus,
+			ChangedBy: change.ChangedBy,
+			Role:      change.Role,
+			Timestamp: change.Timestamp,
+			Reason:    change.Reason,
+		}
+		if change.FromStatus != "" {
+			entry.OldValue = change.FromStatus
+		}
+		switch {
+		case entry.Reason != "":
+		case change.CancellationReason != "":
+			entry.Reason = change.CancellationReason
+		case change.RejectionReason != "":
+			entry.Reason = change.RejectionReason
+		default:
+			entry.Reason = change.Note
+		}
+		trail = append(trail, entry)
+	}
+	trail = append(trail, o.Audit...)
+	sort.SliceStable(trail, func(i, j int) bool {
+		return trail[i].Timestamp.Before(trail[j].Timestamp)
+	})
+	return trail
+}
+
+// ItemSummary describes order lines for the audit trail, one
+// "quantity x name" string per line.
+func ItemSummary(items []OrderItem) []string {
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, fmt.Sprintf("%d x %s", item.Quantity, item.Name))
+	}
+	return lines
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CancellationFeePolicy maps the status an order is in when the customer
+// cancels to the fraction of the order total charged as a fee.
+type CancellationFeePolicy map[OrderStatus]float64
+
+// ParseCancellationFeePolicy parses a policy of the form
+// "CONFIRMED=0.1,PREPARING=0.5". An empty string yields an empty policy.
+func ParseCancellationFeePolicy(s string) (CancellationFeePolicy, error) {
+	policy := CancellationFeePolicy{}
+	if strings.TrimSpace(s) == "" {
+		return policy, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid cancellation fee entry '%s'; expected STATUS=RATE", part)
+		}
+		status := OrderStatus(strings.TrimSpace(kv[0]))
+		if !status.IsValid() {
+			return nil, fmt.Errorf("invalid status '%s' in cancellation fee policy", status)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid rate '%s' for %s; expected a fraction between 0 and 1", kv[1], status)
+		}
+		policy[status] = rate
+	}
+	return policy, nil
+}
+
+// FeeFor returns the fee for cancelling an order of the given total while
+// it is in the given status, rounded to cents.
+func (p CancellationFeePolicy) FeeFor(status OrderStatus, total float64) float64 {
+	return RoundCents(p[status] * total)
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// DiscountType is how a coupon reduces an order's total.
+type DiscountType string
+
+const (
+	DiscountPercent DiscountType = "percent"
+	DiscountFlat    DiscountType = "flat"
+)
+
+// Coupon is a promo code customers can apply when ordering.
+type Coupon struct {
+	Code           string       `json:"code" bson:"_id"`
+	DiscountType   DiscountType `json:"discount_type" bson:"discount_type"`
+	Value          float64      `json:"value" bson:"value"`
+	MinOrderAmount float64      `json:"min_order_amount,omitempty" bson:"min_order_amount,omitempty"`
+	// ExpiresAt is optional; a zero time never expires.
+	ExpiresAt time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	// MaxUses caps redemptions across all customers; zero means unlimited.
+	MaxUses int `json:"max_uses,omitempty" bson:"max_uses"`
+	Uses    int `json:"uses" bson:"uses"`
+}
+
+// CreateCouponRequest is the body for POST /api/admin/coupons.
+type CreateCouponRequest struct {
+	Code           string       `json:"code"`
+	DiscountType   DiscountType `json:"discount_type"`
+	Value          float64      `json:"value"`
+	MinOrderAmount float64      `json:"min_order_amount"`
+	ExpiresAt      time.Time    `json:"expires_at"`
+	MaxUses        int          `json:"max_uses"`
+}
+
+// NormalizeCouponCode trims and uppercases a code so lookups are
+// case-insensitive.
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate checks that the coupon is well formed.
+func (c *Coupon) Validate() error {
+	if c.Code == "" {
+		return fmt.Errorf("code is required")
+	}
+	switch c.DiscountType {
+	case DiscountPercent:
+		if c.Value <= 0 || c.Value > 100 {
+			return fmt.Errorf("percent discount must be between 0 and 100")
+		}
+	case DiscountFlat:
+		if c.Value <= 0 {
+			return fmt.Errorf("flat discount must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("discount_type must be one of: percent, flat")
+	}
+	if c.MinOrderAmount < 0 || c.MaxUses < 0 {
+		return fmt.Errorf("min_order_amount and max_uses cannot be negative")
+	}
+	return nil
+}
+
+// CheckRedeemable reports why the coupon cannot be used on an order with
+// the given subtotal at time now, or nil if it can. Usage limits are
+// enforced atomically by the store, not here.
+func (c *Coupon) CheckRedeemable(subtotal float64, now time.Time) error {
+	if !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt) {
+		return fmt.Errorf("coupon %s has expired", c.Code)
+	}
+	if c.MaxUses > 0 && c.Uses >= c.MaxUses {
+		return fmt.Errorf("coupon %s has reached its usage limit", c.Code)
+	}
+	if subtotal < c.MinOrderAmount {
+		return fmt.Errorf("coupon %s requires a minimum order of %.2f", c.Code, c.MinOrderAmount)
+	}
+	return nil
+}
+
+// AppliedCoupon is the snapshot of a coupon stored on an order, so later
+// changes to the coupon do not affect it.
+type AppliedCoupon struct {
+	Code         string       `json:"code" bson:"code"`
+	DiscountType DiscountType `json:"discount_type" bson:"discount_type"`
+	Value        float64      `json:"value" bson:"value"`
+}
+
+// DiscountFor returns the discount on a subtotal, rounded to cents and
+// never more than the subtotal.
+func (a *AppliedCoupon) DiscountFor(subtotal float64) float64 {
+	if a == nil {
+		return 0
+	}
+	discount := a.Value
+	if a.DiscountType == DiscountPercent {
+		discount = subtotal * a.Value / 100
+	}
+	discount = math.Min(RoundCents(discount), subtotal)
+	return discount
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// ValidCoordinates reports whether lat and lng are within the valid ranges.
+func ValidCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// earthRadiusKM is the Earth's mean radius.
+const earthRadiusKM = 6371.0
+
+// DistanceKM returns the great-circle distance in kilometres between two
+// points, using the haversine formula.
+func DistanceKM(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	// Rounding can push h just past 1 for antipodal points.
+	return 2 * earthRadiusKM * math.Asin(math.Sqrt(math.Min(h, 1)))
+}
+
+// GeoPoint is a GeoJSON point, the form MongoDB's 2dsphere index expects.
+// Coordinates are [lng, lat].
+type GeoPoint struct {
+	Type        string    `bson:"type"`
+	Coordinates []float64 `bson:"coordinates"`
+}
+
+// NewGeoPoint returns the GeoJSON point for lat and lng.
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+// DriverLocation is a position reported by the driver delivering an order.
+type DriverLocation struct {
+	Lat        float64   `json:"lat" bson:"lat"`
+	Lng        float64   `json:"lng" bson:"lng"`
+	RecordedAt time.Time `json:"recorded_at" bson:"recorded_at"`
+}
+
+// LocationPing is one point in an order's breadcrumb trail.
+type LocationPing struct {
+	OrderID        string `json:"order_id" bson:"order_id"`
+	DriverID       string `json:"driver_id" bson:"driver_id"`
+	DriverLocation `bson:",inline"`
+}
+
+// UpdateLocationRequest is the payload for a driver's location update.
+type UpdateLocationRequest struct {
+	Lat *float64 `json:"lat"`
+	Lng *float64 `json:"lng"`
+}
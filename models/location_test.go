@@ -0,0 +1,60 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceKM(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want, tolerance        float64
+	}{
+		{"same point", 51.5074, -0.1278, 51.5074, -0.1278, 0, 1e-9},
+		{"one degree along the equator", 0, 0, 0, 1, 111.19, 0.01},
+		{"one degree along a meridian", 10, 20, 11, 20, 111.19, 0.01},
+		{"London to Paris", 51.5074, -0.1278, 48.8566, 2.3522, 343.5, 0.5},
+		{"New York to Los Angeles", 40.7128, -74.0060, 34.0522, -118.2437, 3935.7, 1},
+		{"across the date line", 0, 179.5, 0, -179.5, 111.19, 0.01},
+		{"antipodal points", 40, -30, -40, 150, math.Pi * earthRadiusKM, 1e-6},
+		{"pole to pole", 90, 0, -90, 0, math.Pi * earthRadiusKM, 1e-6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DistanceKM(tt.lat1, tt.lng1, tt.lat2, tt.lng2)
+			if math.IsNaN(got) || math.Abs(got-tt.want) > tt.tolerance {
+				t.Errorf("DistanceKM = %v, want %v ± %v", got, tt.want, tt.tolerance)
+			}
+			if back := DistanceKM(tt.lat2, tt.lng2, tt.lat1, tt.lng1); math.Abs(back-got) > 1e-9 {
+				t.Errorf("DistanceKM is not symmetric: %v one way, %v the other", got, back)
+			}
+		})
+	}
+}
+
+func TestDeliveryFeeFor(t *testing.T) {
+	km := func(d float64) *float64 { return &d }
+	tests := []struct {
+		name     string
+		pricing  Pricing
+		distance *float64
+		want     float64
+	}{
+		{"unknown distance uses the flat fee", Pricing{DeliveryFee: 2.99, DeliveryBaseFee: 1, DeliveryPerKM: 0.5}, nil, 2.99},
+		{"distance pricing off uses the flat fee", Pricing{DeliveryFee: 2.99}, km(10), 2.99},
+		{"base plus per kilometre", Pricing{DeliveryFee: 2.99, DeliveryBaseFee: 1.5, DeliveryPerKM: 0.4}, km(5), 3.5},
+		{"zero distance is the base fee", Pricing{DeliveryBaseFee: 1.5, DeliveryPerKM: 0.4}, km(0), 1.5},
+		{"rounded to cents", Pricing{DeliveryBaseFee: 1, DeliveryPerKM: 0.333}, km(1), 1.33},
+		{"capped", Pricing{DeliveryBaseFee: 1.5, DeliveryPerKM: 0.4, DeliveryFeeCap: 6}, km(20), 6},
+		{"under the cap", Pricing{DeliveryBaseFee: 1.5, DeliveryPerKM: 0.4, DeliveryFeeCap: 6}, km(5), 3.5},
+		{"zero cap means no cap", Pricing{DeliveryBaseFee: 1.5, DeliveryPerKM: 0.4}, km(100), 41.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pricing.DeliveryFeeFor(tt.distance); got != tt.want {
+				t.Errorf("DeliveryFeeFor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,88 @@
 package models
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeOfDayLayout is the format used for menu item schedule windows.
+const TimeOfDayLayout = "15:04"
+
+// MenuSchedule limits when a menu item can be ordered. Times of day are
+// HH:MM in the restaurant's time zone; a window whose start is after its
+// end wraps past midnight. Dates are YYYY-MM-DD and inclusive. Any empty
+// field leaves that side of the window open.
+type MenuSchedule struct {
+	AvailableFrom     string `json:"available_from,omitempty" bson:"available_from,omitempty"`
+	AvailableUntil    string `json:"available_until,omitempty" bson:"available_until,omitempty"`
+	AvailableFromDate string `json:"available_from_date,omitempty" bson:"available_from_date,omitempty"`
+	AvailableToDate   string `json:"available_to_date,omitempty" bson:"available_to_date,omitempty"`
+}
+
+// Validate checks that every schedule field is well-formed.
+func (s MenuSchedule) Validate() error {
+	for _, v := range []string{s.AvailableFrom, s.AvailableUntil} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse(TimeOfDayLayout, v); err != nil {
+			return fmt.Errorf("invalid time of day '%s'; expected HH:MM", v)
+		}
+	}
+	for _, v := range []string{s.AvailableFromDate, s.AvailableToDate} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse(DateLayout, v); err != nil {
+			return fmt.Errorf("invalid date '%s'; expected YYYY-MM-DD", v)
+		}
+	}
+	if s.AvailableFromDate != "" && s.AvailableToDate != "" && s.AvailableFromDate > s.AvailableToDate {
+		return fmt.Errorf("available_from_date must not be after available_to_date")
+	}
+	return nil
+}
+
+// Contains reports whether t, converted to loc, falls inside the schedule.
+func (s MenuSchedule) Contains(t time.Time, loc *time.Location) bool {
+	local := t.In(loc)
+	date := local.Format(DateLayout)
+	if s.AvailableFromDate != "" && date < s.AvailableFromDate {
+		return false
+	}
+	if s.AvailableToDate != "" && date > s.AvailableToDate {
+		return false
+	}
+
+	now := local.Format(TimeOfDayLayout)
+	from, until := s.AvailableFrom, s.AvailableUntil
+	switch {
+	case from == "" && until == "":
+		return true
+	case from == "":
+		return now < until
+	case until == "":
+		return now >= from
+	case from <= until:
+		return now >= from && now < until
+	default:
+		// Window wraps past midnight, e.g. 22:00–02:00.
+		return now >= from || now < until
+	}
+}
+
+// MenuItemType distinguishes single dishes from bundles.
+type MenuItemType string
+
+const (
+	// MenuItemTypeSingle is a regular dish. It is the zero value so existing
+	// items without a type remain single dishes.
+	MenuItemTypeSingle MenuItemType = ""
+	// MenuItemTypeBundle is a combo of other menu items sold at one price.
+	MenuItemTypeBundle MenuItemType = "bundle"
+)
+
 // MenuItem represents a dish on a restaurant's menu.
 type MenuItem struct {
 	ID           string  `json:"id" bson:"_id,omitempty"`
@@ -10,6 +93,28 @@ type MenuItem struct {
 	Category     string  `json:"category" bson:"category"`
 	Available    bool    `json:"available" bson:"available"`
 	ImageURL     string  `json:"image_url,omitempty" bson:"image_url,omitempty"`
+	MenuSchedule `bson:",inline"`
+	// NameKey is the normalised name, unique per restaurant. Items saved
+	// before names were unique have none.
+	NameKey string `json:"-" bson:"name_key,omitempty"`
+	// Type is "bundle" for combos; ComponentIDs then lists the menu items
+	// included in the bundle, repeated for multiples.
+	Type         MenuItemType `json:"type,omitempty" bson:"type,omitempty"`
+	ComponentIDs []string     `json:"component_ids,omitempty" bson:"component_ids,omitempty"`
+	// Version starts at 1 and goes up each time the item is edited. Items
+	// created before versioning have version 0.
+	Version int `json:"version" bson:"version"`
+}
+
+// IsBundle reports whether the item is a combo of other menu items.
+func (m *MenuItem) IsBundle() bool {
+	return m.Type == MenuItemTypeBundle
+}
+
+// IsAvailableAt reports whether the item can be ordered at time t, taking
+// both the availability flag and the schedule into account.
+func (m *MenuItem) IsAvailableAt(t time.Time, loc *time.Location) bool {
+	return m.Available && m.MenuSchedule.Contains(t, loc)
 }
 
 // CreateMenuItemRequest is the payload for adding a menu item.
@@ -19,12 +124,74 @@ type CreateMenuItemRequest struct {
 	Price       float64 `json:"price"`
 	Category    string  `json:"category"`
 	ImageURL    string  `json:"image_url,omitempty"`
+	MenuSchedule
+	// ComponentIDs, when set, makes the item a bundle of these menu items.
+	ComponentIDs []string `json:"component_ids,omitempty"`
+}
+
+// DefaultMenuCategory is used for menu items added without a category.
+const DefaultMenuCategory = "General"
+
+// MaxCategoryNameLength caps a menu category name, in characters.
+const MaxCategoryNameLength = 40
+
+// MenuCategory is a section of a restaurant's menu. Key is the normalised
+// name and is unique per restaurant, so "Drinks" and "drinks" are the same
+// category; Name keeps the spelling it was first created with.
+type MenuCategory struct {
+	ID           string    `json:"id" bson:"_id,omitempty"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	Name         string    `json:"name" bson:"name"`
+	Key          string    `json:"-" bson:"key"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+// CleanCategoryName collapses runs of whitespace in a category name.
+func CleanCategoryName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// CategoryKey returns the normalised form used to compare category names.
+func CategoryKey(name string) string {
+	return strings.ToLower(CleanCategoryName(name))
+}
+
+// MenuItemKey returns the normalised form used to compare dish names.
+func MenuItemKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// CreateMenuCategoryRequest is the payload for adding a menu category.
+type CreateMenuCategoryRequest struct {
+	Name string `json:"name"`
+}
+
+// MenuCategoryCount is the number of menu items in one category.
+type MenuCategoryCount struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// BulkMenuItemResult reports the outcome for one item of a bulk upload.
+// Index is the item's position in the request.
+type BulkMenuItemResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// BulkMenuItemResponse summarises a bulk menu upload.
+type BulkMenuItemResponse struct {
+	Created int                  `json:"created"`
+	Failed  int                  `json:"failed"`
+	Results []BulkMenuItemResult `json:"results"`
 }
 
 // OrderItemRequest is used by customers to order from a menu.
 type OrderItemRequest struct {
-	MenuItemID string `json:"menu_item_id"`
-	Quantity   int    `json:"quantity"`
+	MenuItemID          string `json:"menu_item_id"`
+	Quantity            int    `json:"quantity"`
+	SpecialInstructions string `json:"special_instructions,omitempty"`
 }
 
 // CreateOrderFromMenuRequest is the payload for placing an order from a restaurant's menu.
@@ -32,5 +199,49 @@ type CreateOrderFromMenuRequest struct {
 	RestaurantID    string             `json:"restaurant_id"`
 	Items           []OrderItemRequest `json:"items"`
 	DeliveryAddress string             `json:"delivery_address"`
-	PaymentMethod   string             `json:"payment_method"`
+	// PostalAddress is the delivery address split into parts. When it is
+	// given without DeliveryAddress, the free-text address is formed from
+	// it.
+	PostalAddress *PostalAddress `json:"postal_address,omitempty"`
+	// AddressID references one of the customer's saved addresses and may
+	// be used instead of DeliveryAddress and PostalAddress.
+	AddressID     string `json:"address_id,omitempty"`
+	PaymentMethod string `json:"payment_method"`
+	// DeliveryLat and DeliveryLng locate the delivery address and are used
+	// to price delivery by distance. They default to the saved address's
+	// coordinates.
+	DeliveryLat *float64 `json:"delivery_lat,omitempty"`
+	DeliveryLng *float64 `json:"delivery_lng,omitempty"`
+	// ExpectedTotal is the total the client showed the customer. If set and
+	// it differs from the server's total, the order is rejected so the
+	// customer can reconfirm at current prices.
+	ExpectedTotal *float64 `json:"expected_total,omitempty"`
+	// Tip for the driver, charged on top of the order total.
+	Tip float64 `json:"tip,omitempty"`
+	// CouponCode applies a promo code to the order.
+	CouponCode string `json:"coupon_code,omitempty"`
+	// Notes are delivery or preparation instructions, e.g. "ring the bell".
+	Notes string `json:"notes,omitempty"`
+	// ScheduledFor places the order at a future time instead of now.
+	ScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+}
+
+// UpdateAvailabilityRequest is the payload for toggling a menu item's or a
+// driver's availability.
+type UpdateAvailabilityRequest struct {
+	Available *bool `json:"available"`
+}
+
+// BulkAvailabilityRequest switches several of a restaurant's menu items on
+// or off at once.
+type BulkAvailabilityRequest struct {
+	ItemIDs   []string `json:"item_ids"`
+	Available *bool    `json:"available"`
+}
+
+// BulkAvailabilityResponse reports how many items a bulk availability change
+// modified. Items already in the requested state are not counted.
+type BulkAvailabilityResponse struct {
+	Available bool  `json:"available"`
+	Modified  int64 `json:"modified"`
 }
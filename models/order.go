@@ -1,11 +1,19 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
 
 // OrderStatus represents the current state of an order.
 type OrderStatus string
 
 const (
+	// StatusScheduled is a future-dated order waiting to be placed.
+	StatusScheduled      OrderStatus = "SCHEDULED"
 	StatusPlaced         OrderStatus = "PLACED"
 	StatusConfirmed      OrderStatus = "CONFIRMED"
 	StatusPreparing      OrderStatus = "PREPARING"
@@ -14,16 +22,62 @@ const (
 	StatusOutForDelivery OrderStatus = "OUT_FOR_DELIVERY"
 	StatusDelivered      OrderStatus = "DELIVERED"
 	StatusCancelled      OrderStatus = "CANCELLED"
+	// StatusRejected is a new order the restaurant declined to fulfil.
+	// Unlike CANCELLED, it is only ever the restaurant's decision.
+	StatusRejected OrderStatus = "REJECTED"
 )
 
-// OrderItem represents a single item in an order.
-type OrderItem struct {
+// IsValid checks whether a status string is one of the known order statuses.
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case StatusScheduled, StatusPlaced, StatusConfirmed, StatusPreparing, StatusReadyForPickup,
+		StatusPickedUp, StatusOutForDelivery, StatusDelivered, StatusCancelled, StatusRejected:
+		return true
+	}
+	return false
+}
+
+// PrepStatus tracks kitchen preparation of a single order line.
+type PrepStatus string
+
+const (
+	PrepPending PrepStatus = "pending"
+	PrepReady   PrepStatus = "ready"
+)
+
+// IsValid checks whether a prep status is one of the allowed values.
+func (p PrepStatus) IsValid() bool {
+	return p == PrepPending || p == PrepReady
+}
+
+// BundleComponent is a snapshot of one menu item included in a bundle line.
+type BundleComponent struct {
 	MenuItemID string  `json:"menu_item_id" bson:"menu_item_id"`
 	Name       string  `json:"name" bson:"name"`
-	Quantity   int     `json:"quantity" bson:"quantity"`
 	Price      float64 `json:"price" bson:"price"`
 }
 
+// OrderItem represents a single item in an order. The menu item's details
+// are copied when the line is priced, so later menu changes do not alter
+// what was ordered.
+type OrderItem struct {
+	MenuItemID string     `json:"menu_item_id" bson:"menu_item_id"`
+	Name       string     `json:"name" bson:"name"`
+	Quantity   int        `json:"quantity" bson:"quantity"`
+	Price      float64    `json:"price" bson:"price"`
+	PrepStatus PrepStatus `json:"prep_status,omitempty" bson:"prep_status,omitempty"`
+	// Description, Category and MenuItemVersion record the menu item as it
+	// was when ordered.
+	Description     string `json:"description,omitempty" bson:"description,omitempty"`
+	Category        string `json:"category,omitempty" bson:"category,omitempty"`
+	MenuItemVersion int    `json:"menu_item_version,omitempty" bson:"menu_item_version,omitempty"`
+	// SpecialInstructions is the customer's request for this line, e.g. "no onions".
+	SpecialInstructions string `json:"special_instructions,omitempty" bson:"special_instructions,omitempty"`
+	// Components is set for bundle lines; the line is charged at Price, not
+	// the sum of its components.
+	Components []BundleComponent `json:"components,omitempty" bson:"components,omitempty"`
+}
+
 // StatusChange records a single state transition in the order's history.
 type StatusChange struct {
 	FromStatus OrderStatus `json:"from_status" bson:"from_status"`
@@ -31,26 +85,496 @@ type StatusChange struct {
 	ChangedBy  string      `json:"changed_by" bson:"changed_by"`
 	Role       Role        `json:"role" bson:"role"`
 	Timestamp  time.Time   `json:"timestamp" bson:"timestamp"`
+	// TransitionID is the client-supplied idempotency key, if any.
+	TransitionID string `json:"transition_id,omitempty" bson:"transition_id,omitempty"`
+	// CancellationReason is set on transitions to CANCELLED.
+	CancellationReason string `json:"cancellation_reason,omitempty" bson:"cancellation_reason,omitempty"`
+	// RejectionReason is set on transitions to REJECTED.
+	RejectionReason string `json:"rejection_reason,omitempty" bson:"rejection_reason,omitempty"`
+	// Note is optional context from whoever made the change, e.g. "heavy
+	// traffic" when a driver heads out.
+	Note string `json:"note,omitempty" bson:"note,omitempty"`
+	// Reverted marks a change that undid the previous one.
+	Reverted bool `json:"reverted,omitempty" bson:"reverted,omitempty"`
+	// Override marks a change forced by an admin outside the state machine;
+	// Reason records why.
+	Override bool   `json:"override,omitempty" bson:"override,omitempty"`
+	Reason   string `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// OrderDelay is a delay reported by the restaurant or the driver, which
+// pushed the promised delivery time back by Minutes.
+type OrderDelay struct {
+	Minutes    int    `json:"minutes" bson:"minutes"`
+	Reason     string `json:"reason" bson:"reason"`
+	ReportedBy string `json:"reported_by" bson:"reported_by"`
+	Role       Role   `json:"role" bson:"role"`
+	// EstimatedDeliveryAt is the promised delivery time after the delay.
+	EstimatedDeliveryAt time.Time `json:"estimated_delivery_at" bson:"estimated_delivery_at"`
+	ReportedAt          time.Time `json:"reported_at" bson:"reported_at"`
+}
+
+// ReportDelayRequest is the payload for reporting a delay on an order.
+type ReportDelayRequest struct {
+	Minutes int    `json:"minutes"`
+	Reason  string `json:"reason"`
+}
+
+// Limits on reported delays.
+const (
+	MaxDelayMinutes      = 120
+	MaxDelayReasonLength = 280
+)
+
+// Order stream message types.
+const (
+	StreamSnapshot     = "snapshot"
+	StreamStatusChange = "status_change"
+	StreamDelay        = "delay"
+)
+
+// OrderStreamMessage is sent to clients streaming an order's status. The
+// first message is a snapshot of the current status and delivery estimate;
+// each later one carries a single status change or delay.
+type OrderStreamMessage struct {
+	Type    string        `json:"type"`
+	OrderID string        `json:"order_id"`
+	Status  OrderStatus   `json:"status"`
+	Change  *StatusChange `json:"change,omitempty"`
+	Delay   *OrderDelay   `json:"delay,omitempty"`
+	// EstimatedDeliveryAt is set on snapshots and delays.
+	EstimatedDeliveryAt *time.Time `json:"estimated_delivery_at,omitempty"`
+}
+
+// ItemConfirmation records which line items a restaurant confirmed as
+// available when accepting an order. Items are referenced by menu_item_id.
+type ItemConfirmation struct {
+	AvailableItems   []string   `json:"available_items" bson:"available_items"`
+	UnavailableItems []string   `json:"unavailable_items" bson:"unavailable_items"`
+	ConfirmedBy      string     `json:"confirmed_by,omitempty" bson:"confirmed_by,omitempty"`
+	ConfirmedAt      *time.Time `json:"confirmed_at,omitempty" bson:"confirmed_at,omitempty"`
+}
+
+// OrderRating is a customer's review of a delivered order.
+type OrderRating struct {
+	Stars     int       `json:"stars" bson:"stars"`
+	Comment   string    `json:"comment,omitempty" bson:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// ItemChange records a customer's modification of an order's items.
+type ItemChange struct {
+	Added         []OrderItemRequest `json:"added,omitempty" bson:"added,omitempty"`
+	Removed       []string           `json:"removed,omitempty" bson:"removed,omitempty"`
+	PreviousTotal float64            `json:"previous_total" bson:"previous_total"`
+	NewTotal      float64            `json:"new_total" bson:"new_total"`
+	ChangedBy     string             `json:"changed_by" bson:"changed_by"`
+	Timestamp     time.Time          `json:"timestamp" bson:"timestamp"`
 }
 
 // Order represents a food delivery order.
 type Order struct {
-	ID              string         `json:"id" bson:"_id,omitempty"`
-	CustomerID      string         `json:"customer_id" bson:"customer_id"`
-	RestaurantID    string         `json:"restaurant_id" bson:"restaurant_id"`
-	DriverID        string         `json:"driver_id,omitempty" bson:"driver_id,omitempty"`
-	Items           []OrderItem    `json:"items" bson:"items"`
-	TotalAmount     float64        `json:"total_amount" bson:"total_amount"`
-	Status          OrderStatus    `json:"status" bson:"status"`
-	StatusHistory   []StatusChange `json:"status_history" bson:"status_history"`
-	DeliveryAddress string         `json:"delivery_address" bson:"delivery_address"`
-	PaymentMethod   string         `json:"payment_method" bson:"payment_method"`
-	CreatedAt       time.Time      `json:"created_at" bson:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at" bson:"updated_at"`
+	ID                  string            `json:"id" bson:"_id,omitempty"`
+	OrderNumber         string            `json:"order_number,omitempty" bson:"order_number,omitempty"`
+	CustomerID          string            `json:"customer_id" bson:"customer_id"`
+	RestaurantID        string            `json:"restaurant_id" bson:"restaurant_id"`
+	DriverID            string            `json:"driver_id,omitempty" bson:"driver_id,omitempty"`
+	Items               []OrderItem       `json:"items" bson:"items"`
+	TotalAmount         float64           `json:"total_amount" bson:"total_amount"`
+	Tip                 float64           `json:"tip" bson:"tip,omitempty"`
+	Coupon              *AppliedCoupon    `json:"coupon,omitempty" bson:"coupon,omitempty"`
+	Discount            float64           `json:"discount,omitempty" bson:"discount,omitempty"`
+	PriceBreakdown      *PriceBreakdown   `json:"price_breakdown,omitempty" bson:"price_breakdown,omitempty"`
+	Status              OrderStatus       `json:"status" bson:"status"`
+	StatusHistory       []StatusChange    `json:"status_history" bson:"status_history"`
+	DeliveryAddress     string            `json:"delivery_address" bson:"delivery_address"`
+	PostalAddress       *PostalAddress    `json:"postal_address,omitempty" bson:"postal_address,omitempty"`
+	DeliveryLat         *float64          `json:"delivery_lat,omitempty" bson:"delivery_lat,omitempty"`
+	DeliveryLng         *float64          `json:"delivery_lng,omitempty" bson:"delivery_lng,omitempty"`
+	PaymentMethod       PaymentMethod     `json:"payment_method" bson:"payment_method"`
+	PaymentStatus       PaymentStatus     `json:"payment_status,omitempty" bson:"payment_status,omitempty"`
+	PaymentIntentID     string            `json:"payment_intent_id,omitempty" bson:"payment_intent_id,omitempty"`
+	PaymentChargeID     string            `json:"payment_charge_id,omitempty" bson:"payment_charge_id,omitempty"`
+	PaymentRefundID     string            `json:"payment_refund_id,omitempty" bson:"payment_refund_id,omitempty"`
+	Refund              *Refund           `json:"refund,omitempty" bson:"refund,omitempty"`
+	Notes               string            `json:"notes,omitempty" bson:"notes,omitempty"`
+	ItemConfirmation    *ItemConfirmation `json:"item_confirmation,omitempty" bson:"item_confirmation,omitempty"`
+	ItemsReady          bool              `json:"items_ready,omitempty" bson:"items_ready,omitempty"`
+	CancellationFee     float64           `json:"cancellation_fee,omitempty" bson:"cancellation_fee,omitempty"`
+	CancellationReason  string            `json:"cancellation_reason,omitempty" bson:"cancellation_reason,omitempty"`
+	RejectionReason     string            `json:"rejection_reason,omitempty" bson:"rejection_reason,omitempty"`
+	PrepMinutes         int               `json:"prep_minutes,omitempty" bson:"prep_minutes,omitempty"`
+	EstimatedDeliveryAt time.Time         `json:"estimated_delivery_at" bson:"estimated_delivery_at"`
+	Delays              []OrderDelay      `json:"delays,omitempty" bson:"delays,omitempty"`
+	ScheduledFor        *time.Time        `json:"scheduled_for,omitempty" bson:"scheduled_for,omitempty"`
+	DriverLocation      *DriverLocation   `json:"driver_location,omitempty" bson:"driver_location,omitempty"`
+	Rating              *OrderRating      `json:"rating,omitempty" bson:"rating,omitempty"`
+	ItemChanges         []ItemChange      `json:"item_changes,omitempty" bson:"item_changes,omitempty"`
+	Audit               []AuditEntry      `json:"-" bson:"audit,omitempty"`
+	CreatedAt           time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at" bson:"updated_at"`
+}
+
+// ApplyPricing fixes the platform charges for the order. It is called once,
+// when the order is placed, after the delivery coordinates are set. The
+// delivery fee depends on the distance from the restaurant when both
+// locations are known.
+func (o *Order) ApplyPricing(p Pricing, restaurant *User) {
+	distance := o.deliveryDistanceKM(restaurant)
+	o.PriceBreakdown = &PriceBreakdown{TaxRate: p.TaxRate, DeliveryFee: p.DeliveryFeeFor(distance)}
+	if distance != nil {
+		km := math.Round(*distance*100) / 100
+		o.PriceBreakdown.DeliveryDistanceKM = &km
+	}
+}
+
+// deliveryDistanceKM returns the straight-line distance from the restaurant
+// to the delivery coordinates, or nil if either location is unknown.
+func (o *Order) deliveryDistanceKM(restaurant *User) *float64 {
+	if o.DeliveryLat == nil || o.DeliveryLng == nil || restaurant.Lat == nil || restaurant.Lng == nil {
+		return nil
+	}
+	km := DistanceKM(*restaurant.Lat, *restaurant.Lng, *o.DeliveryLat, *o.DeliveryLng)
+	return &km
+}
+
+// MaxScheduleAhead is how far in advance an order may be scheduled.
+const MaxScheduleAhead = 7 * 24 * time.Hour
+
+// Limits on customer-written instructions, in characters.
+const (
+	MaxOrderNotesLength       = 500
+	MaxItemInstructionsLength = 200
+)
+
+// MaxStatusNoteLength limits the note on a status change, in characters.
+const MaxStatusNoteLength = 280
+
+// CleanNote trims customer-written text and drops control characters other
+// than newlines and tabs. The text is stored as plain text; clients must
+// escape it when rendering.
+func CleanNote(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+		return -1
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// SetSubtotal sets the order's total from the sum of its lines, less any
+// coupon discount, and refreshes the price breakdown.
+func (o *Order) SetSubtotal(subtotal float64) {
+	subtotal = RoundCents(subtotal)
+	o.Discount = o.Coupon.DiscountFor(subtotal)
+	o.TotalAmount = RoundCents(subtotal - o.Discount)
+	if o.PriceBreakdown != nil {
+		o.PriceBreakdown.Subtotal = subtotal
+	}
+	o.refreshBreakdown()
+}
+
+// SetTip sets the driver tip and refreshes the price breakdown.
+func (o *Order) SetTip(tip float64) {
+	o.Tip = RoundCents(tip)
+	o.refreshBreakdown()
+}
+
+// SetCancellationFee records the fee owed for a late cancellation, also
+// showing it in the price breakdown.
+func (o *Order) SetCancellationFee(fee float64) {
+	o.CancellationFee = RoundCents(fee)
+	if o.PriceBreakdown != nil {
+		o.PriceBreakdown.CancellationFee = o.CancellationFee
+	}
+}
+
+// refreshBreakdown recomputes the derived amounts of the price breakdown.
+// Tax is charged on the discounted item total.
+func (o *Order) refreshBreakdown() {
+	b := o.PriceBreakdown
+	if b == nil {
+		return
+	}
+	b.Discount = o.Discount
+	b.Tip = o.Tip
+	b.Tax = RoundCents(o.TotalAmount * b.TaxRate)
+	b.GrandTotal = RoundCents(o.TotalAmount + b.Tax + b.DeliveryFee + b.Tip)
+}
+
+// GrandTotal is what the customer pays in total: the order total plus tax,
+// delivery fee and tip. Orders placed before price breakdowns were recorded
+// have no tax or delivery fee.
+func (o *Order) GrandTotal() float64 {
+	if o.PriceBreakdown != nil {
+		return o.PriceBreakdown.GrandTotal
+	}
+	return RoundCents(o.TotalAmount + o.Tip)
+}
+
+// orderFields has Order's fields without its methods, so it can be
+// marshalled without recursing into Order.MarshalJSON.
+type orderFields Order
+
+// orderView is the JSON form of an order, including computed fields.
+type orderView struct {
+	*orderFields
+	GrandTotal float64 `json:"grand_total"`
+}
+
+func (o *Order) view() orderView {
+	return orderView{orderFields: (*orderFields)(o), GrandTotal: o.GrandTotal()}
+}
+
+// MarshalJSON adds the computed grand_total to the order's fields.
+func (o *Order) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.view())
+}
+
+// AllItemsReady reports whether every line item has been marked ready by the kitchen.
+func (o *Order) AllItemsReady() bool {
+	if len(o.Items) == 0 {
+		return false
+	}
+	for _, item := range o.Items {
+		if item.PrepStatus != PrepReady {
+			return false
+		}
+	}
+	return true
+}
+
+// DriverQueueEntry is an order in a driver's work feed, enriched with
+// pickup details from the restaurant.
+type DriverQueueEntry struct {
+	*Order
+	RestaurantName string    `json:"restaurant_name"`
+	PickupAddress  string    `json:"pickup_address,omitempty"`
+	ReadyAt        time.Time `json:"ready_at,omitempty"`
+	Claimed        bool      `json:"claimed"`
+}
+
+// MarshalJSON flattens the entry's order, including computed fields, with
+// its pickup details. It is needed because the embedded order's own
+// MarshalJSON would otherwise be promoted and drop the pickup fields.
+func (e DriverQueueEntry) MarshalJSON() ([]byte, error) {
+	if e.Order == nil {
+		e.Order = &Order{}
+	}
+	return json.Marshal(struct {
+		orderView
+		RestaurantName string    `json:"restaurant_name"`
+		PickupAddress  string    `json:"pickup_address,omitempty"`
+		ReadyAt        time.Time `json:"ready_at,omitempty"`
+		Claimed        bool      `json:"claimed"`
+	}{e.Order.view(), e.RestaurantName, e.PickupAddress, e.ReadyAt, e.Claimed})
+}
+
+// KitchenQueueEntry is an order in a restaurant's preparation queue.
+type KitchenQueueEntry struct {
+	*Order
+	// Position is the order's place in the queue, starting at 1.
+	Position int `json:"position"`
+	// QueuedAt is when the order joined the queue: its scheduled time for
+	// scheduled orders, otherwise when it was created.
+	QueuedAt   time.Time `json:"queued_at"`
+	AgeMinutes int       `json:"age_minutes"`
+}
+
+// MarshalJSON flattens the entry's order, including computed fields, with
+// its queue details, as DriverQueueEntry does.
+func (e KitchenQueueEntry) MarshalJSON() ([]byte, error) {
+	if e.Order == nil {
+		e.Order = &Order{}
+	}
+	return json.Marshal(struct {
+		orderView
+		Position   int       `json:"position"`
+		QueuedAt   time.Time `json:"queued_at"`
+		AgeMinutes int       `json:"age_minutes"`
+	}{e.Order.view(), e.Position, e.QueuedAt, e.AgeMinutes})
+}
+
+// QueueTime returns when the order started waiting for the kitchen: its
+// scheduled time if it was scheduled, otherwise its creation time.
+func (o *Order) QueueTime() time.Time {
+	if o.ScheduledFor != nil {
+		return *o.ScheduledFor
+	}
+	return o.CreatedAt
+}
+
+// SetTipRequest is the payload for adjusting the tip on a delivered order.
+type SetTipRequest struct {
+	Tip *float64 `json:"tip"`
 }
 
 // UpdateStatusRequest is the payload for updating order status.
 type UpdateStatusRequest struct {
 	Status   OrderStatus `json:"status"`
 	DriverID string      `json:"driver_id,omitempty"`
+	// TransitionID makes the request safely retryable: if a history entry
+	// already carries this ID, the update is not applied again.
+	TransitionID string `json:"transition_id,omitempty"`
+	// CancellationReason explains a cancellation. Required for restaurants.
+	CancellationReason string `json:"cancellation_reason,omitempty"`
+	// RejectionReason explains why the restaurant cannot fulfil the order.
+	// Required to reject.
+	RejectionReason string `json:"rejection_reason,omitempty"`
+	// ItemConfirmation is required on the CONFIRMED transition when the
+	// restaurant has enabled per-item confirmation.
+	ItemConfirmation *ItemConfirmation `json:"item_confirmation,omitempty"`
+	// PrepMinutes is the restaurant's preparation estimate, accepted only on
+	// the CONFIRMED transition. It defaults to the restaurant's setting.
+	PrepMinutes *int `json:"prep_minutes,omitempty"`
+	// Note is stored on the status change. Any role may send one.
+	Note string `json:"note,omitempty"`
+}
+
+// MaxPrepMinutes bounds preparation estimates.
+const MaxPrepMinutes = 240
+
+// OrderSnapshot is the as-ordered view of an order's lines.
+type OrderSnapshot struct {
+	OrderID      string      `json:"order_id" bson:"_id"`
+	OrderNumber  string      `json:"order_number,omitempty" bson:"order_number,omitempty"`
+	CustomerID   string      `json:"customer_id" bson:"customer_id"`
+	RestaurantID string      `json:"restaurant_id" bson:"restaurant_id"`
+	DriverID     string      `json:"driver_id,omitempty" bson:"driver_id,omitempty"`
+	Items        []OrderItem `json:"items" bson:"items"`
+	CreatedAt    time.Time   `json:"created_at" bson:"created_at"`
+}
+
+// MaxBatchOrderIDs caps how many orders one batch status query may ask for.
+const MaxBatchOrderIDs = 100
+
+// BatchOrdersRequest asks for the current status of several orders.
+type BatchOrdersRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// OrderBrief is the minimal view of an order returned by batch queries.
+type OrderBrief struct {
+	ID                  string      `json:"id"`
+	OrderNumber         string      `json:"order_number,omitempty"`
+	Status              OrderStatus `json:"status"`
+	CustomerID          string      `json:"customer_id"`
+	RestaurantID        string      `json:"restaurant_id"`
+	DriverID            string      `json:"driver_id,omitempty"`
+	EstimatedDeliveryAt time.Time   `json:"estimated_delivery_at"`
+	UpdatedAt           time.Time   `json:"updated_at"`
+}
+
+// Brief returns the order's minimal view.
+func (o *Order) Brief() OrderBrief {
+	return OrderBrief{
+		ID:                  o.ID,
+		OrderNumber:         o.OrderNumber,
+		Status:              o.Status,
+		CustomerID:          o.CustomerID,
+		RestaurantID:        o.RestaurantID,
+		DriverID:            o.DriverID,
+		EstimatedDeliveryAt: o.EstimatedDeliveryAt,
+		UpdatedAt:           o.UpdatedAt,
+	}
+}
+
+// BatchOrdersResponse holds the orders found, in request order, and the
+// requested IDs that do not exist or that the caller may not see.
+type BatchOrdersResponse struct {
+	Orders      []OrderBrief `json:"orders"`
+	Unavailable []string     `json:"unavailable"`
+}
+
+// SkippedItem is a line from a previous order that could not be ordered
+// again, with the reason.
+type SkippedItem struct {
+	MenuItemID string `json:"menu_item_id"`
+	Name       string `json:"name"`
+	Reason     string `json:"reason"`
+}
+
+// ItemStatus says whether a requested order line can be ordered.
+type ItemStatus string
+
+const (
+	ItemOK              ItemStatus = "ok"
+	ItemInvalidQuantity ItemStatus = "invalid_quantity"
+	ItemNotFound        ItemStatus = "not_found"
+	ItemWrongRestaurant ItemStatus = "wrong_restaurant"
+	ItemUnavailable     ItemStatus = "unavailable"
+)
+
+// ItemCheck is the outcome of checking one requested line, reported for
+// every line when any of them cannot be ordered.
+type ItemCheck struct {
+	Index      int        `json:"index"`
+	MenuItemID string     `json:"menu_item_id"`
+	Name       string     `json:"name,omitempty"`
+	Status     ItemStatus `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+}
+
+// ReorderResponse is the new order placed from a previous one, with any
+// lines that had to be left out.
+type ReorderResponse struct {
+	Order        *Order        `json:"order"`
+	SkippedItems []SkippedItem `json:"skipped_items"`
+}
+
+// OverrideStatusRequest is the payload for an admin forcing an order's
+// status. Reason is required and kept in the status history.
+type OverrideStatusRequest struct {
+	Status OrderStatus `json:"status"`
+	Reason string      `json:"reason"`
+}
+
+// UpdateOrderItemsRequest adds and removes lines on a PLACED order. Removed
+// lines are referenced by menu_item_id; added items merge into an existing
+// line for the same menu item.
+type UpdateOrderItemsRequest struct {
+	Add    []OrderItemRequest `json:"add,omitempty"`
+	Remove []string           `json:"remove,omitempty"`
+}
+
+// UpdateItemPrepRequest is the payload for marking an order line's preparation status.
+type UpdateItemPrepRequest struct {
+	Status PrepStatus `json:"status"`
+}
+
+// RateOrderRequest is the payload for rating a delivered order.
+type RateOrderRequest struct {
+	Stars   int    `json:"stars"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// OrderStatusSummary counts a restaurant's orders by status.
+type OrderStatusSummary struct {
+	RestaurantID string              `json:"restaurant_id"`
+	Counts       map[OrderStatus]int `json:"counts"`
+	Total        int                 `json:"total"`
+}
+
+// PopularItem is one menu item's sales in a popularity ranking.
+type PopularItem struct {
+	MenuItemID string `json:"menu_item_id" bson:"_id"`
+	// Name is the item's name on its most recent order.
+	Name       string `json:"name" bson:"name"`
+	Quantity   int    `json:"quantity" bson:"quantity"`
+	OrderCount int    `json:"order_count" bson:"order_count"`
+}
+
+// PopularItemsReport ranks a restaurant's best-selling menu items.
+type PopularItemsReport struct {
+	RestaurantID string        `json:"restaurant_id"`
+	Items        []PopularItem `json:"items"`
+	GeneratedAt  time.Time     `json:"generated_at"`
+}
+
+// RatingSummary is a restaurant's average rating across rated orders.
+type RatingSummary struct {
+	RestaurantID string  `json:"restaurant_id"`
+	Average      float64 `json:"average"`
+	Count        int     `json:"count"`
 }
@@ -0,0 +1,50 @@
+package models
+
+import "strings"
+
+// PaymentMethod is how the customer pays for an order.
+type PaymentMethod string
+
+const (
+	PaymentCash   PaymentMethod = "cash"
+	PaymentCard   PaymentMethod = "card"
+	PaymentWallet PaymentMethod = "wallet"
+)
+
+// ParsePaymentMethod normalizes a payment method case-insensitively and
+// reports whether it is one of the accepted methods.
+func ParsePaymentMethod(s string) (PaymentMethod, bool) {
+	m := PaymentMethod(strings.ToLower(strings.TrimSpace(s)))
+	switch m {
+	case PaymentCash, PaymentCard, PaymentWallet:
+		return m, true
+	}
+	return m, false
+}
+
+// PaymentStatus tracks whether an order has been paid for. There is no
+// payment gateway yet; statuses are set by the order's parties.
+type PaymentStatus string
+
+const (
+	PaymentPending  PaymentStatus = "pending"
+	PaymentPaid     PaymentStatus = "paid"
+	PaymentRefunded PaymentStatus = "refunded"
+)
+
+// IsValid checks whether a payment status is one of the allowed values.
+func (s PaymentStatus) IsValid() bool {
+	return s == PaymentPending || s == PaymentPaid || s == PaymentRefunded
+}
+
+// IsPaymentPending reports whether the order is still awaiting payment.
+// Orders placed before payment tracking have no status and count as
+// pending.
+func (o *Order) IsPaymentPending() bool {
+	return o.PaymentStatus == "" || o.PaymentStatus == PaymentPending
+}
+
+// UpdatePaymentRequest is the payload for marking an order paid or refunded.
+type UpdatePaymentRequest struct {
+	Status PaymentStatus `json:"status"`
+}
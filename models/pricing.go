@@ -0,0 +1,75 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// RoundCents rounds an amount to two decimal places.
+func RoundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Pricing holds the platform charges applied to new orders.
+type Pricing struct {
+	// TaxRate is a fraction of the discounted item total, e.g. 0.08 for 8%.
+	TaxRate float64
+	// DeliveryFee is the flat charge per order, used when the delivery
+	// distance is unknown or distance pricing is off.
+	DeliveryFee float64
+	// With a positive DeliveryPerKM, orders whose distance is known are
+	// charged DeliveryBaseFee plus DeliveryPerKM per kilometre, up to
+	// DeliveryFeeCap. A zero cap means no cap.
+	DeliveryBaseFee float64
+	DeliveryPerKM   float64
+	DeliveryFeeCap  float64
+}
+
+// DeliveryFeeFor returns the delivery fee for an order delivered
+// distanceKM from the restaurant; nil means the distance is unknown.
+func (p Pricing) DeliveryFeeFor(distanceKM *float64) float64 {
+	if distanceKM == nil || p.DeliveryPerKM <= 0 {
+		return RoundCents(p.DeliveryFee)
+	}
+	fee := p.DeliveryBaseFee + p.DeliveryPerKM**distanceKM
+	if p.DeliveryFeeCap > 0 {
+		fee = math.Min(fee, p.DeliveryFeeCap)
+	}
+	return RoundCents(fee)
+}
+
+// PriceBreakdown itemises what the customer pays for an order. The tax rate
+// and delivery fee are fixed when the order is placed, so later changes to
+// the platform's pricing do not affect existing orders.
+type PriceBreakdown struct {
+	Subtotal    float64 `json:"subtotal" bson:"subtotal"`
+	Discount    float64 `json:"discount" bson:"discount"`
+	TaxRate     float64 `json:"tax_rate" bson:"tax_rate"`
+	Tax         float64 `json:"tax" bson:"tax"`
+	DeliveryFee float64 `json:"delivery_fee" bson:"delivery_fee"`
+	// DeliveryDistanceKM is the distance the delivery fee was charged for,
+	// when it was known.
+	DeliveryDistanceKM *float64 `json:"delivery_distance_km,omitempty" bson:"delivery_distance_km,omitempty"`
+	Tip                float64  `json:"tip" bson:"tip"`
+	GrandTotal         float64  `json:"grand_total" bson:"grand_total"`
+	// CancellationFee is owed by a customer who cancelled late. It is kept
+	// from any refund rather than added to the grand total.
+	CancellationFee float64 `json:"cancellation_fee,omitempty" bson:"cancellation_fee,omitempty"`
+}
+
+// Validate checks that the pricing is usable.
+func (p Pricing) Validate() error {
+	if p.TaxRate < 0 || p.TaxRate >= 1 {
+		return fmt.Errorf("tax rate must be at least 0 and less than 1")
+	}
+	if p.DeliveryFee < 0 {
+		return fmt.Errorf("delivery fee cannot be negative")
+	}
+	if p.DeliveryBaseFee < 0 || p.DeliveryPerKM < 0 || p.DeliveryFeeCap < 0 {
+		return fmt.Errorf("delivery base fee, per-km rate and cap cannot be negative")
+	}
+	if p.DeliveryFeeCap > 0 && p.DeliveryFeeCap < p.DeliveryBaseFee {
+		return fmt.Errorf("delivery fee cap cannot be less than the base fee")
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Receipt is a customer-facing summary of an order, with names resolved and
+// every charge itemized.
+type Receipt struct {
+	OrderID         string        `json:"order_id"`
+	OrderNumber     string        `json:"order_number,omitempty"`
+	Status          OrderStatus   `json:"status"`
+	RestaurantName  string        `json:"restaurant_name"`
+	CustomerName    string        `json:"customer_name"`
+	DeliveryAddress string        `json:"delivery_address"`
+	Lines           []ReceiptLine `json:"lines"`
+	Subtotal        float64       `json:"subtotal"`
+	CouponCode      string        `json:"coupon_code,omitempty"`
+	Discount        float64       `json:"discount"`
+	TaxRate         float64       `json:"tax_rate"`
+	Tax             float64       `json:"tax"`
+	DeliveryFee     float64       `json:"delivery_fee"`
+	Tip             float64       `json:"tip"`
+	GrandTotal      float64       `json:"grand_total"`
+	CancellationFee float64       `json:"cancellation_fee,omitempty"`
+	PaymentMethod   PaymentMethod `json:"payment_method"`
+	PaymentStatus   PaymentStatus `json:"payment_status"`
+	Refund          *Refund       `json:"refund,omitempty"`
+	PlacedAt        time.Time     `json:"placed_at"`
+	DeliveredAt     *time.Time    `json:"delivered_at,omitempty"`
+	// CancelledAt is set for cancelled and rejected orders.
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	IssuedAt    time.Time  `json:"issued_at"`
+}
+
+// ReceiptLine is one order line at the price charged when it was ordered.
+type ReceiptLine struct {
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Amount    float64 `json:"amount"`
+}
+
+// NewReceipt builds the receipt for an order. Orders placed before price
+// breakdowns were recorded show no tax or delivery fee, matching what was
+// charged.
+func NewReceipt(o *Order, restaurantName, customerName string, now time.Time) *Receipt {
+	r := &Receipt{
+		OrderID:         o.ID,
+		OrderNumber:     o.OrderNumber,
+		Status:          o.Status,
+		RestaurantName:  restaurantName,
+		CustomerName:    customerName,
+		DeliveryAddress: o.DeliveryAddress,
+		Lines:           make([]ReceiptLine, 0, len(o.Items)),
+		Discount:        o.Discount,
+		Tip:             o.Tip,
+		GrandTotal:      o.GrandTotal(),
+		CancellationFee: o.CancellationFee,
+		PaymentMethod:   o.PaymentMethod,
+		PaymentStatus:   o.PaymentStatus,
+		Refund:          o.Refund,
+		PlacedAt:        o.CreatedAt,
+		IssuedAt:        now,
+	}
+	if r.PaymentStatus == "" {
+		r.PaymentStatus = PaymentPending
+	}
+	if o.Coupon != nil {
+		r.CouponCode = o.Coupon.Code
+	}
+	var subtotal float64
+	for _, item := range o.Items {
+		amount := RoundCents(item.Price * float64(item.Quantity))
+		subtotal += amount
+		r.Lines = append(r.Lines, ReceiptLine{Name: item.Name, Quantity: item.Quantity, UnitPrice: item.Price, Amount: amount})
+	}
+	r.Subtotal = RoundCents(subtotal)
+	if b := o.PriceBreakdown; b != nil {
+		r.Subtotal = b.Subtotal
+		r.TaxRate = b.TaxRate
+		r.Tax = b.Tax
+		r.DeliveryFee = b.DeliveryFee
+	}
+
+	for _, change := range o.StatusHistory {
+		at := change.Timestamp
+		switch change.ToStatus {
+		case StatusPlaced:
+			r.PlacedAt = at
+		case StatusDelivered:
+			r.DeliveredAt = &at
+		case StatusCancelled, StatusRejected:
+			r.CancelledAt = &at
+		}
+	}
+	return r
+}
+
+// receiptWidth is the width of the plain-text receipt, in characters.
+const receiptWidth = 40
+
+// Text renders the receipt as plain text for emailing or printing. Times
+// are shown in loc.
+func (r *Receipt) Text(loc *time.Location) string {
+	var b strings.Builder
+	rule := strings.Repeat("-", receiptWidth) + "\n"
+	timeFormat := "2006-01-02 15:04 MST"
+	amount := func(label string, value float64) {
+		fmt.Fprintf(&b, "%-*s%*.2f\n", receiptWidth-12, label, 12, value)
+	}
+
+	b.WriteString(r.RestaurantName + "\n")
+	number := r.OrderNumber
+	if number == "" {
+		number = r.OrderID
+	}
+	fmt.Fprintf(&b, "Order %s\n", number)
+	fmt.Fprintf(&b, "Customer: %s\n", r.CustomerName)
+	if r.DeliveryAddress != "" {
+		fmt.Fprintf(&b, "Deliver to: %s\n", r.DeliveryAddress)
+	}
+	fmt.Fprintf(&b, "Placed: %s\n", r.PlacedAt.In(loc).Format(timeFormat))
+	if r.DeliveredAt != nil {
+		fmt.Fprintf(&b, "Delivered: %s\n", r.DeliveredAt.In(loc).Format(timeFormat))
+	}
+	if r.CancelledAt != nil {
+		fmt.Fprintf(&b, "%s: %s\n", statusLabel(r.Status), r.CancelledAt.In(loc).Format(timeFormat))
+	}
+
+	b.WriteString(rule)
+	for _, line := range r.Lines {
+		amount(truncate(fmt.Sprintf("%d x %s", line.Quantity, line.Name), receiptWidth-13), line.Amount)
+		if line.Quantity > 1 {
+			fmt.Fprintf(&b, "    @ %.2f each\n", line.UnitPrice)
+		}
+	}
+	b.WriteString(rule)
+
+	amount("Subtotal", r.Subtotal)
+	if r.Discount > 0 {
+		label := "Discount"
+		if r.CouponCode != "" {
+			label += " (" + r.CouponCode + ")"
+		}
+		amount(truncate(label, receiptWidth-13), -r.Discount)
+	}
+	if r.TaxRate > 0 {
+		amount(fmt.Sprintf("Tax (%g%%)", RoundCents(r.TaxRate*100)), r.Tax)
+	}
+	if r.DeliveryFee > 0 {
+		amount("Delivery fee", r.DeliveryFee)
+	}
+	if r.Tip > 0 {
+		amount("Tip", r.Tip)
+	}
+	amount("Total", r.GrandTotal)
+	if r.CancellationFee > 0 {
+		amount("Cancellation fee", r.CancellationFee)
+	}
+	if r.Refund != nil {
+		amount("Refunded", r.Refund.Amount)
+	}
+	b.WriteString(rule)
+
+	fmt.Fprintf(&b, "Payment: %s (%s)\n", r.PaymentMethod, r.PaymentStatus)
+	fmt.Fprintf(&b, "Issued: %s\n", r.IssuedAt.In(loc).Format(timeFormat))
+	return b.String()
+}
+
+// statusLabel names an end status for the receipt, e.g. "Cancelled".
+func statusLabel(status OrderStatus) string {
+	s := strings.ToLower(string(status))
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// truncate shortens s to at most n characters, marking the cut.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
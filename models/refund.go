@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Refund records the money returned to the customer when a paid order was
+// cancelled or rejected.
+type Refund struct {
+	Amount float64 `json:"amount" bson:"amount"`
+	// Retained is the part of the grand total that was kept: lines the
+	// kitchen had already prepared and any cancellation fee.
+	Retained float64 `json:"retained" bson:"retained"`
+	// Partial is set when anything was retained.
+	Partial    bool      `json:"partial" bson:"partial"`
+	Reason     string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	RefundedAt time.Time `json:"refunded_at" bson:"refunded_at"`
+}
+
+// RefundAmount splits a cancelled order's grand total into the amount to
+// refund and the amount retained. Lines marked ready in the kitchen are
+// retained at what the customer paid for them, after the coupon discount
+// and with tax, along with any cancellation fee. Delivery and tip are always
+// refunded, since the order was never delivered. It depends only on the
+// order, so the split can be checked without a payment provider.
+func RefundAmount(o *Order) (amount, retained float64) {
+	var subtotal, prepared float64
+	for _, item := range o.Items {
+		line := item.Price * float64(item.Quantity)
+		subtotal += line
+		if item.PrepStatus == PrepReady {
+			prepared += line
+		}
+	}
+	if subtotal > 0 && prepared > 0 {
+		// Spread the discount over the lines in proportion to their value.
+		prepared *= o.TotalAmount / subtotal
+		if o.PriceBreakdown != nil {
+			prepared *= 1 + o.PriceBreakdown.TaxRate
+		}
+	}
+
+	total := o.GrandTotal()
+	retained = RoundCents(prepared + o.CancellationFee)
+	if retained > total {
+		retained = total
+	}
+	return RoundCents(total - retained), retained
+}
@@ -1,5 +1,42 @@
 package models
 
+import (
+	"regexp"
+	"time"
+)
+
+// DateLayout is the format used for calendar dates such as blackout dates.
+const DateLayout = "2006-01-02"
+
+// DefaultOrderPrefix is used for order numbers when a restaurant has not
+// configured its own prefix.
+const DefaultOrderPrefix = "ORD-"
+
+// orderPrefixPattern allows 1–8 uppercase letters or digits with an
+// optional trailing dash, e.g. "PZA-".
+var orderPrefixPattern = regexp.MustCompile(`^[A-Z0-9]{1,8}-?$`)
+
+// phonePattern is basic E.164: a plus sign and 8–15 digits.
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// emailPattern is a pragmatic check for local@domain.tld.
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// IsValidPhone checks whether a phone number is in E.164 format.
+func IsValidPhone(phone string) bool {
+	return phonePattern.MatchString(phone)
+}
+
+// IsValidEmail checks whether an address looks like an email address.
+func IsValidEmail(email string) bool {
+	return len(email) <= 254 && emailPattern.MatchString(email)
+}
+
+// IsValidOrderPrefix checks whether a prefix is acceptable for order numbers.
+func IsValidOrderPrefix(prefix string) bool {
+	return orderPrefixPattern.MatchString(prefix)
+}
+
 // Role represents a user's role in the system.
 type Role string
 
@@ -7,26 +44,217 @@ const (
 	RoleCustomer   Role = "customer"
 	RoleRestaurant Role = "restaurant"
 	RoleDriver     Role = "driver"
+	// RoleAdmin is for operators. Admins cannot self-register; they are
+	// created through the seed file.
+	RoleAdmin Role = "admin"
 )
 
+// RoleSystem marks status changes made by the server itself, such as
+// automatic timeouts. No user can hold it.
+const RoleSystem Role = "system"
+
 // IsValid checks whether a role string is one of the allowed roles.
 func (r Role) IsValid() bool {
 	switch r {
-	case RoleCustomer, RoleRestaurant, RoleDriver:
+	case RoleCustomer, RoleRestaurant, RoleDriver, RoleAdmin:
 		return true
 	}
 	return false
 }
 
+// RestaurantSettings holds per-restaurant workflow preferences.
+type RestaurantSettings struct {
+	// RequireItemConfirmation forces the restaurant to confirm each line
+	// item's availability when accepting an order.
+	RequireItemConfirmation bool `json:"require_item_confirmation" bson:"require_item_confirmation"`
+	// Timezone is an IANA zone name used to evaluate calendar dates.
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty"`
+	// DefaultPrepMinutes is the restaurant's usual preparation time.
+	DefaultPrepMinutes int `json:"default_prep_minutes,omitempty" bson:"default_prep_minutes,omitempty"`
+	// OrderPrefix is prepended to this restaurant's order numbers.
+	OrderPrefix string `json:"order_prefix,omitempty" bson:"order_prefix,omitempty"`
+	// BlackoutDates lists dates (YYYY-MM-DD) on which the restaurant is closed.
+	BlackoutDates []string `json:"blackout_dates,omitempty" bson:"blackout_dates,omitempty"`
+	// WebhookURL receives a signed POST whenever one of the restaurant's
+	// orders changes status.
+	WebhookURL string `json:"webhook_url,omitempty" bson:"webhook_url,omitempty"`
+	// OpensAt and ClosesAt are HH:MM in the restaurant's time zone. A
+	// closing time before the opening time wraps past midnight; leaving
+	// either empty keeps that side open.
+	OpensAt  string `json:"opens_at,omitempty" bson:"opens_at,omitempty"`
+	ClosesAt string `json:"closes_at,omitempty" bson:"closes_at,omitempty"`
+}
+
+// Location returns the restaurant's time zone, defaulting to UTC when unset
+// or invalid.
+func (s *RestaurantSettings) Location() *time.Location {
+	if s == nil || s.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// OrderNumberPrefix returns the configured order prefix or the platform default.
+func (s *RestaurantSettings) OrderNumberPrefix() string {
+	if s == nil || s.OrderPrefix == "" {
+		return DefaultOrderPrefix
+	}
+	return s.OrderPrefix
+}
+
+// PrepTime returns the restaurant's default preparation time, or zero if unset.
+func (s *RestaurantSettings) PrepTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(s.DefaultPrepMinutes) * time.Minute
+}
+
+// IsBlackedOut reports whether t falls on one of the restaurant's blackout
+// dates, evaluated in the restaurant's time zone.
+func (s *RestaurantSettings) IsBlackedOut(t time.Time) bool {
+	if s == nil {
+		return false
+	}
+	date := t.In(s.Location()).Format(DateLayout)
+	for _, d := range s.BlackoutDates {
+		if d == date {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOpenAt reports whether the restaurant takes orders at t: within its
+// opening hours and not on a blackout date.
+func (s *RestaurantSettings) IsOpenAt(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	hours := MenuSchedule{AvailableFrom: s.OpensAt, AvailableUntil: s.ClosesAt}
+	return hours.Contains(t, s.Location()) && !s.IsBlackedOut(t)
+}
+
 // User represents a registered user (customer, restaurant, or driver).
 type User struct {
-	ID   string `json:"id" bson:"_id,omitempty"`
-	Name string `json:"name" bson:"name"`
-	Role Role   `json:"role" bson:"role"`
+	ID       string              `json:"id" bson:"_id,omitempty"`
+	Name     string              `json:"name" bson:"name"`
+	Role     Role                `json:"role" bson:"role"`
+	Address  string              `json:"address,omitempty" bson:"address,omitempty"`
+	Phone    string              `json:"phone,omitempty" bson:"phone,omitempty"`
+	Email    string              `json:"email,omitempty" bson:"email,omitempty"`
+	Settings *RestaurantSettings `json:"settings,omitempty" bson:"settings,omitempty"`
+	// Cuisine and Tags describe a restaurant for discovery.
+	Cuisine string   `json:"cuisine,omitempty" bson:"cuisine,omitempty"`
+	Tags    []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	// Available marks a driver who is online and can take deliveries;
+	// LastSeen is the driver's latest availability update. Both are only
+	// set for drivers.
+	Available *bool      `json:"available,omitempty" bson:"available,omitempty"`
+	LastSeen  *time.Time `json:"last_seen,omitempty" bson:"last_seen,omitempty"`
+	// Lat and Lng locate a restaurant. Geo holds the same point for the
+	// nearby search; set all three with SetLocation.
+	Lat *float64  `json:"lat,omitempty" bson:"lat,omitempty"`
+	Lng *float64  `json:"lng,omitempty" bson:"lng,omitempty"`
+	Geo *GeoPoint `json:"-" bson:"geo,omitempty"`
+	// PasswordHash is the bcrypt hash checked at login. It is never
+	// returned in responses.
+	PasswordHash string `json:"-" bson:"password_hash,omitempty"`
+}
+
+// SetLocation places the user at lat, lng.
+func (u *User) SetLocation(lat, lng float64) {
+	u.Lat, u.Lng = &lat, &lng
+	u.Geo = NewGeoPoint(lat, lng)
+}
+
+// IsAvailable reports whether the user is a driver who is taking deliveries.
+func (u *User) IsAvailable() bool {
+	return u.Role == RoleDriver && u.Available != nil && *u.Available
+}
+
+// ShowAvailability makes a driver's availability explicit in responses,
+// reporting drivers who have never set it as unavailable.
+func (u *User) ShowAvailability() {
+	if u.Role == RoleDriver && u.Available == nil {
+		available := false
+		u.Available = &available
+	}
+}
+
+// HideContact clears the user's phone and email, for responses to anyone
+// but the user themselves and admins.
+func (u *User) HideContact() {
+	u.Phone = ""
+	u.Email = ""
+}
+
+// RestaurantListing is the public view of a restaurant in search results.
+type RestaurantListing struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Address string   `json:"address,omitempty"`
+	Cuisine string   `json:"cuisine,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Lat     *float64 `json:"lat,omitempty"`
+	Lng     *float64 `json:"lng,omitempty"`
+	// DistanceKM is set in nearby searches.
+	DistanceKM *float64 `json:"distance_km,omitempty"`
+}
+
+// Listing returns the restaurant's public search view.
+func (u *User) Listing() RestaurantListing {
+	return RestaurantListing{ID: u.ID, Name: u.Name, Address: u.Address, Cuisine: u.Cuisine, Tags: u.Tags, Lat: u.Lat, Lng: u.Lng}
 }
 
 // CreateUserRequest is the payload for registering a new user.
 type CreateUserRequest struct {
-	Name string `json:"name"`
-	Role Role   `json:"role"`
+	Name    string `json:"name"`
+	Role    Role   `json:"role"`
+	Address string `json:"address,omitempty"`
+	// Phone is in E.164 format, e.g. +14155550123. Required for customers
+	// and drivers.
+	Phone string `json:"phone,omitempty"`
+	Email string `json:"email,omitempty"`
+	// Password is required and is stored only as a hash.
+	Password string `json:"password"`
+}
+
+// UpdateRestaurantSettingsRequest is the payload for changing a restaurant's settings.
+type UpdateRestaurantSettingsRequest struct {
+	RequireItemConfirmation *bool   `json:"require_item_confirmation"`
+	Timezone                *string `json:"timezone"`
+	OrderPrefix             *string `json:"order_prefix"`
+	DefaultPrepMinutes      *int    `json:"default_prep_minutes"`
+	WebhookURL              *string `json:"webhook_url"`
+	OpensAt                 *string `json:"opens_at"`
+	ClosesAt                *string `json:"closes_at"`
+}
+
+// UpdateCuisineRequest sets a restaurant's cuisine and tags.
+type UpdateCuisineRequest struct {
+	Cuisine string   `json:"cuisine"`
+	Tags    []string `json:"tags"`
+}
+
+// UpdateBlackoutDatesRequest replaces a restaurant's blackout dates.
+type UpdateBlackoutDatesRequest struct {
+	Dates []string `json:"dates"`
+}
+
+// LoginRequest is the payload for obtaining an access token.
+type LoginRequest struct {
+	UserID   string `json:"user_id"`
+	Password string `json:"password"`
+}
+
+// LoginResponse carries an issued access token.
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      *User     `json:"user"`
 }
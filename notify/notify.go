@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"fmt"
+	"food-delivery-api/models"
+	"food-delivery-api/webhook"
+	"log"
+	"strings"
+	"time"
+)
+
+// PickupAlert tells drivers that an order is ready to be collected.
+type PickupAlert struct {
+	OrderID        string    `json:"order_id"`
+	OrderNumber    string    `json:"order_number,omitempty"`
+	RestaurantID   string    `json:"restaurant_id"`
+	RestaurantName string    `json:"restaurant_name"`
+	PickupAddress  string    `json:"pickup_address,omitempty"`
+	DriverIDs      []string  `json:"driver_ids"`
+	ReadyAt        time.Time `json:"ready_at"`
+}
+
+// Notifier delivers pickup alerts to drivers. It is called from a
+// background goroutine, so it may block, but it should give up rather than
+// retry indefinitely. Swap the implementation to change how drivers are
+// reached, e.g. a push service.
+type Notifier interface {
+	NotifyDrivers(alert PickupAlert) error
+}
+
+// Log writes each alert to the server log. It is the default notifier and
+// is useful in development.
+type Log struct{}
+
+// NotifyDrivers logs the alert.
+func (Log) NotifyDrivers(alert PickupAlert) error {
+	log.Printf("📣 Order %s ready at %s; notified drivers %s", alert.OrderID, alert.RestaurantName, strings.Join(alert.DriverIDs, ", "))
+	return nil
+}
+
+// Webhook posts each alert, signed, to a single URL, such as a dispatch
+// service that fans out to drivers' devices.
+type Webhook struct {
+	URL        string
+	Dispatcher *webhook.Dispatcher
+}
+
+// NotifyDrivers posts the alert in the background.
+func (n Webhook) NotifyDrivers(alert PickupAlert) error {
+	n.Dispatcher.SendJSON(n.URL, alert, "pickup alert for order "+alert.OrderID)
+	return nil
+}
+
+// Parse returns the notifier named by kind: "log" or "webhook". The webhook
+// notifier posts to url and needs a dispatcher; "none" or an empty kind
+// returns nil, which disables alerts.
+func Parse(kind, url string, dispatcher *webhook.Dispatcher) (Notifier, error) {
+	switch kind {
+	case "", "none":
+		return nil, nil
+	case "log":
+		return Log{}, nil
+	case "webhook":
+		if url == "" {
+			return nil, fmt.Errorf("the webhook notifier needs a URL")
+		}
+		if dispatcher == nil {
+			return nil, fmt.Errorf("the webhook notifier needs WEBHOOK_SECRET for signing")
+		}
+		return Webhook{URL: url, Dispatcher: dispatcher}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier '%s'; expected log, webhook or none", kind)
+}
+
+// NewPickupAlert builds the alert for an order that is ready for pickup.
+func NewPickupAlert(order *models.Order, restaurant *models.User, driverIDs []string, readyAt time.Time) PickupAlert {
+	return PickupAlert{
+		OrderID:        order.ID,
+		OrderNumber:    order.OrderNumber,
+		RestaurantID:   restaurant.ID,
+		RestaurantName: restaurant.Name,
+		PickupAddress:  restaurant.Address,
+		DriverIDs:      driverIDs,
+		ReadyAt:        readyAt,
+	}
+}
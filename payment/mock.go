@@ -0,0 +1,101 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Mock is an in-memory Provider that approves every payment. It is the
+// default provider, for development and tests; state is lost on restart.
+type Mock struct {
+	// Fail, when set, is returned by every call, to simulate a gateway
+	// outage or a declined card.
+	Fail error
+
+	mu      sync.Mutex
+	seq     int
+	intents map[string]*mockIntent
+}
+
+type mockIntent struct {
+	amount float64
+	// charged is the amount captured; capturing releases the rest.
+	charged  float64
+	captured bool
+	refunded bool
+}
+
+// NewMock creates an empty Mock.
+func NewMock() *Mock {
+	return &Mock{intents: make(map[string]*mockIntent)}
+}
+
+// CreateIntent records a hold for amount.
+func (m *Mock) CreateIntent(ctx context.Context, orderID string, amount float64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Fail != nil {
+		return "", m.Fail
+	}
+	if amount <= 0 {
+		return "", fmt.Errorf("amount must be positive")
+	}
+	id := m.nextID("pi")
+	m.intents[id] = &mockIntent{amount: amount}
+	return id, nil
+}
+
+// Capture charges an uncaptured intent for up to the amount held.
+func (m *Mock) Capture(ctx context.Context, intentID string, amount float64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Fail != nil {
+		return "", m.Fail
+	}
+	intent, ok := m.intents[intentID]
+	switch {
+	case !ok:
+		return "", fmt.Errorf("payment intent not found: %s", intentID)
+	case intent.captured || intent.refunded:
+		return "", fmt.Errorf("payment intent %s is already settled", intentID)
+	case amount > intent.amount:
+		return "", fmt.Errorf("cannot capture %.2f; only %.2f is held", amount, intent.amount)
+	}
+	intent.captured = true
+	intent.charged = amount
+	return m.nextID("ch"), nil
+}
+
+// Refund refunds a captured intent, up to the amount charged, or releases
+// an uncaptured one, up to the amount held.
+func (m *Mock) Refund(ctx context.Context, intentID string, amount float64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Fail != nil {
+		return "", m.Fail
+	}
+	intent, ok := m.intents[intentID]
+	if !ok {
+		return "", fmt.Errorf("payment intent not found: %s", intentID)
+	}
+	limit := intent.amount
+	if intent.captured {
+		limit = intent.charged
+	}
+	switch {
+	case intent.refunded:
+		return "", fmt.Errorf("payment intent %s is already refunded", intentID)
+	case amount > limit:
+		return "", fmt.Errorf("cannot refund %.2f; only %.2f is available", amount, limit)
+	}
+	intent.refunded = true
+	return m.nextID("re"), nil
+}
+
+// nextID returns a new mock ID with the given Stripe-style prefix. The
+// caller holds m.mu.
+func (m *Mock) nextID(prefix string) string {
+	m.seq++
+	return fmt.Sprintf("%s_mock_%d", prefix, m.seq)
+}
@@ -0,0 +1,169 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"food-delivery-api/models"
+	"time"
+)
+
+// Provider talks to a payment gateway using a Stripe-style intent flow: an
+// intent holds the amount on the customer's card when the order is placed,
+// capturing it charges the card, and refunding returns the money. Calls are
+// made while handling requests, so implementations should honour ctx and
+// must be safe for concurrent use.
+type Provider interface {
+	// CreateIntent holds amount for the order and returns the intent's ID.
+	CreateIntent(ctx context.Context, orderID string, amount float64) (string, error)
+	// Capture charges amount, which may be less than the amount held if
+	// the order changed, releases the rest of the hold, and returns the
+	// charge's ID.
+	Capture(ctx context.Context, intentID string, amount float64) (string, error)
+	// Refund returns amount of an intent's charge, or all of it when amount
+	// is zero, and returns the refund's ID. Refunding an intent that was
+	// never captured releases the hold.
+	Refund(ctx context.Context, intentID string, amount float64) (string, error)
+}
+
+// Parse returns the provider named by kind: "mock" (or empty) for the
+// in-memory Mock, or "none", which returns nil and leaves card payments to
+// be recorded by hand.
+func Parse(kind string) (Provider, error) {
+	switch kind {
+	case "", "mock":
+		return NewMock(), nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown payment provider '%s'; expected mock or none", kind)
+}
+
+// Authorize creates an intent for a new card order's grand total. Other
+// payment methods are settled outside the gateway and are left alone, as
+// is every order when p is nil.
+func Authorize(ctx context.Context, p Provider, order *models.Order) error {
+	if p == nil || order.PaymentMethod != models.PaymentCard {
+		return nil
+	}
+	intentID, err := p.CreateIntent(ctx, order.ID, order.GrandTotal())
+	if err != nil {
+		return err
+	}
+	order.PaymentIntentID = intentID
+	return nil
+}
+
+// Reauthorize replaces a pending card order's hold with one for its current
+// grand total, for when the total changed. The new intent's ID is stored on
+// the order and the old one is returned, to be released with ReleaseIntent
+// once the change is saved. Orders without an intent are left alone and
+// return an empty ID.
+func Reauthorize(ctx context.Context, p Provider, order *models.Order) (string, error) {
+	if p == nil || order.PaymentIntentID == "" || !order.IsPaymentPending() {
+		return "", nil
+	}
+	intentID, err := p.CreateIntent(ctx, order.ID, order.GrandTotal())
+	if err != nil {
+		return "", err
+	}
+	previous := order.PaymentIntentID
+	order.PaymentIntentID = intentID
+	return previous, nil
+}
+
+// Release frees the hold Authorize or Reauthorize placed for an order whose
+// change could not be saved. Orders without an intent are left alone.
+func Release(ctx context.Context, p Provider, order *models.Order) error {
+	return ReleaseIntent(ctx, p, order.PaymentIntentID)
+}
+
+// ReleaseIntent frees the hold of an uncaptured intent. An empty ID is
+// ignored.
+func ReleaseIntent(ctx context.Context, p Provider, intentID string) error {
+	if p == nil || intentID == "" {
+		return nil
+	}
+	_, err := p.Refund(ctx, intentID, 0)
+	return err
+}
+
+// Capture charges the order's intent for its current grand total and marks
+// it paid. Orders without an intent, or no longer pending, are left alone.
+func Capture(ctx context.Context, p Provider, order *models.Order, by string, role models.Role, now time.Time) error {
+	if p == nil || order.PaymentIntentID == "" || !order.IsPaymentPending() {
+		return nil
+	}
+	chargeID, err := p.Capture(ctx, order.PaymentIntentID, order.GrandTotal())
+	if err != nil {
+		return err
+	}
+	order.PaymentChargeID = chargeID
+	setStatus(order, models.PaymentPaid, by, role, now)
+	return nil
+}
+
+// Refund returns a cancelled or rejected order's payment, keeping what
+// models.RefundAmount retains. A paid order is refunded the rest, through p
+// for card orders and recorded as-is for other methods. A card hold that
+// was never captured is captured for the retained amount, which releases
+// the rest, or released in full if nothing is retained. Orders that are
+// unpaid and hold nothing, or already refunded, are left alone.
+func Refund(ctx context.Context, p Provider, order *models.Order, by string, role models.Role, now time.Time) error {
+	amount, retained := models.RefundAmount(order)
+	switch {
+	case order.PaymentStatus == models.PaymentPaid:
+		if p != nil && order.PaymentIntentID != "" && amount > 0 {
+			refundID, err := p.Refund(ctx, order.PaymentIntentID, amount)
+			if err != nil {
+				return err
+			}
+			order.PaymentRefundID = refundID
+		}
+	case p != nil && order.PaymentIntentID != "" && order.IsPaymentPending():
+		if retained > 0 {
+			chargeID, err := p.Capture(ctx, order.PaymentIntentID, retained)
+			if err != nil {
+				return err
+			}
+			order.PaymentChargeID = chargeID
+		} else {
+			refundID, err := p.Refund(ctx, order.PaymentIntentID, 0)
+			if err != nil {
+				return err
+			}
+			order.PaymentRefundID = refundID
+		}
+	default:
+		return nil
+	}
+
+	reason := order.CancellationReason
+	if reason == "" {
+		reason = order.RejectionReason
+	}
+	order.Refund = &models.Refund{Amount: amount, Retained: retained, Partial: retained > 0, Reason: reason, RefundedAt: now}
+	order.RecordAudit(models.AuditEntry{
+		Field:     "refund",
+		NewValue:  amount,
+		ChangedBy: by,
+		Role:      role,
+		Timestamp: now,
+		Reason:    reason,
+	})
+	setStatus(order, models.PaymentRefunded, by, role, now)
+	return nil
+}
+
+// setStatus changes the order's payment status, recording it in the audit
+// trail.
+func setStatus(order *models.Order, status models.PaymentStatus, by string, role models.Role, now time.Time) {
+	order.RecordAudit(models.AuditEntry{
+		Field:     "payment_status",
+		OldValue:  order.PaymentStatus,
+		NewValue:  status,
+		ChangedBy: by,
+		Role:      role,
+		Timestamp: now,
+	})
+	order.PaymentStatus = status
+}
@@ -0,0 +1,76 @@
+package payment
+
+import (
+	"context"
+	"food-delivery-api/models"
+	"testing"
+	"time"
+)
+
+// newCardOrder returns a cancelled card order with a hold for its total.
+func newCardOrder(t *testing.T, m *Mock, fee float64) *models.Order {
+	t.Helper()
+	order := &models.Order{
+		ID:            "order-1",
+		Items:         []models.OrderItem{{MenuItemID: "item-1", Name: "Margherita", Quantity: 1, Price: 20}},
+		TotalAmount:   20,
+		Status:        models.StatusCancelled,
+		PaymentMethod: models.PaymentCard,
+		PaymentStatus: models.PaymentPending,
+	}
+	if err := Authorize(context.Background(), m, order); err != nil {
+		t.Fatal(err)
+	}
+	order.SetCancellationFee(fee)
+	return order
+}
+
+func TestRefundPendingCardOrderKeepsFee(t *testing.T) {
+	m := NewMock()
+	order := newCardOrder(t, m, 5)
+
+	if err := Refund(context.Background(), m, order, "cust-1", models.RoleCustomer, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if order.PaymentStatus != models.PaymentRefunded {
+		t.Errorf("payment_status = %s, want refunded", order.PaymentStatus)
+	}
+	if order.Refund == nil || order.Refund.Amount != 15 || order.Refund.Retained != 5 || !order.Refund.Partial {
+		t.Fatalf("refund = %+v, want 15 refunded and 5 retained", order.Refund)
+	}
+	intent := m.intents[order.PaymentIntentID]
+	if !intent.captured || intent.charged != 5 {
+		t.Errorf("intent captured %v for %.2f, want the 5.00 fee charged", intent.captured, intent.charged)
+	}
+	if order.PaymentChargeID == "" {
+		t.Error("payment_charge_id not recorded")
+	}
+	audited := false
+	for _, e := range order.Audit {
+		audited = audited || e.Field == "refund"
+	}
+	if !audited {
+		t.Error("no refund audit entry")
+	}
+}
+
+func TestRefundPendingCardOrderReleasesHold(t *testing.T) {
+	m := NewMock()
+	order := newCardOrder(t, m, 0)
+
+	if err := Refund(context.Background(), m, order, "cust-1", models.RoleCustomer, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	intent := m.intents[order.PaymentIntentID]
+	if intent.captured || !intent.refunded {
+		t.Errorf("intent captured %v, released %v; want the hold released", intent.captured, intent.refunded)
+	}
+	if order.Refund == nil || order.Refund.Amount != 20 || order.Refund.Partial {
+		t.Errorf("refund = %+v, want 20 refunded in full", order.Refund)
+	}
+	if order.PaymentRefundID == "" || order.PaymentStatus != models.PaymentRefunded {
+		t.Errorf("got refund ID %q and status %s, want a refund ID and refunded", order.PaymentRefundID, order.PaymentStatus)
+	}
+}
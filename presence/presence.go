@@ -0,0 +1,54 @@
+package presence
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Store is the persistence the Sweeper needs. *db.Store and *memstore.Store
+// implement it.
+type Store interface {
+	MarkIdleDriversUnavailable(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Sweeper marks drivers unavailable once they stop sending heartbeats, so
+// drivers who closed the app are not alerted or offered orders.
+type Sweeper struct {
+	Store Store
+	// Timeout is how long an available driver may go unseen.
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+// NewSweeper creates a Sweeper that checks every interval.
+func NewSweeper(store Store, timeout, interval time.Duration) *Sweeper {
+	return &Sweeper{Store: store, Timeout: timeout, Interval: interval}
+}
+
+// Run sweeps on every tick until ctx is cancelled.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sweep(ctx, time.Now())
+		}
+	}
+}
+
+// Sweep marks every available driver not seen within Timeout of now as
+// unavailable.
+func (s *Sweeper) Sweep(ctx context.Context, now time.Time) {
+	n, err := s.Store.MarkIdleDriversUnavailable(ctx, now.Add(-s.Timeout))
+	if err != nil {
+		log.Printf("⚠️ presence: marking idle drivers unavailable: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("💤 Marked %d idle driver(s) unavailable", n)
+	}
+}
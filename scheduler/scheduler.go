@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"context"
+	"food-delivery-api/events"
+	"food-delivery-api/models"
+	"food-delivery-api/statemachine"
+	"log"
+	"time"
+)
+
+// Store is the persistence the Activator needs. *db.Store and *memstore.Store
+// implement it.
+type Store interface {
+	ListDueScheduledOrders(ctx context.Context, now time.Time) ([]*models.Order, error)
+	ReplaceOrderIfStatus(ctx context.Context, order *models.Order, expected models.OrderStatus) (bool, error)
+}
+
+// Activator places scheduled orders once their scheduled time arrives.
+type Activator struct {
+	Store    Store
+	Interval time.Duration
+	// Events receives each status change; nil disables publishing.
+	Events *events.Bus
+}
+
+// NewActivator creates an Activator that checks every interval.
+func NewActivator(store Store, interval time.Duration) *Activator {
+	return &Activator{Store: store, Interval: interval}
+}
+
+// Run activates due orders on every tick until ctx is cancelled.
+func (a *Activator) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.Activate(ctx, time.Now())
+		}
+	}
+}
+
+// Activate moves every SCHEDULED order that is due as of now to PLACED,
+// recording the system as the actor. From then on the order follows the
+// normal lifecycle, including the PLACED timeout.
+func (a *Activator) Activate(ctx context.Context, now time.Time) {
+	orders, err := a.Store.ListDueScheduledOrders(ctx, now)
+	if err != nil {
+		log.Printf("⚠️ scheduler: listing due orders: %v", err)
+		return
+	}
+	for _, order := range orders {
+		if err := statemachine.ValidateTransition(order.Status, models.StatusPlaced, models.RoleSystem); err != nil {
+			log.Printf("⚠️ scheduler: order %s: %v", order.ID, err)
+			continue
+		}
+		change := models.StatusChange{
+			FromStatus: models.StatusScheduled,
+			ToStatus:   models.StatusPlaced,
+			ChangedBy:  string(models.RoleSystem),
+			Role:       models.RoleSystem,
+			Timestamp:  now,
+		}
+		order.StatusHistory = append(order.StatusHistory, change)
+		order.Status = models.StatusPlaced
+		order.UpdatedAt = now
+
+		// The customer may have cancelled in the meantime; that wins.
+		saved, err := a.Store.ReplaceOrderIfStatus(ctx, order, models.StatusScheduled)
+		if err != nil {
+			log.Printf("⚠️ scheduler: placing order %s: %v", order.ID, err)
+			continue
+		}
+		if saved {
+			a.Events.Publish(order.ID, change)
+			log.Printf("⏰ Placed scheduled order %s", order.ID)
+		}
+	}
+}
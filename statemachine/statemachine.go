@@ -1,32 +1,88 @@
 package statemachine
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"food-delivery-api/models"
+	"os"
 )
 
-// transition defines an allowed state change along with which roles may perform it.
-type transition struct {
-	To           models.OrderStatus
-	AllowedRoles []models.Role
+// Transition defines an allowed state change along with which roles may perform it.
+type Transition struct {
+	To           models.OrderStatus `json:"to"`
+	AllowedRoles []models.Role      `json:"roles"`
+	// Revert marks a backward step that undoes an accidental change. It is
+	// only allowed shortly after the change it undoes.
+	Revert bool `json:"revert,omitempty"`
 }
 
 // transitionMap defines every valid transition from each state.
-// This is the single source of truth for the order lifecycle.
-var transitionMap = map[models.OrderStatus][]transition{
+// This is the single source of truth for the order lifecycle. It starts as
+// the built-in lifecycle below and may be replaced at startup by Load.
+var transitionMap = defaultTransitions
+
+// knownStatuses is every status the active lifecycle defines, including
+// terminal ones.
+var knownStatuses = statusSet(defaultStatuses)
+
+// statusOrder lists the active lifecycle's statuses in the order they were
+// declared, for GetTransitionGraph.
+var statusOrder = defaultStatuses
+
+// defaultStatuses are the statuses of the built-in lifecycle, in the order
+// an order passes through them.
+var defaultStatuses = []models.OrderStatus{
+	models.StatusScheduled,
+	models.StatusPlaced,
+	models.StatusConfirmed,
+	models.StatusPreparing,
+	models.StatusReadyForPickup,
+	models.StatusPickedUp,
+	models.StatusOutForDelivery,
+	models.StatusDelivered,
+	models.StatusCancelled,
+	models.StatusRejected,
+}
+
+// statusSet returns the statuses as a set.
+func statusSet(statuses []models.OrderStatus) map[models.OrderStatus]bool {
+	set := make(map[models.OrderStatus]bool, len(statuses))
+	for _, s := range statuses {
+		set[s] = true
+	}
+	return set
+}
+
+// optionalStatuses are built-in statuses a custom lifecycle may leave out,
+// disabling the feature that uses them.
+var optionalStatuses = map[models.OrderStatus]bool{
+	models.StatusScheduled: true,
+	models.StatusRejected:  true,
+}
+
+// defaultTransitions is the built-in order lifecycle.
+var defaultTransitions = map[models.OrderStatus][]Transition{
+	models.StatusScheduled: {
+		{To: models.StatusPlaced, AllowedRoles: []models.Role{models.RoleSystem}},
+		{To: models.StatusCancelled, AllowedRoles: []models.Role{models.RoleCustomer}},
+	},
 	models.StatusPlaced: {
 		{To: models.StatusConfirmed, AllowedRoles: []models.Role{models.RoleRestaurant}},
-		{To: models.StatusCancelled, AllowedRoles: []models.Role{models.RoleCustomer}},
+		{To: models.StatusCancelled, AllowedRoles: []models.Role{models.RoleCustomer, models.RoleSystem}},
+		{To: models.StatusRejected, AllowedRoles: []models.Role{models.RoleRestaurant}},
 	},
 	models.StatusConfirmed: {
 		{To: models.StatusPreparing, AllowedRoles: []models.Role{models.RoleRestaurant}},
-		{To: models.StatusCancelled, AllowedRoles: []models.Role{models.RoleCustomer, models.RoleRestaurant}},
+		{To: models.StatusCancelled, AllowedRoles: []models.Role{models.RoleCustomer, models.RoleRestaurant, models.RoleSystem}},
 	},
 	models.StatusPreparing: {
 		{To: models.StatusReadyForPickup, AllowedRoles: []models.Role{models.RoleRestaurant}},
+		{To: models.StatusConfirmed, AllowedRoles: []models.Role{models.RoleRestaurant}, Revert: true},
 	},
 	models.StatusReadyForPickup: {
 		{To: models.StatusPickedUp, AllowedRoles: []models.Role{models.RoleDriver}},
+		{To: models.StatusPreparing, AllowedRoles: []models.Role{models.RoleRestaurant}, Revert: true},
 	},
 	models.StatusPickedUp: {
 		{To: models.StatusOutForDelivery, AllowedRoles: []models.Role{models.RoleDriver}},
@@ -34,7 +90,100 @@ var transitionMap = map[models.OrderStatus][]transition{
 	models.StatusOutForDelivery: {
 		{To: models.StatusDelivered, AllowedRoles: []models.Role{models.RoleDriver, models.RoleCustomer}},
 	},
-	// Terminal states – no transitions allowed from DELIVERED or CANCELLED.
+	// Terminal states – no transitions allowed from DELIVERED, CANCELLED or
+	// REJECTED.
+}
+
+// Config is the on-disk format of a custom order lifecycle. Statuses lists
+// every status, including terminal ones; Transitions maps each non-terminal
+// status to the statuses it may move to.
+type Config struct {
+	Statuses    []models.OrderStatus                `json:"statuses"`
+	Transitions map[models.OrderStatus][]Transition `json:"transitions"`
+}
+
+// Validate checks that the config is self-consistent: every status it
+// references is declared, every role exists, and the built-in statuses the
+// API depends on are still present.
+func (c *Config) Validate() error {
+	declared := make(map[models.OrderStatus]bool, len(c.Statuses))
+	for _, s := range c.Statuses {
+		if s == "" {
+			return fmt.Errorf("statuses: empty status name")
+		}
+		if declared[s] {
+			return fmt.Errorf("statuses: duplicate status '%s'", s)
+		}
+		declared[s] = true
+	}
+	for _, s := range defaultStatuses {
+		if !declared[s] && !optionalStatuses[s] {
+			return fmt.Errorf("statuses: built-in status '%s' is missing", s)
+		}
+	}
+	for from, transitions := range c.Transitions {
+		if !declared[from] {
+			return fmt.Errorf("transitions: unknown status '%s'", from)
+		}
+		targets := make(map[models.OrderStatus]bool, len(transitions))
+		for _, t := range transitions {
+			if !declared[t.To] {
+				return fmt.Errorf("transitions[%s]: unknown target status '%s'", from, t.To)
+			}
+			if targets[t.To] {
+				return fmt.Errorf("transitions[%s]: duplicate target '%s'", from, t.To)
+			}
+			targets[t.To] = true
+			if t.Revert && from == t.To {
+				return fmt.Errorf("transitions[%s→%s]: a revert must go to a different status", from, t.To)
+			}
+			if len(t.AllowedRoles) == 0 {
+				return fmt.Errorf("transitions[%s→%s]: at least one role is required", from, t.To)
+			}
+			for _, role := range t.AllowedRoles {
+				if !role.IsValid() && role != models.RoleSystem {
+					return fmt.Errorf("transitions[%s→%s]: unknown role '%s'", from, t.To, role)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Load reads a lifecycle config from path, validates it, and makes it the
+// active lifecycle. It must be called before the server starts handling
+// requests.
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read state machine file: %w", err)
+	}
+	var c Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return fmt.Errorf("failed to parse state machine file: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	transitions := make(map[models.OrderStatus][]Transition, len(c.Transitions))
+	for from, ts := range c.Transitions {
+		// A status with an empty list is terminal, same as one left out.
+		if len(ts) > 0 {
+			transitions[from] = ts
+		}
+	}
+	knownStatuses = statusSet(c.Statuses)
+	statusOrder = c.Statuses
+	transitionMap = transitions
+	return nil
+}
+
+// IsKnownStatus reports whether status is part of the active lifecycle.
+func IsKnownStatus(status models.OrderStatus) bool {
+	return knownStatuses[status]
 }
 
 // ValidateTransition checks whether moving from the order's current status to
@@ -81,6 +230,17 @@ func ValidateTransition(currentStatus models.OrderStatus, newStatus models.Order
 	)
 }
 
+// IsRevert reports whether moving from currentStatus to newStatus is a
+// revert transition in the active lifecycle.
+func IsRevert(currentStatus, newStatus models.OrderStatus) bool {
+	for _, t := range transitionMap[currentStatus] {
+		if t.To == newStatus {
+			return t.Revert
+		}
+	}
+	return false
+}
+
 // GetAllowedTransitions returns the list of statuses that an order can
 // move to from its current status, optionally filtered by role.
 func GetAllowedTransitions(currentStatus models.OrderStatus, role models.Role) []models.OrderStatus {
@@ -103,3 +263,41 @@ func GetAllowedTransitions(currentStatus models.OrderStatus, role models.Role) [
 	}
 	return result
 }
+
+// GetAllTransitions returns, for every role that can act on an order in
+// currentStatus, the statuses that role may move it to. Terminal statuses
+// return an empty map.
+func GetAllTransitions(currentStatus models.OrderStatus) map[models.Role][]models.OrderStatus {
+	result := make(map[models.Role][]models.OrderStatus)
+	for _, t := range transitionMap[currentStatus] {
+		for _, role := range t.AllowedRoles {
+			result[role] = append(result[role], t.To)
+		}
+	}
+	return result
+}
+
+// StatusNode is one status of the lifecycle with every transition out of
+// it.
+type StatusNode struct {
+	Status models.OrderStatus `json:"status"`
+	// Terminal marks statuses with no way out.
+	Terminal    bool         `json:"terminal"`
+	Transitions []Transition `json:"transitions"`
+}
+
+// GetTransitionGraph returns the whole active lifecycle: every status in
+// the order it was declared, each with the statuses it may move to and the
+// roles allowed to move it there. The result is a copy and safe to modify.
+func GetTransitionGraph() []StatusNode {
+	graph := make([]StatusNode, 0, len(statusOrder))
+	for _, status := range statusOrder {
+		transitions := make([]Transition, 0, len(transitionMap[status]))
+		for _, t := range transitionMap[status] {
+			t.AllowedRoles = append([]models.Role(nil), t.AllowedRoles...)
+			transitions = append(transitions, t)
+		}
+		graph = append(graph, StatusNode{Status: status, Terminal: len(transitions) == 0, Transitions: transitions})
+	}
+	return graph
+}
@@ -1,15 +1,45 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 func post(url string, body map[string]interface{}, headers map[string]string) map[string]interface{} {
+	_, result := postCode(url, body, headers)
+	return result
+}
+
+func postCode(url string, body map[string]interface{}, headers map[string]string) (int, map[string]interface{}) {
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", url, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	fmt.Printf("[%d] %s\n", resp.StatusCode, string(data))
+	var result map[string]interface{}
+	json.Unmarshal(data, &result)
+	return resp.StatusCode, result
+}
+
+func postList(url string, body []map[string]interface{}, headers map[string]string) map[string]interface{} {
 	b, _ := json.Marshal(body)
 	req, _ := http.NewRequest("POST", url, bytes.NewReader(b))
 	req.Header.Set("Content-Type", "application/json")
@@ -49,6 +79,44 @@ func patch(url string, body map[string]interface{}, headers map[string]string) (
 	return resp.StatusCode, result
 }
 
+func put(url string, body map[string]interface{}, headers map[string]string) (int, map[string]interface{}) {
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest("PUT", url, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	fmt.Printf("[%d] %s\n", resp.StatusCode, string(data))
+	var result map[string]interface{}
+	json.Unmarshal(data, &result)
+	return resp.StatusCode, result
+}
+
+func del(url string, headers map[string]string) (int, map[string]interface{}) {
+	req, _ := http.NewRequest("DELETE", url, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	fmt.Printf("[%d] %s\n", resp.StatusCode, string(data))
+	var result map[string]interface{}
+	json.Unmarshal(data, &result)
+	return resp.StatusCode, result
+}
+
 func get(url string, headers map[string]string) map[string]interface{} {
 	req, _ := http.NewRequest("GET", url, nil)
 	for k, v := range headers {
@@ -67,6 +135,41 @@ func get(url string, headers map[string]string) map[string]interface{} {
 	return result
 }
 
+func getList(url string, headers map[string]string) []map[string]interface{} {
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	fmt.Printf("[%d] %s\n", resp.StatusCode, string(data))
+	var result []map[string]interface{}
+	json.Unmarshal(data, &result)
+	return result
+}
+
+// errorCode returns the machine-readable code of an error response.
+func errorCode(body map[string]interface{}) string {
+	apiErr, _ := body["error"].(map[string]interface{})
+	code, _ := apiErr["code"].(string)
+	return code
+}
+
+// password is the password every user registered by these checks uses.
+const password = "correct-horse"
+
+// login obtains an access token for the user and returns the auth headers.
+func login(base, userID string) map[string]string {
+	session := post(base+"/api/auth/login", map[string]interface{}{"user_id": userID, "password": password}, nil)
+	token, _ := session["token"].(string)
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
 func main() {
 	base := "http://localhost:8080"
 	passed := 0
@@ -84,81 +187,609 @@ func main() {
 
 	// 1. Register users
 	fmt.Println("\n=== REGISTER USERS ===")
-	customer := post(base+"/api/users", map[string]interface{}{"name": "Alice", "role": "customer"}, nil)
+	customer := post(base+"/api/users", map[string]interface{}{"name": "Alice", "password": password, "role": "customer", "phone": "+14155550101"}, nil)
 	customerID := customer["id"].(string)
 	check("Customer registered", customerID != "")
+	code, typo := postCode(base+"/api/users", map[string]interface{}{"name": "Typo", "role": "customer", "phone": "+14155550109", "adress": "1 Main St"}, nil)
+	typoFields, _ := typo["errors"].([]interface{})
+	check("Unknown body field rejected (400)", code == 400 && len(typoFields) == 1)
+	code, _ = postCode(base+"/api/users", map[string]interface{}{"name": 42, "role": "customer"}, nil)
+	check("Wrongly typed field rejected (400)", code == 400)
+	code, _ = postCode(base+"/api/users", map[string]interface{}{"name": "Typo", "role": "customer"}, map[string]string{"Content-Type": "text/plain"})
+	check("Non-JSON content type rejected (415)", code == 415)
+	code, invalid := postCode(base+"/api/users", map[string]interface{}{"name": "", "role": "chef"}, nil)
+	problems, _ := invalid["errors"].([]interface{})
+	check("All validation problems reported (400)", code == 400 && len(problems) == 3)
 
-	restaurant := post(base+"/api/users", map[string]interface{}{"name": "Pizza Palace", "role": "restaurant"}, nil)
+	restaurant := post(base+"/api/users", map[string]interface{}{"name": "Pizza Palace", "password": password, "role": "restaurant"}, nil)
 	restaurantID := restaurant["id"].(string)
 	check("Restaurant registered", restaurantID != "")
 
-	driver := post(base+"/api/users", map[string]interface{}{"name": "Bob Driver", "role": "driver"}, nil)
+	driver := post(base+"/api/users", map[string]interface{}{"name": "Bob Driver", "password": password, "role": "driver", "phone": "+14155550102"}, nil)
 	driverID := driver["id"].(string)
 	check("Driver registered", driverID != "")
+	check("New drivers start unavailable", driver["available"] == false)
+
+	// 1b. Authentication
+	fmt.Println("\n=== AUTHENTICATION ===")
+	code, _ = patch(base+"/api/orders/none/status", map[string]interface{}{"status": "CONFIRMED"}, map[string]string{"X-User-ID": customerID, "X-User-Role": "customer"})
+	check("Raw identity headers are rejected (401)", code == 401)
+	code, _ = patch(base+"/api/orders/none/status", map[string]interface{}{"status": "CONFIRMED"}, map[string]string{"Authorization": "Bearer not-a-token"})
+	check("Invalid token is rejected (401)", code == 401)
+	code, _ = postCode(base+"/api/auth/login", map[string]interface{}{"user_id": customerID, "password": "wrong-horse"}, nil)
+	check("Wrong password is rejected (401)", code == 401)
+	code, _ = postCode(base+"/api/auth/login", map[string]interface{}{"user_id": "no-such-user", "password": password}, nil)
+	check("Unknown user is rejected (401)", code == 401)
+	check("User list requires a token", get(base+"/api/users", nil)["error"] != nil)
 
 	// 2. Create order
 	fmt.Println("\n=== CREATE ORDER ===")
-	custHeaders := map[string]string{"X-User-ID": customerID, "X-User-Role": "customer"}
-	restHeaders := map[string]string{"X-User-ID": restaurantID, "X-User-Role": "restaurant"}
-	drvHeaders := map[string]string{"X-User-ID": driverID, "X-User-Role": "driver"}
+	custHeaders := login(base, customerID)
+	restHeaders := login(base, restaurantID)
+	drvHeaders := login(base, driverID)
+
+	pizza := post(base+"/api/restaurants/"+restaurantID+"/menu", map[string]interface{}{
+		"name": "Margherita Pizza", "price": 12.99, "category": "Pizza",
+	}, restHeaders)
+	pizzaID := pizza["id"].(string)
+	burger := post(base+"/api/restaurants/"+restaurantID+"/menu", map[string]interface{}{
+		"name": "Burger", "price": 9.99, "category": "Mains",
+	}, restHeaders)
+	burgerID := burger["id"].(string)
+	check("Menu items added", pizzaID != "" && burgerID != "")
+	code, _ = postCode(base+"/api/restaurants/"+restaurantID+"/menu", map[string]interface{}{"name": " margherita  PIZZA", "price": 11}, restHeaders)
+	check("Duplicate dish name rejected (409)", code == 409)
+	code, _ = put(base+"/api/restaurants/"+restaurantID+"/menu/"+burgerID, map[string]interface{}{"name": "Margherita Pizza", "price": 9.99, "category": "Mains"}, restHeaders)
+	check("Renaming onto an existing dish rejected (409)", code == 409)
+
+	fmt.Println("\n=== MENU CATEGORIES ===")
+	drinks := post(base+"/api/restaurants/"+restaurantID+"/categories", map[string]interface{}{"name": "Drinks"}, restHeaders)
+	check("Category created", drinks["id"] != nil && drinks["name"] == "Drinks")
+	code, _ = postCode(base+"/api/restaurants/"+restaurantID+"/categories", map[string]interface{}{"name": " drinks "}, restHeaders)
+	check("Duplicate category rejected (409)", code == 409)
+	cola := post(base+"/api/restaurants/"+restaurantID+"/menu", map[string]interface{}{
+		"name": "Cola", "price": 1.99, "category": "DRINKS",
+	}, restHeaders)
+	check("Item filed under existing category spelling", cola["category"] == "Drinks")
+	pasta := post(base+"/api/restaurants/"+restaurantID+"/menu", map[string]interface{}{
+		"name": "Lasagne", "price": 11.5, "category": "pasta",
+	}, restHeaders)
+	check("Unknown category created on first use", pasta["category"] == "pasta")
+	categories := getList(base+"/api/restaurants/"+restaurantID+"/categories", nil)
+	check("Categories listed", len(categories) >= 3)
+	byPrice := getList(base+"/api/restaurants/"+restaurantID+"/menu?sort=price:desc", nil)
+	cheapestLast := len(byPrice) > 1
+	for i := 1; i < len(byPrice); i++ {
+		cheapestLast = cheapestLast && byPrice[i-1]["price"].(float64) >= byPrice[i]["price"].(float64)
+	}
+	check("Menu sorts by price", cheapestLast)
+	menuCounts := getList(base+"/api/restaurants/"+restaurantID+"/menu/categories", nil)
+	drinkCount := 0.0
+	for _, c := range menuCounts {
+		if c["category"] == "Drinks" {
+			drinkCount, _ = c["count"].(float64)
+		}
+	}
+	check("Menu categories counted", drinkCount == 1)
+	code, _ = del(base+"/api/restaurants/"+restaurantID+"/categories/"+drinks["id"].(string), restHeaders)
+	check("Category in use cannot be deleted (409)", code == 409)
+
+	fmt.Println("\n=== BULK MENU UPLOAD ===")
+	bulk := postList(base+"/api/restaurants/"+restaurantID+"/menu/bulk", []map[string]interface{}{
+		{"name": "Garlic Bread", "price": 4.99, "category": "Sides"},
+		{"name": "Free Lunch", "price": 0},
+	}, restHeaders)
+	bulkResults, _ := bulk["results"].([]interface{})
+	check("Bulk upload reports partial success", bulk["created"] == 1.0 && bulk["failed"] == 1.0 && len(bulkResults) == 2)
+	if len(bulkResults) == 2 {
+		first, _ := bulkResults[0].(map[string]interface{})
+		second, _ := bulkResults[1].(map[string]interface{})
+		check("Bulk results are per item", first["id"] != nil && second["error"] != nil)
+	}
+	availabilityURL := base + "/api/restaurants/" + restaurantID + "/menu/availability"
+	code, toggled := patch(availabilityURL, map[string]interface{}{"item_ids": []string{pizzaID, burgerID}, "available": true}, restHeaders)
+	check("Bulk availability skips unchanged items (200)", code == 200 && toggled["modified"] == 0.0)
+	code, toggled = patch(availabilityURL, map[string]interface{}{"item_ids": []string{pizzaID, "no-such-item"}, "available": false}, restHeaders)
+	check("Bulk availability rejects unknown items (400)", code == 400 && errorCode(toggled) == "VALIDATION_FAILED")
+	code, _ = patch(availabilityURL, map[string]interface{}{"item_ids": []string{pizzaID}, "available": false}, custHeaders)
+	check("Customer cannot change availability (403)", code == 403)
+
+	// 2a. Restaurant discovery
+	fmt.Println("\n=== RESTAURANT SEARCH ===")
+	code, _ = put(base+"/api/restaurants/"+restaurantID+"/cuisine", map[string]interface{}{"cuisine": "Italian", "tags": []string{"Pizza"}}, restHeaders)
+	check("Restaurant sets cuisine (200)", code == 200)
+	code, _ = put(base+"/api/restaurants/"+restaurantID+"/cuisine", map[string]interface{}{"cuisine": "thai"}, custHeaders)
+	check("Customer cannot set cuisine (403)", code == 403)
+	found := false
+	for _, r := range getList(base+"/api/restaurants?cuisine=italian&q=pizza%20pal&limit=100", nil) {
+		if r["id"] == restaurantID {
+			found = true
+			check("Listing is trimmed", r["settings"] == nil && r["role"] == nil)
+		}
+	}
+	check("Restaurant found by cuisine and name", found)
+	badPage := get(base+"/api/restaurants?limit=0", nil)
+	check("Search rejects an invalid limit", badPage["error"] != nil)
+	code, _ = put(base+"/api/restaurants/"+restaurantID+"/location", map[string]interface{}{"lat": 48.8566, "lng": 2.3522}, restHeaders)
+	check("Restaurant sets its location (200)", code == 200)
+	code, _ = put(base+"/api/restaurants/"+restaurantID+"/location", map[string]interface{}{"lat": 91, "lng": 0}, restHeaders)
+	check("Location rejects invalid coordinates (400)", code == 400)
+	found = false
+	for _, r := range getList(base+"/api/restaurants/nearby?lat=48.8656&lng=2.3522&radius_km=2&limit=100", nil) {
+		if r["id"] == restaurantID {
+			found = true
+			km, _ := r["distance_km"].(float64)
+			check("Nearby result includes its distance", km > 0.9 && km < 1.1)
+		}
+	}
+	check("Restaurant found nearby", found)
+	check("Nothing is nearby in the ocean", len(getList(base+"/api/restaurants/nearby?lat=0&lng=-30", nil)) == 0)
+	badRadius := get(base+"/api/restaurants/nearby?lat=48.8&lng=2.3&radius_km=500", nil)
+	check("Nearby rejects an oversized radius", errorCode(badRadius) == "BAD_REQUEST")
 
 	order := post(base+"/api/orders", map[string]interface{}{
 		"restaurant_id":    restaurantID,
-		"items":            []map[string]interface{}{{"name": "Margherita Pizza", "quantity": 2, "price": 12.99}},
+		"items":            []map[string]interface{}{{"menu_item_id": pizzaID, "quantity": 2, "special_instructions": "  No onions\x00 "}},
 		"delivery_address": "123 Main St",
+		"delivery_lat":     48.8656,
+		"delivery_lng":     2.3522,
+		"payment_method":   "Cash",
+		"notes":            "Ring the bell",
 	}, custHeaders)
 	orderID := order["id"].(string)
 	check("Order created with status PLACED", order["status"] == "PLACED")
+	// 0.009° of latitude is about 1.00 km.
+	if breakdown, ok := order["price_breakdown"].(map[string]interface{}); ok {
+		check("Order records its delivery distance", breakdown["delivery_distance_km"] == 1.0)
+	}
+	check("Order keeps its notes", order["notes"] == "Ring the bell")
+	check("Payment method is normalized", order["payment_method"] == "cash" && order["payment_status"] == "pending")
+	if lines, _ := order["items"].([]interface{}); len(lines) > 0 {
+		line, _ := lines[0].(map[string]interface{})
+		check("Item instructions are cleaned", line["special_instructions"] == "No onions")
+	}
+	code, longNotes := postCode(base+"/api/orders", map[string]interface{}{
+		"restaurant_id":    restaurantID,
+		"items":            []map[string]interface{}{{"menu_item_id": pizzaID, "quantity": 1}},
+		"delivery_address": "123 Main St",
+		"payment_method":   "Bitcoin",
+		"notes":            strings.Repeat("x", 501),
+	}, custHeaders)
+	problems, _ = longNotes["errors"].([]interface{})
+	check("Overlong notes and unknown payment method rejected (400)", code == 400 && len(problems) == 2)
+	code, badAddress := postCode(base+"/api/orders", map[string]interface{}{
+		"restaurant_id":  restaurantID,
+		"items":          []map[string]interface{}{{"menu_item_id": pizzaID, "quantity": 1}},
+		"postal_address": map[string]interface{}{"street": "1 Main St", "city": "Springfield", "postal_code": "1234", "country": "us"},
+		"payment_method": "cash",
+	}, custHeaders)
+	problems, _ = badAddress["errors"].([]interface{})
+	badField := ""
+	if len(problems) == 1 {
+		badField, _ = problems[0].(map[string]interface{})["field"].(string)
+	}
+	check("Postal code checked against the country (400)", code == 400 && badField == "postal_address.postal_code")
+	code, mixed := postCode(base+"/api/orders", map[string]interface{}{
+		"restaurant_id":    restaurantID,
+		"items":            []map[string]interface{}{{"menu_item_id": pizzaID, "quantity": 1}, {"menu_item_id": "missing-1", "quantity": 1}, {"menu_item_id": "missing-2", "quantity": 1}},
+		"delivery_address": "123 Main St",
+		"payment_method":   "cash",
+	}, custHeaders)
+	problems, _ = mixed["errors"].([]interface{})
+	itemChecks, _ := mixed["items"].([]interface{})
+	firstStatus := ""
+	if len(itemChecks) == 3 {
+		firstStatus, _ = itemChecks[0].(map[string]interface{})["status"].(string)
+	}
+	check("Every bad item reported at once (400)", code == 400 && len(problems) == 2 && firstStatus == "ok")
+	breakdown, _ := order["price_breakdown"].(map[string]interface{})
+	check("Order has a price breakdown", breakdown != nil && breakdown["subtotal"] == order["total_amount"])
+	check("Breakdown grand total matches order", breakdown != nil && breakdown["grand_total"] == order["grand_total"])
+
+	// 2b. Stale client totals are rejected
+	fmt.Println("\n=== EXPECTED TOTAL ===")
+	newOrder := func(expected interface{}) (int, map[string]interface{}) {
+		body := map[string]interface{}{
+			"restaurant_id":    restaurantID,
+			"items":            []map[string]interface{}{{"menu_item_id": burgerID, "quantity": 2}},
+			"delivery_address": "123 Main St",
+			"payment_method":   "Cash",
+		}
+		if expected != nil {
+			body["expected_total"] = expected
+		}
+		return postCode(base+"/api/orders", body, custHeaders)
+	}
+	code, matched := newOrder(19.98)
+	check("Matching expected_total accepted (201)", code == 201)
+	code, mismatch := newOrder(15.00)
+	check("Mismatched expected_total rejected (409)", code == 409)
+	check("Mismatch reports both totals", mismatch["expected_total"] == 15.0 && mismatch["total"] == 19.98)
+	code, _ = newOrder(nil)
+	check("Absent expected_total accepted (201)", code == 201)
+
+	// 2c. Restaurants reject orders they cannot fulfil
+	fmt.Println("\n=== REJECTION ===")
+	if id, ok := matched["id"].(string); ok {
+		code, _ = patch(base+"/api/orders/"+id+"/status", map[string]interface{}{"status": "REJECTED"}, restHeaders)
+		check("Rejection without a reason refused (400)", code == 400)
+		code, _ = patch(base+"/api/orders/"+id+"/status", map[string]interface{}{"status": "REJECTED", "rejection_reason": "Out of buns"}, custHeaders)
+		check("Customer cannot reject (403)", code == 403)
+		code, rejected := patch(base+"/api/orders/"+id+"/status", map[string]interface{}{"status": "REJECTED", "rejection_reason": "Out of buns"}, restHeaders)
+		check("Restaurant rejects a PLACED order (200)", code == 200 && rejected["rejection_reason"] == "Out of buns")
+		code, _ = patch(base+"/api/orders/"+id+"/status", map[string]interface{}{"status": "CANCELLED"}, custHeaders)
+		check("REJECTED is terminal (400)", code == 400)
+	}
+
+	// 2d. Restaurant order summary
+	fmt.Println("\n=== ORDER SUMMARY ===")
+	summary := get(base+"/api/restaurants/"+restaurantID+"/orders/summary", restHeaders)
+	counts, _ := summary["counts"].(map[string]interface{})
+	placed, _ := counts["PLACED"].(float64)
+	check("Summary counts placed orders", placed >= 2)
+	rejectedCount, _ := counts["REJECTED"].(float64)
+	check("Summary counts rejected orders separately", rejectedCount >= 1)
+	total, _ := summary["total"].(float64)
+	check("Summary total covers placed orders", total >= placed)
+	denied := get(base+"/api/restaurants/"+restaurantID+"/orders/summary", custHeaders)
+	check("Customer cannot view restaurant summary", denied["error"] != nil)
+	popular := get(base+"/api/restaurants/"+restaurantID+"/menu/popular?limit=5", restHeaders)
+	ranked, _ := popular["items"].([]interface{})
+	check("Best sellers are ranked", len(ranked) > 0 && len(ranked) <= 5)
+	denied = get(base+"/api/restaurants/"+restaurantID+"/menu/popular", custHeaders)
+	check("Customer cannot view best sellers", errorCode(denied) == "FORBIDDEN")
 
 	// 3. Test invalid transition: customer trying to confirm
 	fmt.Println("\n=== INVALID: CUSTOMER CONFIRMS ===")
-	code, _ := patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CONFIRMED"}, custHeaders)
+	code, denied = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CONFIRMED"}, custHeaders)
 	check("Customer cannot confirm (403)", code == 403)
+	check("Role violation has code TRANSITION_FORBIDDEN", errorCode(denied) == "TRANSITION_FORBIDDEN")
+
+	// 3b. Request body field whitelisting per role
+	fmt.Println("\n=== INVALID: PRIVILEGED FIELDS ===")
+	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CANCELLED", "driver_id": customerID}, custHeaders)
+	check("Customer cannot set driver_id (403)", code == 403)
+	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CONFIRMED", "item_confirmation": map[string]interface{}{}}, drvHeaders)
+	check("Driver cannot send item_confirmation (403)", code == 403)
+	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CONFIRMED", "bogus": true}, restHeaders)
+	check("Unknown field rejected (400)", code == 400)
+	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CONFIRMED", "prep_minutes": 0}, restHeaders)
+	check("Non-positive prep_minutes rejected (400)", code == 400)
+	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CONFIRMED", "prep_minutes": 20}, custHeaders)
+	check("Customer cannot send prep_minutes (403)", code == 403)
 
 	// 4. Test invalid state jump: restaurant skips to DELIVERED
 	fmt.Println("\n=== INVALID: SKIP TO DELIVERED ===")
-	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "DELIVERED"}, restHeaders)
+	code, skipped := patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "DELIVERED"}, restHeaders)
 	check("Cannot skip to DELIVERED (400)", code == 400)
+	check("Skipped status has code INVALID_TRANSITION", errorCode(skipped) == "INVALID_TRANSITION")
+	missing := get(base+"/api/orders/no-such-order", custHeaders)
+	check("Missing order has code ORDER_NOT_FOUND", errorCode(missing) == "ORDER_NOT_FOUND" && missing["message"] != nil)
+
+	// 4b. Live status stream
+	fmt.Println("\n=== LIVE STATUS STREAM ===")
+	streamURL := "ws" + strings.TrimPrefix(base, "http") + "/api/orders/" + orderID + "/stream?access_token="
+	_, resp, err := websocket.DefaultDialer.Dial(streamURL+strings.TrimPrefix(drvHeaders["Authorization"], "Bearer "), nil)
+	check("Unassigned driver cannot stream the order (403)", err != nil && resp != nil && resp.StatusCode == 403)
+	stream, _, err := websocket.DefaultDialer.Dial(streamURL+strings.TrimPrefix(custHeaders["Authorization"], "Bearer "), nil)
+	check("Customer opens the order stream", err == nil)
+	var opened map[string]interface{}
+	if stream != nil {
+		stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+		stream.ReadJSON(&opened)
+	}
+	check("Stream starts with the current status", opened["type"] == "snapshot" && opened["status"] == "PLACED")
+	req, _ := http.NewRequest("GET", base+"/api/orders/"+orderID+"/events", nil)
+	req.Header.Set("Authorization", custHeaders["Authorization"])
+	events, err := http.DefaultClient.Do(req)
+	firstEvent := ""
+	if err == nil {
+		line, _ := bufio.NewReader(events.Body).ReadString('\n')
+		firstEvent = strings.TrimSpace(line)
+		events.Body.Close()
+	}
+	check("Event stream starts with a snapshot", err == nil && events.Header.Get("Content-Type") == "text/event-stream" && firstEvent == "event: snapshot")
 
 	// 5. Happy path: full lifecycle
 	fmt.Println("\n=== HAPPY PATH ===")
-	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CONFIRMED"}, restHeaders)
+	code, confirmed := patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CONFIRMED", "transition_id": "confirm-" + orderID, "prep_minutes": 25}, restHeaders)
 	check("PLACED → CONFIRMED (200)", code == 200)
+	var pushed map[string]interface{}
+	if stream != nil {
+		stream.ReadJSON(&pushed)
+		stream.Close()
+	}
+	check("Stream pushes the status change", pushed["type"] == "status_change" && pushed["status"] == "CONFIRMED")
+	check("Confirmation records prep_minutes", confirmed["prep_minutes"] == 25.0)
+	check("Confirmation updates the ETA", confirmed["estimated_delivery_at"] != order["estimated_delivery_at"])
+
+	// Replaying the same transition ID must not re-apply or error.
+	fmt.Println("\n=== IDEMPOTENT REPLAY ===")
+	code, replayed := patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CONFIRMED", "transition_id": "confirm-" + orderID}, restHeaders)
+	history, _ := replayed["status_history"].([]interface{})
+	check("Replayed transition returns 200", code == 200)
+	check("Replayed transition not recorded twice", replayed["status"] == "CONFIRMED" && len(history) == 2)
 
 	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "PREPARING"}, restHeaders)
 	check("CONFIRMED → PREPARING (200)", code == 200)
+	queue := getList(base+"/api/restaurants/"+restaurantID+"/queue", restHeaders)
+	check("Kitchen queue lists the order first", len(queue) > 0 && queue[0]["id"] == orderID && queue[0]["position"] == 1.0)
+	denied = get(base+"/api/restaurants/"+restaurantID+"/queue", custHeaders)
+	check("Customer cannot view the kitchen queue", errorCode(denied) == "FORBIDDEN")
+
+	// An accidental step can be undone straight away.
+	fmt.Println("\n=== REVERT ===")
+	code, reverted := patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CONFIRMED"}, restHeaders)
+	history, _ = reverted["status_history"].([]interface{})
+	check("PREPARING → CONFIRMED revert (200)", code == 200)
+	check("Revert is marked in history", len(history) > 0 && history[len(history)-1].(map[string]interface{})["reverted"] == true)
+	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "PREPARING"}, restHeaders)
+	check("CONFIRMED → PREPARING again (200)", code == 200)
+
+	fmt.Println("\n=== TRANSITIONS BY ROLE ===")
+	asDriver := get(base+"/api/orders/"+orderID+"/transitions?role=driver", restHeaders)
+	driverNext, _ := asDriver["allowed_transitions"].([]interface{})
+	check("Driver has no transitions while PREPARING", len(driverNext) == 0)
+	byRole := get(base+"/api/orders/"+orderID+"/transitions?all_roles=true", restHeaders)
+	roles, _ := byRole["transitions_by_role"].(map[string]interface{})
+	check("All-roles mode lists the restaurant's transitions", roles["restaurant"] != nil)
+	lifecycle := get(base+"/api/orders/lifecycle", nil)
+	nodes, _ := lifecycle["statuses"].([]interface{})
+	terminal := false
+	for _, n := range nodes {
+		node := n.(map[string]interface{})
+		if node["status"] == "DELIVERED" {
+			terminal = node["terminal"] == true
+		}
+	}
+	check("Lifecycle graph is public and marks DELIVERED terminal", len(nodes) > 0 && terminal)
 
 	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "READY_FOR_PICKUP"}, restHeaders)
 	check("PREPARING → READY_FOR_PICKUP (200)", code == 200)
 
+	code, _ = postCode(base+"/api/orders/"+orderID+"/location", map[string]interface{}{"lat": 37.77, "lng": -122.42}, drvHeaders)
+	check("Unassigned driver cannot report location (403)", code == 403)
+
+	fmt.Println("\n=== DRIVER AVAILABILITY ===")
+	code, offline := patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "PICKED_UP"}, drvHeaders)
+	check("Unavailable driver cannot pick up (409)", code == 409 && errorCode(offline) == "DRIVER_UNAVAILABLE")
+	code, _ = postCode(base+"/api/users/"+driverID+"/availability", map[string]interface{}{"available": true}, custHeaders)
+	check("Customer cannot set driver availability (403)", code == 403)
+	code, online := postCode(base+"/api/users/"+driverID+"/availability", map[string]interface{}{"available": true}, drvHeaders)
+	check("Driver goes online", code == 200 && online["available"] == true && online["last_seen"] != nil)
+
 	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "PICKED_UP"}, drvHeaders)
 	check("READY_FOR_PICKUP → PICKED_UP (200)", code == 200)
 
-	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "OUT_FOR_DELIVERY"}, drvHeaders)
+	fmt.Println("\n=== DRIVER LOCATION ===")
+	code, _ = postCode(base+"/api/orders/"+orderID+"/location", map[string]interface{}{"lat": 37.77, "lng": -122.42}, drvHeaders)
+	check("Driver reports location (200)", code == 200)
+	code, _ = postCode(base+"/api/orders/"+orderID+"/location", map[string]interface{}{"lat": 91, "lng": 0}, drvHeaders)
+	check("Out-of-range location rejected (400)", code == 400)
+	tracked := get(base+"/api/orders/"+orderID+"/location?trail=true", custHeaders)
+	position, _ := tracked["location"].(map[string]interface{})
+	trail, _ := tracked["trail"].([]interface{})
+	check("Customer sees driver location", position != nil && position["lat"] == 37.77 && len(trail) == 1)
+
+	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "OUT_FOR_DELIVERY", "note": strings.Repeat("x", 281)}, drvHeaders)
+	check("Overlong status note rejected (400)", code == 400)
+	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "OUT_FOR_DELIVERY", "note": " heavy traffic "}, drvHeaders)
 	check("PICKED_UP → OUT_FOR_DELIVERY (200)", code == 200)
+	noted := false
+	for _, change := range getList(base+"/api/orders/"+orderID+"/history", custHeaders) {
+		noted = noted || (change["to_status"] == "OUT_FOR_DELIVERY" && change["note"] == "heavy traffic")
+	}
+	check("History shows the status note", noted)
+	before := get(base+"/api/orders/"+orderID+"/eta", custHeaders)
+	code, delayed := postCode(base+"/api/orders/"+orderID+"/delay", map[string]interface{}{"minutes": 10, "reason": "Road closed"}, drvHeaders)
+	delays, _ := delayed["delays"].([]interface{})
+	check("Driver reports a delay (200)", code == 200 && len(delays) == 1)
+	after := get(base+"/api/orders/"+orderID+"/eta", custHeaders)
+	check("ETA reflects the delay", after["estimated_delivery_at"] != before["estimated_delivery_at"] && after["estimated_delivery_at"] == delayed["estimated_delivery_at"])
+	code, _ = postCode(base+"/api/orders/"+orderID+"/delay", map[string]interface{}{"minutes": 0, "reason": "Nothing"}, drvHeaders)
+	check("Delay must be positive (400)", code == 400)
+	code, _ = postCode(base+"/api/orders/"+orderID+"/delay", map[string]interface{}{"minutes": 5, "reason": "Hungry"}, custHeaders)
+	check("Customer cannot report a delay (403)", code == 403)
 
 	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "DELIVERED"}, drvHeaders)
 	check("OUT_FOR_DELIVERY → DELIVERED (200)", code == 200)
+	delivered := get(base+"/api/orders/"+orderID, custHeaders)
+	check("Cash order is paid on delivery", delivered["payment_status"] == "paid")
 
 	// 6. Test terminal state: cannot transition from DELIVERED
 	fmt.Println("\n=== INVALID: TRANSITION FROM DELIVERED ===")
 	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "PLACED"}, restHeaders)
 	check("Cannot transition from DELIVERED (400)", code == 400)
 
+	// 6b. Reordering a delivered order
+	fmt.Println("\n=== REORDER ===")
+	code, reorder := postCode(base+"/api/orders/"+orderID+"/reorder", nil, custHeaders)
+	check("Delivered order reordered (201)", code == 201)
+	if again, ok := reorder["order"].(map[string]interface{}); ok {
+		check("Reorder is a fresh PLACED order", again["id"] != orderID && again["status"] == "PLACED")
+		check("Reorder keeps the delivery address", again["delivery_address"] == order["delivery_address"])
+	}
+	code, _ = postCode(base+"/api/orders/"+orderID+"/reorder", nil, restHeaders)
+	check("Only the customer can reorder (403)", code == 403)
+
+	// 6c. Orders keep the menu as it was when ordered
+	fmt.Println("\n=== MENU SNAPSHOT ===")
+	code, edited := put(base+"/api/restaurants/"+restaurantID+"/menu/"+pizzaID, map[string]interface{}{
+		"name": "Margherita Pizza", "price": 14.5, "category": "Pizza", "description": "Now with buffalo mozzarella",
+	}, restHeaders)
+	check("Menu item edit bumps its version", code == 200 && edited["version"] == 2.0)
+	snapshot := get(base+"/api/orders/"+orderID+"/items", custHeaders)
+	if lines, _ := snapshot["items"].([]interface{}); len(lines) > 0 {
+		line, _ := lines[0].(map[string]interface{})
+		check("Order line keeps its original price", line["price"] == 12.99)
+		check("Order line records the menu version", line["menu_item_version"] == 1.0 && line["category"] == "Pizza")
+	}
+
 	// 7. Test cancellation flow
 	fmt.Println("\n=== CANCELLATION FLOW ===")
 	order2 := post(base+"/api/orders", map[string]interface{}{
 		"restaurant_id":    restaurantID,
-		"items":            []map[string]interface{}{{"name": "Burger", "quantity": 1, "price": 9.99}},
+		"items":            []map[string]interface{}{{"menu_item_id": burgerID, "quantity": 1}},
 		"delivery_address": "456 Oak Ave",
+		"payment_method":   "Card",
 	}, custHeaders)
 	order2ID := order2["id"].(string)
-	code, _ = patch(base+"/api/orders/"+order2ID+"/status", map[string]interface{}{"status": "CANCELLED"}, custHeaders)
+	check("Card order holds a payment intent", order2["payment_intent_id"] != nil && order2["payment_status"] == "pending")
+	code, paid := postCode(base+"/api/orders/"+order2ID+"/payment", map[string]interface{}{"status": "paid"}, custHeaders)
+	check("Customer pays card order through the provider (200)", code == 200 && paid["payment_status"] == "paid" && paid["payment_charge_id"] != nil)
+	code, _ = postCode(base+"/api/orders/"+order2ID+"/payment", map[string]interface{}{"status": "refunded"}, restHeaders)
+	check("Active order cannot be refunded (409)", code == 409)
+	code, _ = postCode(base+"/api/orders/"+order2ID+"/payment", map[string]interface{}{"status": "refunded"}, custHeaders)
+	check("Customer cannot issue a refund (403)", code == 403)
+	code, cancelled := patch(base+"/api/orders/"+order2ID+"/status", map[string]interface{}{"status": "CANCELLED"}, custHeaders)
 	check("Customer cancels PLACED order (200)", code == 200)
+	check("Cancelled card order is refunded", cancelled["payment_status"] == "refunded" && cancelled["payment_refund_id"] != nil)
+	refund, _ := cancelled["refund"].(map[string]interface{})
+	check("Unprepared order is refunded in full", refund != nil && refund["amount"] == cancelled["grand_total"] && refund["partial"] == false)
+	code, _ = postCode(base+"/api/orders/"+order2ID+"/payment", map[string]interface{}{"status": "refunded"}, restHeaders)
+	check("Order cannot be refunded twice (409)", code == 409)
+
+	// 7b. Scheduled orders
+	fmt.Println("\n=== SCHEDULED ORDERS ===")
+	code, scheduled := postCode(base+"/api/orders", map[string]interface{}{
+		"restaurant_id":    restaurantID,
+		"items":            []map[string]interface{}{{"menu_item_id": burgerID, "quantity": 1}},
+		"delivery_address": "456 Oak Ave",
+		"payment_method":   "Card",
+		"scheduled_for":    time.Now().Add(2 * time.Hour).UTC().Format(time.RFC3339),
+	}, custHeaders)
+	check("Future order created as SCHEDULED (201)", code == 201 && scheduled["status"] == "SCHEDULED")
+	if id, ok := scheduled["id"].(string); ok {
+		code, _ = patch(base+"/api/orders/"+id+"/status", map[string]interface{}{"status": "CONFIRMED"}, restHeaders)
+		check("Restaurant cannot confirm a SCHEDULED order (400)", code == 400)
+		code, _ = patch(base+"/api/orders/"+id+"/status", map[string]interface{}{"status": "CANCELLED"}, custHeaders)
+		check("Customer cancels SCHEDULED order (200)", code == 200)
+	}
+	code, _ = postCode(base+"/api/orders", map[string]interface{}{
+		"restaurant_id":    restaurantID,
+		"items":            []map[string]interface{}{{"menu_item_id": burgerID, "quantity": 1}},
+		"delivery_address": "456 Oak Ave",
+		"payment_method":   "Card",
+		"scheduled_for":    time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+	}, custHeaders)
+	check("Past scheduled_for rejected (400)", code == 400)
+
+	// 8. Order lists are scoped to the caller
+	fmt.Println("\n=== SCOPED ORDER LISTS ===")
+	other := post(base+"/api/users", map[string]interface{}{"name": "Carol", "password": password, "role": "customer", "phone": "+14155550103"}, nil)
+	otherHeaders := login(base, other["id"].(string))
+	otherOrders := getList(base+"/api/orders", otherHeaders)
+	check("Other customer sees none of Alice's orders", len(otherOrders) == 0)
+	batch := post(base+"/api/orders/batch", map[string]interface{}{"ids": []string{orderID, "no-such-order", orderID}}, custHeaders)
+	briefs, _ := batch["orders"].([]interface{})
+	unavailable, _ := batch["unavailable"].([]interface{})
+	check("Batch returns the customer's order once", len(briefs) == 1 && len(unavailable) == 1)
+	batch = post(base+"/api/orders/batch", map[string]interface{}{"ids": []string{orderID}}, otherHeaders)
+	unavailable, _ = batch["unavailable"].([]interface{})
+	check("Batch hides orders the caller is not party to", len(unavailable) == 1)
+	code, _ = patch(base+"/api/orders/"+orderID+"/status", map[string]interface{}{"status": "CANCELLED"}, otherHeaders)
+	check("Non-party cannot change an order's status (403)", code == 403)
+	check("Other users' contact details are hidden", get(base+"/api/users/"+customerID, otherHeaders)["phone"] == nil)
+	check("Own contact details are shown", get(base+"/api/users/"+customerID, custHeaders)["phone"] == "+14155550101")
+
+	custOrders := getList(base+"/api/orders", custHeaders)
+	allMine := len(custOrders) >= 2
+	for _, o := range custOrders {
+		allMine = allMine && o["customer_id"] == customerID
+	}
+	check("Customer sees only own orders", allMine)
+	newestFirst := true
+	for i := 1; i < len(custOrders); i++ {
+		prev, _ := time.Parse(time.RFC3339, custOrders[i-1]["created_at"].(string))
+		next, _ := time.Parse(time.RFC3339, custOrders[i]["created_at"].(string))
+		newestFirst = newestFirst && !prev.Before(next)
+	}
+	check("Orders are newest first by default", newestFirst)
+	badSort := get(base+"/api/orders?sort=customer_id:asc", custHeaders)
+	check("Unknown sort field rejected", errorCode(badSort) == "BAD_REQUEST")
 
-	// 8. Check history
+	restOrders := getList(base+"/api/orders", restHeaders)
+	allRest := len(restOrders) >= 2
+	for _, o := range restOrders {
+		allRest = allRest && o["restaurant_id"] == restaurantID
+	}
+	check("Restaurant sees only its orders", allRest)
+
+	drvOrders := getList(base+"/api/orders", drvHeaders)
+	allDrv := len(drvOrders) >= 1
+	for _, o := range drvOrders {
+		allDrv = allDrv && (o["driver_id"] == driverID || o["status"] == "READY_FOR_PICKUP")
+	}
+	check("Driver sees own deliveries and available pickups only", allDrv)
+
+	pizzaOrders := getList(base+"/api/orders?item=MARGHERITA", custHeaders)
+	allPizza := len(pizzaOrders) >= 1
+	for _, o := range pizzaOrders {
+		allPizza = allPizza && o["customer_id"] == customerID
+	}
+	check("Item search matches dish names, still scoped", allPizza)
+	check("Item search excludes other dishes", len(getList(base+"/api/orders?item=sushi", custHeaders)) == 0)
+
+	// 8b. Admin endpoints are closed to everyone else
+	fmt.Println("\n=== ADMIN ===")
+	code, _ = postCode(base+"/api/users", map[string]interface{}{"name": "Mallory", "role": "admin"}, nil)
+	check("Admin role cannot self-register (400)", code == 400)
+	code, _ = postCode(base+"/api/admin/orders/"+orderID+"/status", map[string]interface{}{"status": "CANCELLED", "reason": "test"}, restHeaders)
+	check("Restaurant cannot force a status (403)", code == 403)
+	code, _ = del(base+"/api/admin/users/"+customerID, custHeaders)
+	check("Customer cannot delete users (403)", code == 403)
+	code, _ = postCode(base+"/api/admin/coupons", map[string]interface{}{"code": "free100", "discount_type": "percent", "value": 100}, custHeaders)
+	check("Customer cannot create coupons (403)", code == 403)
+
+	// 9. Check history
 	fmt.Println("\n=== ORDER HISTORY ===")
 	get(base+"/api/orders/"+orderID+"/history", custHeaders)
+	code, _ = postCode(base+"/api/orders/"+orderID+"/tip", map[string]interface{}{"tip": 3}, custHeaders)
+	check("Customer tips after delivery (200)", code == 200)
+	fields := map[string]bool{}
+	for _, entry := range getList(base+"/api/orders/"+orderID+"/audit", restHeaders) {
+		fields[entry["field"].(string)] = true
+	}
+	check("Audit records status, driver claim and tip", fields["status"] && fields["driver_id"] && fields["tip"])
+	hidden := get(base+"/api/orders/"+orderID+"/audit", otherHeaders)
+	check("Outsider cannot read the audit (403)", errorCode(hidden) == "FORBIDDEN")
+	hidden = get(base+"/api/orders/"+orderID, otherHeaders)
+	check("Outsider cannot read the order (403)", errorCode(hidden) == "FORBIDDEN")
+	hidden = get(base+"/api/orders/"+orderID+"/history", otherHeaders)
+	check("Outsider cannot read the history (403)", errorCode(hidden) == "FORBIDDEN")
+
+	receipt := get(base+"/api/orders/"+orderID+"/receipt", custHeaders)
+	lines, _ := receipt["lines"].([]interface{})
+	check("Receipt names the restaurant and itemizes lines", receipt["restaurant_name"] != "" && len(lines) > 0)
+	check("Receipt includes the tip in the grand total", receipt["tip"] == 3.0 && receipt["grand_total"].(float64) > receipt["subtotal"].(float64))
+	hidden = get(base+"/api/orders/"+orderID+"/receipt", otherHeaders)
+	check("Outsider cannot read the receipt (403)", errorCode(hidden) == "FORBIDDEN")
+	req, _ = http.NewRequest("GET", base+"/api/orders/"+orderID+"/receipt?format=text", nil)
+	for k, v := range custHeaders {
+		req.Header.Set(k, v)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	text, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	fmt.Printf("[%d]\n%s", resp.StatusCode, text)
+	check("Text receipt is plain text with a total", strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") && strings.Contains(string(text), "Total"))
+
+	// 10. Metrics
+	fmt.Println("\n=== METRICS ===")
+	resp, err = http.Get(base + "/metrics")
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	exposition, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	check("Metrics count requests by route", strings.Contains(string(exposition), `route="/api/orders/{id}"`))
+	check("Metrics count created orders", strings.Contains(string(exposition), "orders_created_total"))
+	check("Metrics report orders by status", strings.Contains(string(exposition), `orders_by_status{status="DELIVERED"}`))
 
 	// Summary
 	fmt.Printf("\n=== RESULTS: %d passed, %d failed ===\n", passed, failed)
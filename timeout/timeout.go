@@ -0,0 +1,169 @@
+package timeout
+
+import (
+	"context"
+	"fmt"
+	"food-delivery-api/events"
+	"food-delivery-api/models"
+	"food-delivery-api/payment"
+	"food-delivery-api/statemachine"
+	"log"
+	"strings"
+	"time"
+)
+
+// Policy maps a status to how long an order may sit in it before being
+// cancelled automatically.
+type Policy map[models.OrderStatus]time.Duration
+
+// DefaultPolicy cancels orders the restaurant has not confirmed within 15 minutes.
+var DefaultPolicy = Policy{models.StatusPlaced: 15 * time.Minute}
+
+// ParsePolicy parses a policy of the form "PLACED=15m,CONFIRMED=1h". An
+// empty string yields an empty policy, which disables timeouts.
+func ParsePolicy(s string) (Policy, error) {
+	policy := Policy{}
+	if strings.TrimSpace(s) == "" {
+		return policy, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid timeout entry '%s'; expected STATUS=DURATION", part)
+		}
+		status := models.OrderStatus(strings.TrimSpace(kv[0]))
+		if !statemachine.IsKnownStatus(status) {
+			return nil, fmt.Errorf("invalid status '%s' in timeout policy", status)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration '%s' for %s", kv[1], status)
+		}
+		if err := statemachine.ValidateTransition(status, models.StatusCancelled, models.RoleSystem); err != nil {
+			return nil, fmt.Errorf("orders in %s cannot time out: %v", status, err)
+		}
+		policy[status] = d
+	}
+	return policy, nil
+}
+
+// Store is the persistence the Sweeper needs. *db.Store and *memstore.Store
+// implement it.
+type Store interface {
+	ListStaleOrders(ctx context.Context, status models.OrderStatus, before time.Time) ([]*models.Order, error)
+	ReplaceOrderIfStatus(ctx context.Context, order *models.Order, expected models.OrderStatus) (bool, error)
+}
+
+// Sweeper periodically cancels orders that have stayed in a status longer
+// than the policy allows.
+type Sweeper struct {
+	Store    Store
+	Policy   Policy
+	Interval time.Duration
+	// Events receives each status change; nil disables publishing.
+	Events *events.Bus
+	// Payments refunds cancelled card orders; nil leaves them to be
+	// refunded by hand.
+	Payments payment.Provider
+}
+
+// NewSweeper creates a Sweeper that checks every interval.
+func NewSweeper(store Store, policy Policy, interval time.Duration) *Sweeper {
+	return &Sweeper{Store: store, Policy: policy, Interval: interval}
+}
+
+// Run sweeps on every tick until ctx is cancelled.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sweep(ctx, time.Now())
+		}
+	}
+}
+
+// Sweep cancels every order that has exceeded its status timeout as of now.
+func (s *Sweeper) Sweep(ctx context.Context, now time.Time) {
+	for status, limit := range s.Policy {
+		deadline := now.Add(-limit)
+		// updated_at is never older than the last status change, so it is
+		// a safe pre-filter; enteredAt gives the exact time in status.
+		orders, err := s.Store.ListStaleOrders(ctx, status, deadline)
+		if err != nil {
+			log.Printf("⚠️ timeout: listing %s orders: %v", status, err)
+			continue
+		}
+		for _, order := range orders {
+			if enteredAt(order).After(deadline) {
+				continue
+			}
+			s.cancel(ctx, order, limit, now)
+		}
+	}
+}
+
+// cancel moves a timed-out order to CANCELLED, recording the system as the actor.
+func (s *Sweeper) cancel(ctx context.Context, order *models.Order, limit time.Duration, now time.Time) {
+	from := order.Status
+	if err := statemachine.ValidateTransition(from, models.StatusCancelled, models.RoleSystem); err != nil {
+		log.Printf("⚠️ timeout: order %s: %v", order.ID, err)
+		return
+	}
+
+	reason := fmt.Sprintf("Timed out after %s in %s", limit, from)
+	change := models.StatusChange{
+		FromStatus:         from,
+		ToStatus:           models.StatusCancelled,
+		ChangedBy:          string(models.RoleSystem),
+		Role:               models.RoleSystem,
+		Timestamp:          now,
+		CancellationReason: reason,
+	}
+	order.StatusHistory = append(order.StatusHistory, change)
+	order.Status = models.StatusCancelled
+	order.CancellationReason = reason
+	order.UpdatedAt = now
+
+	saved, err := s.Store.ReplaceOrderIfStatus(ctx, order, from)
+	if err != nil {
+		log.Printf("⚠️ timeout: cancelling order %s: %v", order.ID, err)
+		return
+	}
+	if saved {
+		s.Events.Publish(order.ID, change)
+		log.Printf("⏱️ Cancelled order %s after %s in %s", order.ID, limit, from)
+		s.refund(ctx, order, now)
+	}
+}
+
+// refund refunds a cancelled card order. It runs only once the
+// cancellation is saved, so an order that moved on concurrently is never
+// refunded.
+func (s *Sweeper) refund(ctx context.Context, order *models.Order, now time.Time) {
+	before := order.PaymentStatus
+	if err := payment.Refund(ctx, s.Payments, order, string(models.RoleSystem), models.RoleSystem, now); err != nil {
+		log.Printf("⚠️ timeout: refunding order %s: %v", order.ID, err)
+		return
+	}
+	if order.PaymentStatus == before {
+		return
+	}
+	if _, err := s.Store.ReplaceOrderIfStatus(ctx, order, models.StatusCancelled); err != nil {
+		log.Printf("⚠️ timeout: saving refund for order %s: %v", order.ID, err)
+	}
+}
+
+// enteredAt returns when the order entered its current status, falling back
+// to its creation time.
+func enteredAt(order *models.Order) time.Time {
+	for i := len(order.StatusHistory) - 1; i >= 0; i-- {
+		if order.StatusHistory[i].ToStatus == order.Status {
+			return order.StatusHistory[i].Timestamp
+		}
+	}
+	return order.CreatedAt
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	cases := map[string]bool{
+		"8.8.8.8":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"224.0.0.1":       false,
+	}
+	for addr, want := range cases {
+		if got := IsPublicIP(net.ParseIP(addr)); got != want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for _, raw := range []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://127.0.0.1:8080/hook",
+		"https://[::1]/hook",
+		"http://localhost/hook",
+		"http://api.localhost/hook",
+	} {
+		if err := CheckURL(context.Background(), raw); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("CheckURL(%s) = %v, want ErrPrivateAddress", raw, err)
+		}
+	}
+	for _, raw := range []string{"ftp://example.com/", "/hook", "http://"} {
+		if err := CheckURL(context.Background(), raw); err == nil {
+			t.Errorf("CheckURL(%s) accepted a non-http URL", raw)
+		}
+	}
+	if err := CheckURL(context.Background(), "https://8.8.8.8/hook"); err != nil {
+		t.Errorf("CheckURL rejected a public address: %v", err)
+	}
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher([]byte("secret"))
+	if err := d.post(srv.URL, []byte("{}")); !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("post to %s = %v, want ErrPrivateAddress", srv.URL, err)
+	}
+	if hits != 0 {
+		t.Fatalf("server received %d requests", hits)
+	}
+
+	d = NewInternalDispatcher([]byte("secret"))
+	if err := d.post(srv.URL, []byte("{}")); err != nil {
+		t.Fatalf("internal dispatcher: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"food-delivery-api/models"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, prefixed
+// with "sha256=", so receivers can verify the payload came from us.
+const SignatureHeader = "X-Webhook-Signature"
+
+// Event is the payload posted when an order changes status.
+type Event struct {
+	OrderID    string             `json:"order_id"`
+	FromStatus models.OrderStatus `json:"from_status"`
+	ToStatus   models.OrderStatus `json:"to_status"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Role       models.Role        `json:"role"`
+}
+
+// Dispatcher delivers events to callback URLs in the background.
+type Dispatcher struct {
+	Secret []byte
+	Client *http.Client
+	// MaxAttempts is the total number of delivery attempts per event.
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles on each retry.
+	Backoff time.Duration
+}
+
+// NewDispatcher creates a Dispatcher that signs payloads with secret. Its
+// client only connects to public addresses, since callback URLs come from
+// users; see NewInternalDispatcher for endpoints the operator configures.
+func NewDispatcher(secret []byte) *Dispatcher {
+	d := NewInternalDispatcher(secret)
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: publicOnly}
+	// No proxy: the check must apply to the callback's own address.
+	d.Client.Transport = &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 5 * time.Second}
+	return d
+}
+
+// NewInternalDispatcher creates a Dispatcher that signs payloads with secret
+// and may deliver to any address, for URLs set by the operator rather than
+// by users.
+func NewInternalDispatcher(secret []byte) *Dispatcher {
+	return &Dispatcher{
+		Secret:      secret,
+		Client:      &http.Client{Timeout: 5 * time.Second},
+		MaxAttempts: 3,
+		Backoff:     time.Second,
+	}
+}
+
+// Send posts the event to url asynchronously, retrying failed deliveries.
+// It returns immediately; failures are logged.
+func (d *Dispatcher) Send(url string, event Event) {
+	d.SendJSON(url, event, "order "+event.OrderID)
+}
+
+// SendJSON posts any JSON payload the same way as Send. about names the
+// payload in log messages.
+func (d *Dispatcher) SendJSON(url string, payload interface{}, about string) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("⚠️ webhook: encoding payload for %s: %v", about, err)
+		return
+	}
+	go d.deliver(url, body, about)
+}
+
+// deliver posts body to url until it succeeds or attempts run out.
+func (d *Dispatcher) deliver(url string, body []byte, about string) {
+	wait := d.Backoff
+	var err error
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		if err = d.post(url, body); err == nil {
+			return
+		}
+		if attempt < d.MaxAttempts {
+			time.Sleep(wait)
+			wait *= 2
+		}
+	}
+	log.Printf("⚠️ webhook: giving up on %s after %d attempts: %v", about, d.MaxAttempts, err)
+}
+
+// post makes a single signed delivery attempt. Any non-2xx response is an error.
+func (d *Dispatcher) post(url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, "sha256="+Sign(body, d.Secret))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body under secret.
+func Sign(body, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}